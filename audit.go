@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"excel_converter/glossary"
+)
+
+// runAudit implements the "audit" command: a read-only notation (表記揺れ) check
+// of every workbook under -dir against a glossary of canonical terms and variants.
+func runAudit(args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	glossaryFlag := fs.String("glossary", "", "Glossary file (CSV/TSV/XLSX): canonical, variant1, variant2, ...")
+	formatFlag := fs.String("format", "xlsx", "Output format (xlsx, csv or tsv)")
+	outFlag := fs.String("out", "", "Output directory for the summary (default: -dir)")
+	widthFlag := fs.Bool("width", true, "Also treat full-width/half-width forms as variants")
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+
+	if *glossaryFlag == "" {
+		fmt.Println("Error: -glossary is required")
+		return ExitError
+	}
+	terms, err := glossary.Load(*glossaryFlag, *widthFlag)
+	if err != nil {
+		fmt.Printf("Error loading glossary: %v\n", err)
+		return ExitError
+	}
+
+	files, err := selectFiles(*dirFlag, filter, *filesFromFlag, os.Stdout)
+	if err != nil {
+		fmt.Printf("Error scanning files: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("Auditing %d Excel files against %d terms...\n", len(files), len(terms))
+
+	res, err := glossary.Audit(files, terms, func(current, total int, path string, workerCounts map[int]int) {
+		fmt.Printf("\r(%d/%d) %s                                        ", current, total, filepath.Base(path))
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Error auditing files: %v\n", err)
+		return ExitError
+	}
+
+	outDir := *outFlag
+	if outDir == "" {
+		outDir = *dirFlag
+	}
+	reportPath, err := res.WriteReport(outDir, *formatFlag)
+	if err != nil {
+		fmt.Printf("Error writing summary: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("Summary generated: %s\n", reportPath)
+
+	found := res.FoundVariants()
+	if len(found) == 0 {
+		fmt.Println("No variants found.")
+		return ExitOK
+	}
+	fmt.Println("Variants found:")
+	for _, t := range found {
+		for _, v := range t.Variants {
+			fmt.Printf("  %s → %s: %d\n", v, t.Canonical, res.Total(v))
+		}
+	}
+	dictPath, err := res.WriteDictionary(outDir)
+	if err != nil {
+		fmt.Printf("Error writing dictionary: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("Normalize dictionary generated: %s\n", dictPath)
+	fmt.Println("Delete the rows you want to keep as-is, then run with -dict to normalize.")
+	return ExitOK
+}
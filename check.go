@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"excel_converter/lint"
+)
+
+// runCheck implements the "check" command: a search-only lint of every workbook
+// under -dir against a rules file of forbidden terms. It never prompts, so it can
+// be used from scripts and CI.
+//
+// Exit codes: ExitOK = no error-level violations, ExitHitsFound = error-level
+// violations found, ExitPartialFailure = some files could not be read,
+// ExitError = invalid arguments or the check could not run.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	rulesFlag := fs.String("rules", "", "Rules file (CSV/TSV/XLSX): pattern, type, severity, message")
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+
+	if *rulesFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -rules is required")
+		return ExitError
+	}
+	rules, err := lint.LoadRules(*rulesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading rules: %v\n", err)
+		return ExitError
+	}
+
+	files, err := selectFiles(*dirFlag, filter, *filesFromFlag, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning files: %v\n", err)
+		return ExitError
+	}
+
+	violations, fileErrors, err := lint.Check(files, rules, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking files: %v\n", err)
+		return ExitError
+	}
+
+	counts := make(map[string]int)
+	for _, v := range violations {
+		fmt.Println(v.String())
+		counts[v.Rule.Severity]++
+	}
+	for _, fe := range fileErrors {
+		fmt.Printf("%s: error: could not read file: %v\n", fe.Path, fe.Err)
+	}
+	fmt.Fprintf(os.Stderr, "%d files checked: %d errors, %d warnings, %d info, %d unreadable files\n",
+		len(files), counts[lint.SeverityError], counts[lint.SeverityWarning], counts[lint.SeverityInfo], len(fileErrors))
+
+	switch {
+	case lint.HasErrors(violations):
+		return ExitHitsFound
+	case len(fileErrors) > 0:
+		return ExitPartialFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"excel_converter/excel"
+	"excel_converter/index"
+	"excel_converter/replacer"
+	"excel_converter/report"
+	"excel_converter/server"
+	"excel_converter/utils"
+)
+
+// Exit codes shared by all commands.
+const (
+	ExitOK             = 0 // Success (no hits in search mode)
+	ExitHitsFound      = 1 // Search/check found matches
+	ExitError          = 2 // Invalid arguments or the run could not start
+	ExitPartialFailure = 3 // Some files could not be processed or saved
+)
+
+const usage = `Usage:
+  excel_converter                          Interactive mode (double-click)
+  excel_converter search  -search TEXT [-dir DIR] [-format csv|tsv|xlsx|html|json|jsonl]
+  excel_converter search  -search TEXT -grep [-context header,row] [-template T] [-color auto]
+  excel_converter replace -search TEXT (-replace TEXT | -replace-with-empty) [-yes] [-backup-dir DIR] [style flags] [-note-old] [-change-log]
+  excel_converter replace -dict FILE [-yes] [-backup-dir DIR]
+  excel_converter highlight -search TEXT [style flags] [-yes]
+  excel_converter clear-highlights [-dir DIR] [-yes] [-backup-dir DIR]
+  excel_converter clear-notes [-dir DIR] [-yes] [-backup-dir DIR]
+  excel_converter files   [-dir DIR] [file selection flags]
+  excel_converter run     [-yes] [-only NAME] job.json
+  excel_converter index   build|status|prune [-dir DIR] [-index-file FILE]
+  excel_converter restore -backup-dir DIR [-dir DIR] [-yes]
+  excel_converter serve   [-port 8080]
+  excel_converter check   -rules FILE [-dir DIR]
+  excel_converter watch   -rules FILE [-dir DIR] [-log FILE] [-port 8080] [-poll]
+  excel_converter audit   -glossary FILE [-dir DIR] [-format xlsx|csv|tsv]
+
+File selection flags (search, replace, highlight, clear-highlights, clear-notes, files, check, watch, audit):
+  -include GLOB  -exclude GLOB  -exclude-dir DIR  -exclude-ext .xlsm  -no-ignore-file
+  -max-depth N  -min-size 10KB  -max-size 50MB  -modified-since 2026-01-01
+  -modified-before 2026-10-01  -follow-symlinks
+  -files-from FILE|-   Use an explicit list of workbooks (newline or NUL separated) instead of -dir
+
+Style flags (replace: bold 2980C4, highlight: fill FFFF00 unless given; clear-highlights restores):
+  -font-color RRGGBB  -fill RRGGBB  -bold  -italic  -underline  -comment TEXT  -no-style
+
+Exit codes: 0 = success, 1 = hits found, 2 = error, 3 = partial failure
+`
+
+// printBanner prints the version line. With the JSON formats stdout is
+// reserved for the run summary, so it goes to stderr.
+func printBanner(format string) {
+	if format == "json" || format == "jsonl" {
+		fmt.Fprintf(os.Stderr, "Excel Converter v%s\n", Version)
+		return
+	}
+	fmt.Printf("Excel Converter v%s\n", Version)
+}
+
+// reportFlags are the report location and encoding flags of search and replace.
+type reportFlags struct {
+	dir, name, encoding, fallback *string
+	allowFormulas, perOccurrence  *bool
+	verbose                       *bool
+}
+
+func addReportFlags(fs *flag.FlagSet) reportFlags {
+	return reportFlags{
+		dir:      fs.String("report-dir", "", "Directory of the report (default: -dir)"),
+		name:     fs.String("report-name", "", "Report file name template ({timestamp} {date} {time} {mode} {ext}; default "+report.DefaultNameTemplate+")"),
+		encoding: fs.String("encoding", "", "CSV/TSV encoding: cp932 (default), shift-jis, utf-8-bom, utf-8 or utf-16le"),
+		fallback: fs.String("fallback", "", "Replacement for characters Shift-JIS can't encode: text (default ?), codepoint or error"),
+
+		perOccurrence: fs.Bool("per-occurrence", false, "Write one report row per match instead of one per cell"),
+		allowFormulas: fs.Bool("allow-formulas", false, "Write CSV/TSV values starting with = + - @ as is (by default they get a leading ')"),
+		verbose:       fs.Bool("verbose", false, "Also list hits in rows whose -where condition is false as \"Skipped (condition)\""),
+	}
+}
+
+// apply copies the flags into cfg after fs.Parse.
+func (f reportFlags) apply(cfg *runConfig) error {
+	if _, err := report.ParseEncoding(*f.encoding); err != nil {
+		return err
+	}
+	cfg.ReportDir = *f.dir
+	cfg.ReportName = *f.name
+	cfg.Encoding = *f.encoding
+	cfg.Fallback = *f.fallback
+	cfg.AllowFormulas = *f.allowFormulas
+	cfg.PerOccurrence = *f.perOccurrence
+	cfg.Verbose = *f.verbose
+	return nil
+}
+
+// runCommand dispatches a subcommand. Subcommands never pause and only prompt
+// for confirmation when attached to a terminal and -yes is not given.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "search":
+		return runSearch(args)
+	case "replace":
+		return runReplace(args)
+	case "highlight":
+		return runHighlight(args)
+	case "clear-highlights":
+		return runClearHighlights(args)
+	case "clear-notes":
+		return runClearNotes(args)
+	case "restore":
+		return runRestore(args)
+	case "serve":
+		return runServe(args)
+	case "run":
+		return runJobs(args)
+	case "files":
+		return runFiles(args)
+	case "index":
+		return runIndex(args)
+	case "check":
+		// Output is meant to be parsed, so no banner
+		return runCheck(args)
+	case "watch":
+		return runWatch(args)
+	case "audit":
+		fmt.Printf("Excel Converter v%s\n", Version)
+		return runAudit(args)
+	case "version":
+		fmt.Println(Version)
+		return ExitOK
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return ExitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, usage)
+		return ExitError
+	}
+}
+
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	searchFlag := fs.String("search", "", "Text to search for")
+	dictFlag := fs.String("dict", "", "Dictionary file (CSV/TSV/XLSX); all search terms are searched at once")
+	formatFlag := fs.String("format", "csv", "Output format (csv, tsv, xlsx, html, json or jsonl; json/jsonl also print the summary to stdout)")
+	grepFlag := fs.Bool("grep", false, "Print each hit as 'path(sheet!cell): text' instead of writing a report")
+	templateFlag := fs.String("template", report.DefaultGrepTemplate, "Line template for -grep ({path} {file} {sheet} {cell} {text} {header} {row} ...)")
+	colorFlag := fs.String("color", "auto", "Highlight matches in -grep output (auto, always or never)")
+	contextFlag := fs.String("context", "", "Context for -grep: header, row or header,row")
+	reportFlag := fs.Bool("report", false, "With -grep, also write the report file")
+	previewFlag := fs.Bool("preview", false, "List the selected files before processing")
+	reportOpts := addReportFlags(fs)
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	scopeFlags := addScopeFlags(fs)
+	indexFlag := fs.Bool("index", false, "Answer from the index, reopening only changed files (see 'index build')")
+	indexFileFlag := fs.String("index-file", "", "Index file (default: DIR/"+index.DefaultName+")")
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	scope, err := scopeFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+
+	if *searchFlag == "" && *dictFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -search or -dict is required")
+		return ExitError
+	}
+	cfg := runConfig{
+		Dir:        *dirFlag,
+		Search:     *searchFlag,
+		DictPath:   *dictFlag,
+		Format:     *formatFlag,
+		SearchOnly: true,
+		Filter:     filter,
+		FileList:   *filesFromFlag,
+		Preview:    *previewFlag,
+		Scope:      scope,
+	}
+	if err := reportOpts.apply(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if *indexFlag || *indexFileFlag != "" {
+		cfg.IndexPath = indexPath(*dirFlag, *indexFileFlag)
+	}
+	for _, c := range strings.Split(*contextFlag, ",") {
+		switch strings.TrimSpace(c) {
+		case "":
+		case "header":
+			cfg.Header = true
+		case "row":
+			cfg.RowContext = true
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown context %q\n", c)
+			return ExitError
+		}
+	}
+	if *grepFlag {
+		template := *templateFlag
+		// Add the requested context to the default template
+		if template == report.DefaultGrepTemplate {
+			if cfg.Header {
+				template += "  [{header}]"
+			}
+			if cfg.RowContext {
+				template += "  << {row} >>"
+			}
+		}
+		cfg.Grep = &report.GrepFormatter{Template: template, Color: report.UseColor(os.Stdout, *colorFlag)}
+		cfg.NoReport = !*reportFlag
+	} else {
+		printBanner(cfg.Format)
+	}
+	return execute(cfg)
+}
+
+func runReplace(args []string) int {
+	fs := flag.NewFlagSet("replace", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	searchFlag := fs.String("search", "", "Text to search for")
+	replaceFlag := fs.String("replace", "", "Text to replace with")
+	replaceEmptyFlag := fs.Bool("replace-with-empty", false, "Replace matches with an empty string (delete them)")
+	dictFlag := fs.String("dict", "", "Dictionary file (CSV/TSV/XLSX) of search/replace pairs applied in one pass")
+	formatFlag := fs.String("format", "csv", "Output format (csv, tsv, xlsx, html, json or jsonl; json/jsonl also print the summary to stdout)")
+	backupFlag := fs.String("backup-dir", "", "Copy each file here before overwriting it (restore with 'restore')")
+	yesFlag := fs.Bool("yes", false, "Do not ask for confirmation")
+	previewFlag := fs.Bool("preview", false, "List the selected files before asking for confirmation")
+	reportOpts := addReportFlags(fs)
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	scopeFlags := addScopeFlags(fs)
+	indexFlag := fs.Bool("index", false, "Use the index to skip files without matches (matches are re-verified in the live files)")
+	indexFileFlag := fs.String("index-file", "", "Index file (default: DIR/"+index.DefaultName+")")
+	limitFlag := fs.Int("limit", 0, "Replace only the first N occurrences per -limit-scope; the rest are reported as skipped")
+	nthFlag := fs.Int("nth", 0, "Replace only the Nth occurrence per -limit-scope")
+	limitScopeFlag := fs.String("limit-scope", replacer.ScopeCell, "Where -limit and -nth count: cell, sheet or file")
+	limitUnitFlag := fs.String("limit-unit", replacer.UnitOccurrence, "What -limit and -nth count: occurrence, or cell (cells with a match; all their occurrences are replaced)")
+	styleFlags := addHighlightFlags(fs, excel.DefaultReplaceStyle)
+	noteOldFlag := fs.Bool("note-old", false, "Add a note '旧: <previous value> (date run ID)' to each replaced cell (remove with 'clear-notes')")
+	changeLogFlag := fs.Bool("change-log", false, "List the replaced cells on a change log sheet in each workbook (rows are added on later runs)")
+	changeLogSheetFlag := fs.String("change-log-sheet", excel.DefaultChangeLogSheet, "Name of the change log sheet")
+	operatorFlag := fs.String("operator", "", "Operator recorded in the change log (default: the current user)")
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	scope, err := scopeFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	style, err := styleFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	limit := replacer.Limit{First: *limitFlag, Nth: *nthFlag, Scope: *limitScopeFlag, Unit: *limitUnitFlag}
+	if err := limit.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if *changeLogFlag {
+		if err := excel.ValidateSheetName(*changeLogSheetFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -change-log-sheet: %v\n", err)
+			return ExitError
+		}
+	}
+
+	switch {
+	case *dictFlag != "":
+		if *searchFlag != "" {
+			fmt.Fprintln(os.Stderr, "Error: -dict and -search can not be combined")
+			return ExitError
+		}
+		if *replaceFlag != "" || *replaceEmptyFlag {
+			fmt.Fprintln(os.Stderr, "Error: -dict can not be combined with -replace or -replace-with-empty (the replacements come from the dictionary)")
+			return ExitError
+		}
+	case *searchFlag == "":
+		fmt.Fprintln(os.Stderr, "Error: -search or -dict is required")
+		return ExitError
+	case *replaceFlag == "" && !*replaceEmptyFlag:
+		fmt.Fprintln(os.Stderr, "Error: -replace is required (use -replace-with-empty to delete the matches)")
+		return ExitError
+	case *replaceFlag != "" && *replaceEmptyFlag:
+		fmt.Fprintln(os.Stderr, "Error: -replace and -replace-with-empty can not be combined")
+		return ExitError
+	}
+
+	printBanner(*formatFlag)
+	cfg := runConfig{
+		Dir:       *dirFlag,
+		Search:    *searchFlag,
+		Replace:   *replaceFlag,
+		DictPath:  *dictFlag,
+		Format:    *formatFlag,
+		BackupDir: *backupFlag,
+		Filter:    filter,
+		FileList:  *filesFromFlag,
+		Preview:   *previewFlag,
+		Limit:     limit,
+		Scope:     scope,
+		Style:     style,
+		NoteOld:   *noteOldFlag,
+		Operator:  *operatorFlag,
+	}
+	if *changeLogFlag {
+		cfg.ChangeLog = *changeLogSheetFlag
+	}
+	if err := reportOpts.apply(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if *indexFlag || *indexFileFlag != "" {
+		cfg.IndexPath = indexPath(*dirFlag, *indexFileFlag)
+	}
+	if !*yesFlag {
+		cfg.Confirm = func(files int) bool {
+			return confirm(fmt.Sprintf("%d files may be overwritten. Continue?", files))
+		}
+	}
+	return execute(cfg)
+}
+
+// runFiles prints the files selected by the file selection flags, one per line.
+func runFiles(args []string) int {
+	fs := flag.NewFlagSet("files", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	files, err := selectFiles(*dirFlag, filter, *filesFromFlag, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning files: %v\n", err)
+		return ExitError
+	}
+	for _, path := range files {
+		fmt.Println(path)
+	}
+	fmt.Fprintf(os.Stderr, "%d files\n", len(files))
+	return ExitOK
+}
+
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	backupFlag := fs.String("backup-dir", "", "Backup directory created by 'replace -backup-dir'")
+	dirFlag := fs.String("dir", ".", "Directory the backup was taken from")
+	yesFlag := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Parse(args)
+
+	if *backupFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -backup-dir is required")
+		return ExitError
+	}
+	if !*yesFlag && !confirm(fmt.Sprintf("Overwrite files in %s with the backup in %s?", *dirFlag, *backupFlag)) {
+		fmt.Println("Cancelled.")
+		return ExitError
+	}
+
+	restored, err := utils.RestoreBackups(*backupFlag, *dirFlag)
+	for _, path := range restored {
+		fmt.Printf("Restored: %s\n", path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring backup: %v\n", err)
+		if len(restored) > 0 {
+			return ExitPartialFailure
+		}
+		return ExitError
+	}
+	fmt.Printf("%d files restored.\n", len(restored))
+	return ExitOK
+}
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	portFlag := fs.String("port", "8080", "Port for Web Server")
+	fs.Parse(args)
+
+	fmt.Printf("Excel Converter v%s\n", Version)
+	if err := server.StartServer(*portFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// confirm asks a yes/no question. Without a terminal it never blocks and answers no.
+// The question goes to stderr, so that stdout only carries the output (e.g. the
+// JSON summary).
+func confirm(question string) bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "Not a terminal: use -yes to confirm.")
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
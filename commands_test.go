@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func cellValue(t *testing.T, path, cell string) string {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	v, _ := f.GetCellValue("Sheet1", cell)
+	return v
+}
+
+// TestExitCodes_BackupRestore runs replace twice with the same backup
+// directory and then restores the backup.
+func TestExitCodes_BackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(t.TempDir(), "backup")
+	reports := t.TempDir()
+	path := filepath.Join(dir, "a.xlsx")
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "旧仕様")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	replace := func(search, repl string) int {
+		return runReplace([]string{"-dir", dir, "-search", search, "-replace", repl, "-yes", "-backup-dir", backup, "-report-dir", reports})
+	}
+	if code := replace("旧", "新"); code != ExitOK {
+		t.Fatalf("replace: exit code %d, want %d", code, ExitOK)
+	}
+	// The backup of the first run is kept, so the file is not changed
+	if code := replace("新", "次"); code != ExitPartialFailure {
+		t.Errorf("replace with an existing backup: exit code %d, want %d", code, ExitPartialFailure)
+	}
+	if got := cellValue(t, path, "A1"); got != "新仕様" {
+		t.Errorf("A1 = %q after the refused run", got)
+	}
+
+	if code := runRestore([]string{"-dir", dir}); code != ExitError {
+		t.Errorf("restore without -backup-dir: exit code %d, want %d", code, ExitError)
+	}
+	if code := runRestore([]string{"-backup-dir", backup, "-dir", dir, "-yes"}); code != ExitOK {
+		t.Errorf("restore: exit code %d, want %d", code, ExitOK)
+	}
+	if got := cellValue(t, path, "A1"); got != "旧仕様" {
+		t.Errorf("A1 = %q after restore", got)
+	}
+
+	if code := runRestore([]string{"-backup-dir", filepath.Join(backup, "missing"), "-dir", dir, "-yes"}); code != ExitError {
+		t.Errorf("restore of a missing backup: exit code %d, want %d", code, ExitError)
+	}
+}
+
+// TestRunJobs_JSONStdout checks that a job file with a json job prints only
+// JSON to stdout: the summary of that job and the combined summary.
+func TestRunJobs_JSONStdout(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "旧仕様")
+	if err := f.SaveAs(filepath.Join(dir, "a.xlsx")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	jobPath := filepath.Join(t.TempDir(), "jobs.json")
+	content := fmt.Sprintf(`{"jobs": [
+  {"name": "text", "root": %q, "mode": "search", "search": "旧", "report": {"dir": %q}},
+  {"name": "json", "root": %q, "mode": "search", "search": "旧", "report": {"format": "json", "dir": %q}}
+]}`, dir, t.TempDir(), dir, t.TempDir())
+	if err := os.WriteFile(jobPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := runJobs([]string{jobPath})
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if code != ExitHitsFound {
+		t.Errorf("exit code %d, want %d", code, ExitHitsFound)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var types []string
+	for _, line := range lines {
+		var rec struct {
+			Type string `json:"type"`
+			Hits int    `json:"hits"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("stdout line is not JSON: %q", line)
+		}
+		types = append(types, rec.Type)
+		if rec.Type == "combined" && rec.Hits != 2 {
+			t.Errorf("combined hits = %d, want 2", rec.Hits)
+		}
+	}
+	if strings.Join(types, " ") != "summary combined" {
+		t.Errorf("stdout records %v, want the json job's summary and the combined summary", types)
+	}
+}
@@ -0,0 +1,211 @@
+package excel
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"excel_converter/report"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// DefaultChangeLogSheet is the name of the change log sheet when none is given.
+const DefaultChangeLogSheet = "変更ログ"
+
+// ChangeLogProperty is the custom document property that lists the change
+// log sheets of a workbook, one per line. Runs that modify the workbook leave
+// these sheets alone, so logged values are never replaced or highlighted.
+const ChangeLogProperty = "ExcelConverterChangeLog"
+
+// changeLogTable is the name of the table on the change log sheet; a number is
+// added when another sheet already has a table of that name.
+const changeLogTable = "ExcelConverterChangeLog"
+
+// changeLogHeader and changeLogWidths are the columns of the change log sheet.
+var (
+	changeLogHeader = []string{"Sheet", "Cell", "Old Value", "New Value", "Date", "Run ID", "Operator"}
+	changeLogWidths = []float64{18, 10, 50, 50, 20, 18, 16}
+)
+
+// ValidateSheetName checks a sheet name against Excel's rules: 1 to 31
+// characters, none of : \ / ? * [ ], and no apostrophe at either end.
+func ValidateSheetName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("sheet name is empty")
+	case utf8.RuneCountInString(name) > 31:
+		return fmt.Errorf("sheet name %q is longer than 31 characters", name)
+	case strings.ContainsAny(name, `:\/?*[]`):
+		return fmt.Errorf("sheet name %q contains one of : \\ / ? * [ ]", name)
+	case strings.HasPrefix(name, "'") || strings.HasSuffix(name, "'"):
+		return fmt.Errorf("sheet name %q starts or ends with an apostrophe", name)
+	}
+	return nil
+}
+
+// changeLogSheets returns the change log sheets recorded in the workbook.
+func changeLogSheets(f *excelize.File) ([]string, error) {
+	value, err := GetCustomProperty(f, ChangeLogProperty)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	return strings.Split(value, "\n"), nil
+}
+
+// checkChangeLogSheet refuses a change log sheet that exists in the workbook
+// but is not one of its recorded change log sheets: the sheet would be left
+// out of the replacement and the log appended to its data.
+func checkChangeLogSheet(f *excelize.File, sheet string, recorded []string) error {
+	if !hasSheet(f, sheet) || containsSheet(recorded, sheet) {
+		return nil
+	}
+	return fmt.Errorf("sheet %s already exists and is not a change log (choose another change log sheet)", sheet)
+}
+
+// containsSheet reports whether sheets has the sheet. Like Excel, it ignores
+// letter case.
+func containsSheet(sheets []string, sheet string) bool {
+	for _, s := range sheets {
+		if strings.EqualFold(s, sheet) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeChangeLog appends the successful changes to the change log sheet,
+// creating the sheet on the first run. Earlier rows are kept, and the table
+// is extended over the new rows.
+func writeChangeLog(f *excelize.File, sheet string, changes []report.Change, run Run, operator string) error {
+	date := run.Started.Format("2006-01-02 15:04:05")
+	var records [][]interface{}
+	for _, c := range changes {
+		if c.Status == "Success" {
+			records = append(records, []interface{}{c.Sheet, c.Cell, c.OldValue, c.NewValue, date, run.ID, operator})
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	next := 1
+	if hasSheet(f, sheet) {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return err
+		}
+		next = len(rows) + 1
+	} else if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	if next == 1 {
+		if err := f.SetSheetRow(sheet, "A1", &changeLogHeader); err != nil {
+			return err
+		}
+		for i, width := range changeLogWidths {
+			col, _ := excelize.ColumnNumberToName(i + 1)
+			f.SetColWidth(sheet, col, col, width)
+		}
+		if err := f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+			return err
+		}
+		next = 2
+	}
+	// Values are written as text, so logged formulas are never evaluated
+	for i, record := range records {
+		cell, _ := excelize.CoordinatesToCellName(1, next+i)
+		if err := f.SetSheetRow(sheet, cell, &record); err != nil {
+			return err
+		}
+	}
+
+	last, _ := excelize.CoordinatesToCellName(len(changeLogHeader), next+len(records)-1)
+	if err := setChangeLogTable(f, sheet, "A1:"+last); err != nil {
+		return err
+	}
+	return recordChangeLogSheet(f, sheet)
+}
+
+// setChangeLogTable formats ref as a table, or extends the table added by an
+// earlier run. excelize can not resize tables, so the range of the table part
+// is rewritten directly.
+func setChangeLogTable(f *excelize.File, sheet, ref string) error {
+	tables, err := f.GetTables(sheet)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if strings.HasPrefix(t.Name, changeLogTable) {
+			return resizeTable(f, t.Name, t.Range, ref)
+		}
+	}
+	name := changeLogTable
+	for i := 2; tableExists(f, name); i++ {
+		name = fmt.Sprintf("%s%d", changeLogTable, i)
+	}
+	stripes := true
+	return f.AddTable(sheet, &excelize.Table{Range: ref, Name: name, StyleName: "TableStyleMedium2", ShowRowStripes: &stripes})
+}
+
+// tableParts calls fn with the package path and the name of every table in
+// the workbook until fn returns false.
+func tableParts(f *excelize.File, fn func(part, name string, data []byte) bool) {
+	f.Pkg.Range(func(k, v interface{}) bool {
+		part := k.(string)
+		if !strings.HasPrefix(part, "xl/tables/table") {
+			return true
+		}
+		var t struct {
+			Name string `xml:"name,attr"`
+		}
+		data := v.([]byte)
+		if xml.Unmarshal(data, &t) != nil {
+			return true
+		}
+		return fn(part, t.Name, data)
+	})
+}
+
+func tableExists(f *excelize.File, name string) bool {
+	found := false
+	tableParts(f, func(_, n string, _ []byte) bool {
+		found = n == name
+		return !found
+	})
+	return found
+}
+
+// resizeTable changes the range of the table and of its auto filter.
+func resizeTable(f *excelize.File, name, from, to string) error {
+	if from == to {
+		return nil
+	}
+	resized := false
+	tableParts(f, func(part, n string, data []byte) bool {
+		if n != name {
+			return true
+		}
+		content := strings.ReplaceAll(string(data), `ref="`+from+`"`, `ref="`+to+`"`)
+		f.Pkg.Store(part, []byte(content))
+		resized = true
+		return false
+	})
+	if !resized {
+		return fmt.Errorf("table %s not found", name)
+	}
+	return nil
+}
+
+// recordChangeLogSheet adds sheet to ChangeLogProperty.
+func recordChangeLogSheet(f *excelize.File, sheet string) error {
+	sheets, err := changeLogSheets(f)
+	if err != nil {
+		return err
+	}
+	if containsSheet(sheets, sheet) {
+		return nil
+	}
+	return SetCustomProperty(f, ChangeLogProperty, strings.Join(append(sheets, sheet), "\n"))
+}
@@ -0,0 +1,182 @@
+package excel
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Condition is a row condition such as `B == "完了"`. The left side is a
+// column letter, a header text in brackets ([ステータス]) or "row" for any cell
+// of the row. Operators:
+//
+//	==  !=              the trimmed cell value equals (does not equal) the text
+//	=~  !~              the cell value matches (does not match) the regular expression
+//	contains  !contains the cell value contains (does not contain) the text
+//
+// With "row" the positive operators hold if any cell of the row satisfies
+// them, and the negated ones if no cell does.
+type Condition struct {
+	expr   string
+	col    int    // 1-based column; 0 for header and row conditions
+	header string // Header text of the column
+	row    bool
+	op     string // Positive operator: "==", "=~" or "contains"
+	negate bool
+	value  string
+	re     *regexp.Regexp
+}
+
+// ParseConditions parses row conditions; all of them must hold for a row.
+func ParseConditions(exprs []string) ([]*Condition, error) {
+	var conds []*Condition
+	for _, e := range exprs {
+		c, err := ParseCondition(e)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+// ParseCondition parses one row condition.
+func ParseCondition(expr string) (*Condition, error) {
+	c := &Condition{expr: strings.TrimSpace(expr)}
+	s := c.expr
+	fail := func(format string, a ...interface{}) (*Condition, error) {
+		return nil, fmt.Errorf("condition %q: %s", expr, fmt.Sprintf(format, a...))
+	}
+
+	// Left side
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return fail("missing ]")
+		}
+		c.header = normalizeHeader(s[1:end])
+		if c.header == "" {
+			return fail("empty header")
+		}
+		s = s[end+1:]
+	default:
+		i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+		if i < 0 {
+			i = len(s)
+		}
+		name := s[:i]
+		s = s[i:]
+		if strings.EqualFold(name, "row") {
+			c.row = true
+			break
+		}
+		col, err := excelize.ColumnNameToNumber(name)
+		if err != nil || name == "" {
+			return fail("expected a column letter, [header] or row")
+		}
+		c.col = col
+	}
+
+	// Operator
+	s = strings.TrimSpace(s)
+	for _, op := range []string{"==", "!=", "=~", "!~", "!contains", "contains"} {
+		if strings.HasPrefix(s, op) {
+			c.op, c.negate = op, strings.HasPrefix(op, "!")
+			s = s[len(op):]
+			break
+		}
+	}
+	switch c.op {
+	case "":
+		return fail("expected ==, !=, =~, !~, contains or !contains")
+	case "!=":
+		c.op = "=="
+	case "!~":
+		c.op = "=~"
+	case "!contains":
+		c.op = "contains"
+	}
+
+	// Value: a quoted string or the rest of the expression
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return fail("invalid quoted text")
+		}
+		s = v
+	}
+	c.value = s
+	if c.op == "=~" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return fail("%v", err)
+		}
+		c.re = re
+	}
+	return c, nil
+}
+
+// String returns the condition as written.
+func (c *Condition) String() string {
+	return c.expr
+}
+
+// Eval reports whether the condition holds for a row (as returned by
+// GetRows); headers are the header texts by column, used by [header] conditions.
+// A column that does not exist has the value "", but a [header] condition
+// whose header is not in headers never holds (see SheetLayout.Unresolved).
+func (c *Condition) Eval(row, headers []string) bool {
+	if c.row {
+		for _, v := range row {
+			if c.test(v) {
+				return !c.negate
+			}
+		}
+		return c.negate
+	}
+	col := c.col
+	if c.header != "" {
+		col = 0
+		for i, h := range headers {
+			if normalizeHeader(h) == c.header {
+				col = i + 1
+				break
+			}
+		}
+		if col == 0 {
+			return false
+		}
+	}
+	v := ""
+	if col > 0 && col <= len(row) {
+		v = row[col-1]
+	}
+	return c.test(v) != c.negate
+}
+
+func (c *Condition) test(v string) bool {
+	switch c.op {
+	case "==":
+		return strings.TrimSpace(v) == c.value
+	case "=~":
+		return c.re.MatchString(v)
+	}
+	return strings.Contains(v, c.value)
+}
+
+// failedCondition returns the first condition of the scope that does not hold
+// for the row, or nil.
+func (f *ScopeFilter) failedCondition(row, headers []string) *Condition {
+	for _, c := range f.conditions {
+		if !c.Eval(row, headers) {
+			return c
+		}
+	}
+	return nil
+}
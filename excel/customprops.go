@@ -0,0 +1,144 @@
+package excel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// maxPropertyLength is the longest text value Excel shows and keeps in a
+	// custom document property (File > Info > Properties > Advanced); longer
+	// values are stored in numbered properties ("name.2", "name.3", ...).
+	maxPropertyLength = 255
+
+	// maxRecordLength limits the encoded size of a record, so that a large run
+	// does not make every workbook much larger (and slow to open).
+	maxRecordLength = 64 * 1024
+)
+
+// errRecordTooLarge is returned by saveRecord for a record longer than
+// maxRecordLength.
+var errRecordTooLarge = errors.New("the record is too large for the document properties")
+
+// GetCustomProperty returns the text of a custom document property, or "" if
+// the workbook does not have it. Values split over numbered properties by
+// SetCustomProperty are joined again.
+func GetCustomProperty(f *excelize.File, name string) (string, error) {
+	props, err := f.GetCustomProps()
+	if err != nil {
+		return "", err
+	}
+	byName := make(map[string]string)
+	for _, p := range props {
+		if text, ok := p.Value.(string); ok {
+			byName[p.Name] = text
+		}
+	}
+	var value strings.Builder
+	for i := 1; ; i++ {
+		part, ok := byName[chunkName(name, i)]
+		if !ok {
+			break
+		}
+		value.WriteString(part)
+	}
+	return value.String(), nil
+}
+
+// SetCustomProperty sets a text custom document property; an empty value
+// removes it. Other custom properties are kept.
+func SetCustomProperty(f *excelize.File, name, value string) error {
+	props, err := f.GetCustomProps()
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for i := 1; value != ""; i++ {
+		part := value
+		if runes := []rune(value); len(runes) > maxPropertyLength {
+			part = string(runes[:maxPropertyLength])
+		}
+		value = value[len(part):]
+		written[chunkName(name, i)] = true
+		if err := f.SetCustomProps(excelize.CustomProperty{Name: chunkName(name, i), Value: part}); err != nil {
+			return err
+		}
+	}
+	// Remove the parts of a longer previous value
+	for _, p := range props {
+		if isChunkOf(p.Name, name) && !written[p.Name] {
+			if err := f.SetCustomProps(excelize.CustomProperty{Name: p.Name}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chunkName returns the name of the i-th (1-based) part of a property value.
+func chunkName(name string, i int) string {
+	if i == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+func isChunkOf(prop, name string) bool {
+	if prop == name {
+		return true
+	}
+	n, ok := strings.CutPrefix(prop, name+".")
+	return ok && n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// loadRecord decodes a record stored by saveRecord in the property name into
+// v. It reports whether the workbook has the record.
+func loadRecord(f *excelize.File, name string, v interface{}) (bool, error) {
+	value, err := GetCustomProperty(f, name)
+	if err != nil || value == "" {
+		return false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", name, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", name, err)
+	}
+	if data, err = io.ReadAll(zr); err != nil {
+		return true, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("%s: %w", name, err)
+	}
+	return true, nil
+}
+
+// saveRecord stores v in the property name as JSON, compressed because
+// custom properties are short.
+func saveRecord(f *excelize.File, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	value := base64.StdEncoding.EncodeToString(buf.Bytes())
+	if len(value) > maxRecordLength {
+		return fmt.Errorf("%s: %w (%d KB, at most %d KB)", name, errRecordTooLarge, len(value)/1024, maxRecordLength/1024)
+	}
+	return SetCustomProperty(f, name, value)
+}
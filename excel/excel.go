@@ -2,17 +2,67 @@ package excel
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"excel_converter/replacer"
 	"excel_converter/report"
 	"excel_converter/utils"
 
 	"github.com/xuri/excelize/v2"
 )
 
+// Options controls how ProcessFileWithOptions searches and replaces.
+type Options struct {
+	Replacer   *replacer.Replacer // Search/replace rules applied to every cell
+	SearchOnly bool               // Only record hits; never modify the file
+	Log        io.Writer          // Destination for warnings and errors (default: os.Stdout)
+	BackupDir  string             // If set, the original file is copied here before it is overwritten
+	BaseDir    string             // Root used to mirror the relative path inside BackupDir
+	Header     bool               // Record the column header of each hit (always done when Scope.Columns is set)
+	RowContext bool               // Record the other cells of the row of each hit
+	Limit      replacer.Limit     // Replace only some occurrences; the others are reported as "Skipped (limit)"
+	Scope      Scope              // Sheets and cells to process; the others are not touched
+	Verbose    bool               // Also record hits in rows whose Scope.Conditions are false ("Skipped (condition)")
+	Highlight  *Highlight         // Mark hits with this style instead of replacing them ("Highlighted")
+	Style      *Highlight         // Style of replaced cells (nil = DefaultReplaceStyle; an empty style changes nothing)
+	NoteOld    bool               // Add a note with the previous value to replaced cells (see Run.OldValueNote)
+	Run        Run                // The run named in the notes and the change log (default: NewRun(time.Now()))
+	ChangeLog  string             // Append the replaced cells to this sheet (see writeChangeLog); "" = no change log
+	Operator   string             // Operator in the change log (default: utils.CurrentUser())
+}
+
+func (o Options) logf(format string, a ...interface{}) {
+	w := o.Log
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, format, a...)
+}
+
 // ProcessFile opens an Excel file, searches for text, replaces it, and styles the cell.
 // If searchOnly is true, it only records the found text without modifying the file.
 func ProcessFile(path, search, replace string, searchOnly bool) ([]report.Change, error) {
+	r, err := replacer.NewSingle(search, replace)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessFileWithOptions(path, Options{Replacer: r, SearchOnly: searchOnly})
+}
+
+// ProcessFileWithOptions opens an Excel file and applies all rules of opts.Replacer
+// to every cell in a single pass, styling the replaced cells.
+func ProcessFileWithOptions(path string, opts Options) ([]report.Change, error) {
+	searchOnly := opts.SearchOnly
+	highlighting := opts.Highlight != nil && !searchOnly
+	replacing := !searchOnly && !highlighting
+	scope, err := opts.Scope.Filter()
+	if err != nil {
+		return nil, err
+	}
 	// Use extended path for opening to support long paths
 	extendedPath := utils.ToExtendedPath(path)
 	f, err := excelize.OpenFile(extendedPath)
@@ -21,41 +71,198 @@ func ProcessFile(path, search, replace string, searchOnly bool) ([]report.Change
 	}
 	defer func() {
 		if err := f.Close(); err != nil {
-			fmt.Printf("Error closing file %s: %v\n", path, err)
+			opts.logf("Error closing file %s: %v\n", path, err)
 		}
 	}()
 
 	var changes []report.Change
 	modified := false
 
-	// Define the style for replaced text (Blue, Bold)
-	// Only needed if not searchOnly, but defining it here is fine.
-	styleID, err := f.NewStyle(&excelize.Style{
-		Font: &excelize.Font{
-			Color: "4180C4", // R41, G128, B196 -> Hex #2980C4 (Approx) or #4180C4?
-			Bold:  true,
-		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create style: %w", err)
+	// Highlighted and replaced cells are styled on top of their existing
+	// style, and recorded so that ClearHighlights can restore them
+	style := DefaultReplaceStyle
+	switch {
+	case highlighting:
+		style = *opts.Highlight
+	case opts.Style != nil:
+		style = *opts.Style
+	}
+	var hl *highlighter
+	if !searchOnly && !style.Empty() {
+		if hl, err = newHighlighter(f, style); err != nil {
+			return nil, err
+		}
+	}
+
+	// Old value notes are recorded so that ClearNotes can remove them
+	var notes *noteRecord
+	if replacing && opts.NoteOld {
+		if notes, err = loadNoteRecord(f); err != nil {
+			return nil, err
+		}
+	}
+	run := opts.Run
+	if run.ID == "" {
+		run = NewRun(time.Now())
+	}
+
+	// Change log sheets are never modified by the rules
+	var logSheets []string
+	if !searchOnly {
+		if logSheets, err = changeLogSheets(f); err != nil {
+			return nil, err
+		}
+		if replacing && opts.ChangeLog != "" {
+			if err := checkChangeLogSheet(f, opts.ChangeLog, logSheets); err != nil {
+				return nil, err
+			}
+			logSheets = append(logSheets, opts.ChangeLog)
+		}
 	}
 
+	// The occurrence limit counts across cells in reading order; a new counter
+	// per file makes "file" the widest scope
+	counter := replacer.NewCounter(opts.Limit)
+	withHeader := opts.Header || len(opts.Scope.Columns) > 0
+
 	// Iterate over all sheets
 	for _, sheetName := range f.GetSheetList() {
+		if !scope.Sheet(sheetName) || containsSheet(logSheets, sheetName) {
+			continue
+		}
+		if opts.Scope.SkipHiddenSheets {
+			if visible, err := f.GetSheetVisible(sheetName); err == nil && !visible {
+				continue
+			}
+		}
 		rows, err := f.GetRows(sheetName)
 		if err != nil {
 			continue // Skip sheets we can't read
 		}
+		layout := scope.Layout(sheetName, rows)
+		if len(layout.Missing) > 0 {
+			skipped := ""
+			if layout.Empty() {
+				skipped = "; the sheet is skipped"
+			}
+			opts.logf("Warning: sheet %s of %s has no column titled %s%s.\n", sheetName, path, strings.Join(layout.Missing, ", "), skipped)
+		}
+		if len(layout.Unresolved) > 0 {
+			opts.logf("Warning: sheet %s of %s has no column titled %s for the conditions; the sheet is skipped.\n", sheetName, path, strings.Join(layout.Unresolved, ", "))
+		}
+		if layout.Empty() {
+			continue
+		}
+		counter.Enter(replacer.ScopeSheet)
+		inRange := scope.Ranges(sheetName)
+		hiddenCols := make(map[int]bool)
 
 		for r, row := range rows {
+			if opts.Scope.SkipHiddenRows {
+				if visible, err := f.GetRowVisible(sheetName, r+1); err == nil && !visible {
+					continue
+				}
+			}
+			failed := scope.failedCondition(row, layout.Headers)
 			for c, colCell := range row {
-				if strings.Contains(colCell, search) {
+				if !inRange(r+1, c+1) || !layout.Contains(r+1, c+1) {
+					continue
+				}
+				if opts.Scope.SkipHiddenColumns {
+					hidden, ok := hiddenCols[c]
+					if !ok {
+						colName, _ := excelize.ColumnNumberToName(c + 1)
+						visible, err := f.GetColVisible(sheetName, colName)
+						hidden = err == nil && !visible
+						hiddenCols[c] = hidden
+					}
+					if hidden {
+						continue
+					}
+				}
+				matches := opts.Replacer.Find(colCell)
+				if len(matches) > 0 && failed != nil {
+					if opts.Verbose {
+						cellName, _ := excelize.CoordinatesToCellName(c+1, r+1)
+						changes = append(changes, report.Change{
+							FilePath: path,
+							Sheet:    sheetName,
+							Cell:     cellName,
+							OldValue: colCell,
+							NewValue: colCell,
+							Status:   "Skipped (condition)",
+							Message:  fmt.Sprintf("condition not met: %s", failed),
+							Entry:    replacer.Labels(matches),
+							Header:   headerIf(withHeader, layout, r+1, c+1),
+							RowText:  rowTextIf(opts.RowContext, row),
+
+							Occurrences: len(matches),
+							Matches:     MatchOffsets(colCell, matches),
+							NewMatches:  MatchOffsets(colCell, matches),
+						})
+					}
+					continue
+				}
+				if len(matches) > 0 && replacing {
+					counter.Enter(replacer.ScopeCell)
+					var skip []replacer.Match
+					matches, skip = counter.Split(matches)
+					if len(skip) > 0 {
+						cellName, _ := excelize.CoordinatesToCellName(c+1, r+1)
+						changes = append(changes, report.Change{
+							FilePath: path,
+							Sheet:    sheetName,
+							Cell:     cellName,
+							OldValue: colCell,
+							NewValue: colCell,
+							Status:   "Skipped (limit)",
+							Message:  fmt.Sprintf("occurrence limit: %s", opts.Limit),
+							Entry:    replacer.Labels(skip),
+							Header:   headerIf(withHeader, layout, r+1, c+1),
+							RowText:  rowTextIf(opts.RowContext, row),
+
+							Occurrences: len(skip),
+							Matches:     MatchOffsets(colCell, skip),
+							NewMatches:  MatchOffsets(colCell, skip),
+						})
+					}
+				}
+				if len(matches) > 0 {
 					// Calculate cell name (e.g., "A1")
 					cellName, _ := excelize.CoordinatesToCellName(c+1, r+1)
+					entry := replacer.Labels(matches)
+					header := headerIf(withHeader, layout, r+1, c+1)
+					rowText := rowTextIf(opts.RowContext, row)
 
 					newValue := colCell
-					if !searchOnly {
-						newValue = strings.ReplaceAll(colCell, search, replace)
+					newMatches := MatchOffsets(colCell, matches)
+					var message string
+					if highlighting {
+						if err := hl.apply(sheetName, cellName); err != nil {
+							changes = append(changes, report.Change{
+								FilePath: path,
+								Sheet:    sheetName,
+								Cell:     cellName,
+								OldValue: colCell,
+								NewValue: colCell,
+								Status:   "Failed",
+								Message:  fmt.Sprintf("Highlight failed: %v", err),
+								Entry:    entry,
+								Header:   header,
+								RowText:  rowText,
+								Error:    "write",
+
+								Occurrences: len(matches),
+								Matches:     newMatches,
+								NewMatches:  newMatches,
+							})
+							continue
+						}
+						modified = true
+					}
+					if replacing {
+						newValue = opts.Replacer.Apply(colCell, matches)
+						newMatches = ReplacedOffsets(colCell, matches)
 
 						// Update cell value
 						if err := f.SetCellValue(sheetName, cellName, newValue); err != nil {
@@ -67,17 +274,40 @@ func ProcessFile(path, search, replace string, searchOnly bool) ([]report.Change
 								NewValue: newValue,
 								Status:   "Failed",
 								Message:  fmt.Sprintf("SetCellValue failed: %v", err),
+								Entry:    entry,
+								Header:   header,
+								RowText:  rowText,
+								Error:    "write",
+
+								Occurrences: len(matches),
+								Matches:     MatchOffsets(colCell, matches),
+								NewMatches:  ReplacedOffsets(colCell, matches),
 							})
 							continue
 						}
 
-						// Apply style
-						f.SetCellStyle(sheetName, cellName, cellName, styleID)
+						// Apply style; the replacement stands even if styling fails
+						if hl != nil {
+							if err := hl.apply(sheetName, cellName); err != nil {
+								message = fmt.Sprintf("Style failed: %v", err)
+							}
+						}
+						if notes != nil {
+							if err := notes.add(f, sheetName, cellName, run.OldValueNote(colCell)); err != nil {
+								if message != "" {
+									message += "; "
+								}
+								message += fmt.Sprintf("Note failed: %v", err)
+							}
+						}
 						modified = true
 					}
 
 					status := "Found"
-					if !searchOnly {
+					switch {
+					case highlighting:
+						status = "Highlighted"
+					case replacing:
 						status = "Success"
 					}
 
@@ -89,6 +319,14 @@ func ProcessFile(path, search, replace string, searchOnly bool) ([]report.Change
 						OldValue: colCell,
 						NewValue: newValue, // In searchOnly, this will be same as OldValue
 						Status:   status,
+						Message:  message,
+						Entry:    entry,
+						Header:   header,
+						RowText:  rowText,
+
+						Occurrences: len(matches),
+						Matches:     MatchOffsets(colCell, matches),
+						NewMatches:  newMatches,
 					})
 				}
 			}
@@ -96,24 +334,106 @@ func ProcessFile(path, search, replace string, searchOnly bool) ([]report.Change
 	}
 
 	if modified && !searchOnly {
-		fmt.Printf("[DEBUG] File %s has %d changes. Attempting to save...\n", path, len(changes))
+		if replacing && opts.ChangeLog != "" {
+			operator := opts.Operator
+			if operator == "" {
+				operator = utils.CurrentUser()
+			}
+			if err := writeChangeLog(f, opts.ChangeLog, changes, run, operator); err != nil {
+				markFailed(changes, "save", fmt.Sprintf("Writing the change log failed: %v", err))
+				return changes, err
+			}
+		}
+		if hl != nil {
+			if err := hl.record.save(f); err != nil {
+				markFailed(changes, "save", fmt.Sprintf("Recording highlights failed: %v", err))
+				return changes, err
+			}
+		}
+		if notes != nil {
+			if err := notes.save(f); err != nil {
+				markFailed(changes, "save", fmt.Sprintf("Recording notes failed: %v", err))
+				return changes, err
+			}
+		}
+		if opts.BackupDir != "" {
+			if _, err := utils.BackupFile(path, opts.BaseDir, opts.BackupDir); err != nil {
+				markFailed(changes, "backup", fmt.Sprintf("Backup failed: %v", err))
+				return changes, err
+			}
+		}
 		// Use SaveExcelSafe to handle long paths
 		if err := utils.SaveExcelSafe(f, path); err != nil {
-			fmt.Printf("[DEBUG] FAILED to save %s: %v\n", path, err)
-			// Mark all "Success" changes as "Failed"
-			for i := range changes {
-				if changes[i].Status == "Success" {
-					changes[i].Status = "Failed"
-					changes[i].Message = fmt.Sprintf("Save failed: %v", err)
-				}
-			}
+			// Mark all "Success" and "Highlighted" changes as "Failed"
+			markFailed(changes, "save", fmt.Sprintf("Save failed: %v", err))
 			// Return changes even if save failed, so they appear in the report
 			return changes, fmt.Errorf("failed to save file: %w", err)
 		}
-		fmt.Printf("[DEBUG] Successfully saved %s\n", path)
-	} else if len(changes) > 0 {
-		fmt.Printf("[DEBUG] File %s has %d hits (Search Mode).\n", path, len(changes))
 	}
 
 	return changes, nil
 }
+
+// markFailed marks all "Success" and "Highlighted" changes as "Failed" with the
+// given error category and message.
+func markFailed(changes []report.Change, category, message string) {
+	for i := range changes {
+		if changes[i].Status == "Success" || changes[i].Status == "Highlighted" {
+			changes[i].Status = "Failed"
+			changes[i].Message = message
+			changes[i].Error = category
+		}
+	}
+}
+
+// MatchOffsets converts the byte offsets of matches in value to character offsets.
+func MatchOffsets(value string, matches []replacer.Match) []report.Match {
+	offsets := make([]report.Match, len(matches))
+	for i, m := range matches {
+		start := utf8.RuneCountInString(value[:m.Start])
+		offsets[i] = report.Match{Start: start, End: start + utf8.RuneCountInString(value[m.Start:m.End])}
+	}
+	return offsets
+}
+
+// ReplacedOffsets returns the character offsets of the replacement text of
+// each match in the value Replacer.Apply builds from value.
+func ReplacedOffsets(value string, matches []replacer.Match) []report.Match {
+	offsets := make([]report.Match, len(matches))
+	pos, last := 0, 0
+	for i, m := range matches {
+		pos += utf8.RuneCountInString(value[last:m.Start])
+		n := utf8.RuneCountInString(m.Replacement(value))
+		offsets[i] = report.Match{Start: pos, End: pos + n}
+		pos += n
+		last = m.End
+	}
+	return offsets
+}
+
+// headerIf returns the header of the cell if the header is recorded.
+func headerIf(record bool, layout SheetLayout, row, col int) string {
+	if !record {
+		return ""
+	}
+	return layout.Header(row, col)
+}
+
+// rowTextIf returns the other cells of the row if the row context is recorded.
+func rowTextIf(record bool, row []string) string {
+	if !record {
+		return ""
+	}
+	return joinRow(row)
+}
+
+// joinRow joins the non-empty cells of a row for use as context.
+func joinRow(row []string) string {
+	var cells []string
+	for _, v := range row {
+		if v != "" {
+			cells = append(cells, v)
+		}
+	}
+	return strings.Join(cells, " | ")
+}
@@ -1,9 +1,19 @@
 package excel
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"excel_converter/replacer"
+	"excel_converter/report"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -63,3 +73,595 @@ func TestProcessFile_ReadOnly(t *testing.T) {
 	}
 	t.Logf("Verified: Change returned with status '%s' and message: %s", change.Status, change.Message)
 }
+
+func TestMatchOffsets(t *testing.T) {
+	value := "旧仕様と旧仕様"
+	r, err := replacer.NewSingle("旧仕様", "新仕様")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := MatchOffsets(value, r.Find(value))
+	if len(got) != 2 || got[0] != (report.Match{Start: 0, End: 3}) || got[1] != (report.Match{Start: 4, End: 7}) {
+		t.Errorf("unexpected offsets %v", got)
+	}
+}
+
+func TestReplacedOffsets(t *testing.T) {
+	value := "サーバとサーバ"
+	r, err := replacer.NewSingle("サーバ", "サーバー")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ReplacedOffsets(value, r.Find(value))
+	// New value: サーバーとサーバー
+	if len(got) != 2 || got[0] != (report.Match{Start: 0, End: 4}) || got[1] != (report.Match{Start: 5, End: 9}) {
+		t.Errorf("unexpected offsets %v", got)
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	scope := Scope{
+		ExcludeSheets: []string{"re:^old_", "/^tmp\\d$/", "Sheet1"},
+		Ranges:        []string{"B5:H200", "変更履歴!C", "一覧(旧!3:4"},
+	}
+	f, err := scope.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sheet, want := range map[string]bool{"Sheet2": true, "Sheet1": false, "SHEET1": false, "Sheet10": true, "old_2023": false, "bold_x": true, "tmp1": false, "tmp10": true} {
+		if got := f.Sheet(sheet); got != want {
+			t.Errorf("Sheet(%q) = %v, want %v", sheet, got, want)
+		}
+	}
+
+	tests := []struct {
+		sheet    string
+		row, col int
+		want     bool
+	}{
+		{"Sheet1", 5, 2, true},
+		{"Sheet1", 200, 8, true},
+		{"Sheet1", 4, 2, false},
+		{"Sheet1", 5, 9, false},
+		{"変更履歴", 1, 3, true},  // Column C
+		{"変更履歴", 10, 4, true}, // B5:H200 applies to all sheets
+		{"変更履歴", 1, 4, false},
+		{"一覧(旧", 3, 100, true}, // Names are not regular expressions
+		{"一覧(旧", 2, 1, false},
+		{"変更履歴2", 1, 3, false},
+	}
+	for _, tt := range tests {
+		if got := f.Ranges(tt.sheet)(tt.row, tt.col); got != tt.want {
+			t.Errorf("%s R%dC%d: got %v, want %v", tt.sheet, tt.row, tt.col, got, tt.want)
+		}
+	}
+
+	if _, err := (Scope{Sheets: []string{"re:一覧(旧"}}).Filter(); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+	if _, err := (Scope{Ranges: []string{"A1:C"}}).Filter(); err == nil {
+		t.Error("expected an error for a range mixing cells and columns")
+	}
+	if all, _ := (Scope{}).Filter(); !all.Sheet("x") || !all.Ranges("x")(1048576, 16384) {
+		t.Error("the zero scope must cover every cell")
+	}
+}
+
+func TestSheetLayout(t *testing.T) {
+	rows := [][]string{
+		{"案件一覧"},
+		{},
+		{"No", "件名", "ステー\nタス", "担当"},
+		{"1", "旧仕様の確認", "旧仕様", "田中"},
+	}
+	f, err := Scope{Columns: []string{"ステータス"}}.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := f.Layout("一覧", rows)
+	if l.HeaderRow != 3 || l.Empty() {
+		t.Fatalf("header row = %d, empty = %v; want row 3", l.HeaderRow, l.Empty())
+	}
+	if !l.Contains(4, 3) || l.Contains(4, 2) || l.Contains(3, 3) {
+		t.Error("only the data cells of column C must be targeted")
+	}
+	if got := l.Header(4, 3); got != "ステー\nタス" {
+		t.Errorf("Header = %q", got)
+	}
+
+	// An explicit header row for another sheet does not apply
+	f, _ = Scope{Columns: []string{"担当者"}, HeaderRows: []string{"別シート!1", "3"}}.Filter()
+	if l := f.Layout("一覧", rows); l.HeaderRow != 3 || !l.Empty() || len(l.Missing) != 1 {
+		t.Errorf("unexpected layout %+v", l)
+	}
+
+	// The headers of conditions find the header row below a title row
+	f, _ = Scope{Conditions: []string{`[ステータス] == 完了`, `[担当者] != ""`}}.Filter()
+	if l := f.Layout("一覧", rows); l.HeaderRow != 3 || !l.Empty() || len(l.Unresolved) != 1 || l.Unresolved[0] != "担当者" {
+		t.Errorf("unexpected layout %+v", l)
+	}
+	f, _ = Scope{Conditions: []string{`[ステータス] == 完了`}}.Filter()
+	if l := f.Layout("一覧", rows); l.HeaderRow != 3 || l.Empty() || !l.Contains(1, 1) {
+		t.Errorf("unexpected layout %+v", l)
+	}
+
+	// Without titles the first non-empty row is the header
+	f, _ = Scope{}.Filter()
+	if l := f.Layout("一覧", rows[1:]); l.HeaderRow != 2 || !l.Contains(1, 1) {
+		t.Errorf("unexpected layout %+v", l)
+	}
+}
+
+func TestProcessFile_MissingColumnWarning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.xlsx")
+	createTestExcel(t, path, "No")
+	r, err := replacer.NewSingle("No", "番号")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	changes, err := ProcessFileWithOptions(path, Options{Replacer: r, SearchOnly: true, Log: &log, Scope: Scope{Columns: []string{"ステータス"}}})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("changes = %+v, %v", changes, err)
+	}
+	if got := log.String(); !strings.HasPrefix(got, "Warning: sheet Sheet1 of "+path+" has no column titled ステータス; the sheet is skipped.") {
+		t.Errorf("unexpected log %q", got)
+	}
+}
+
+func TestProcessFile_LimitKeepsHeaderAndRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.xlsx")
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]string{"No", "件名"})
+	f.SetSheetRow("Sheet1", "A2", &[]string{"1", "旧仕様"})
+	f.SetSheetRow("Sheet1", "A3", &[]string{"2", "旧仕様"})
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := replacer.NewSingle("旧仕様", "新仕様")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := replacer.Limit{First: 1, Scope: replacer.ScopeFile}
+	changes, err := ProcessFileWithOptions(path, Options{Replacer: r, Log: io.Discard, Header: true, RowContext: true, Limit: limit})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("changes = %+v, %v", changes, err)
+	}
+	// The row the limit left alone has the same context as the replaced one
+	for i, want := range []string{"1 | 旧仕様", "2 | 旧仕様"} {
+		if c := changes[i]; c.Header != "件名" || c.RowText != want {
+			t.Errorf("%s (%s): header %q, row %q", c.Cell, c.Status, c.Header, c.RowText)
+		}
+	}
+	if changes[1].Status != "Skipped (limit)" {
+		t.Errorf("unexpected status %s", changes[1].Status)
+	}
+}
+
+func TestProcessFile_ConditionBelowTitleRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.xlsx")
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]string{"案件一覧 旧仕様"})
+	f.SetSheetRow("Sheet1", "A3", &[]string{"件名", "ステータス"})
+	f.SetSheetRow("Sheet1", "A4", &[]string{"旧仕様の確認", "完了"})
+	f.SetSheetRow("Sheet1", "A5", &[]string{"旧仕様の修正", "対応中"})
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := replacer.NewSingle("旧仕様", "新仕様")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Replacer: r, SearchOnly: true, Log: io.Discard, Scope: Scope{Conditions: []string{`[ステータス] == 完了`}}}
+	changes, err := ProcessFileWithOptions(path, opts)
+	if err != nil || len(changes) != 1 || changes[0].Cell != "A4" {
+		t.Fatalf("changes = %+v, %v; want only A4", changes, err)
+	}
+
+	// A condition on a header the sheet does not have skips the sheet
+	var log bytes.Buffer
+	opts.Log = &log
+	opts.Scope.Conditions = []string{`[担当者] != 田中`}
+	changes, err = ProcessFileWithOptions(path, opts)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("changes = %+v, %v; want none", changes, err)
+	}
+	if !strings.Contains(log.String(), "no column titled 担当者 for the conditions; the sheet is skipped") {
+		t.Errorf("unexpected log %q", log.String())
+	}
+}
+
+func TestCondition(t *testing.T) {
+	headers := []string{"No", "ステータス", "備考"}
+	row := []string{"1", " 完了 ", "★要確認, 至急"}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`B == "完了"`, true},
+		{`B != 完了`, false},
+		{`[ステータス] == 完了`, true},
+		{`[担当] == ""`, false}, // Unknown headers never hold
+		{`[担当] != x`, false},
+		{`A =~ ^\d+$`, true},
+		{`C !~ "至急"`, false},
+		{`C contains "要確認, 至"`, true},
+		{`row contains ★`, true},
+		{`row !contains ☆`, true},
+		{`row == 1`, true},
+		{`D == x`, false},
+	}
+	for _, tt := range tests {
+		c, err := ParseCondition(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := c.Eval(row, headers); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{`B = 1`, `1 == 2`, `[ == x`, `B =~ (`, `B == "x`} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestHighlight_ClearRestoresStyleAndNote(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetCellValue("Sheet1", "A1", "旧仕様")
+	f.SetCellValue("Sheet1", "B1", "旧仕様")
+	italic, _ := f.NewStyle(&excelize.Style{NumFmt: 14, Font: &excelize.Font{Italic: true, Color: "112233"}})
+	f.SetCellStyle("Sheet1", "A1", "A1", italic)
+	f.AddComment("Sheet1", excelize.Comment{Cell: "A1", Author: "reviewer", Text: "既存のメモ"})
+	if err := SetCustomProperty(f, "Owner", "設計チーム"); err != nil {
+		t.Fatal(err)
+	}
+
+	hl, err := newHighlighter(f, Highlight{Fill: "#ffff00", Bold: true, Comment: "要確認"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{"A1", "B1"} {
+		if err := hl.apply("Sheet1", cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hl.record.save(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record and the other properties survive saving
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	style := cellStyle(t, g, "A1")
+	if !style.Font.Bold || !style.Font.Italic || style.NumFmt != 14 || len(style.Fill.Color) != 1 || style.Fill.Color[0] != "FFFF00" {
+		t.Errorf("highlight must keep the existing style: %+v %+v", style, style.Font)
+	}
+	if got := commentText(t, g, "A1"); got != "既存のメモ\n要確認" {
+		t.Errorf("note = %q", got)
+	}
+
+	cleared, found, err := clearHighlights(g)
+	if err != nil || !found || cleared != 2 {
+		t.Fatalf("clearHighlights = %d, %v, %v", cleared, found, err)
+	}
+	style = cellStyle(t, g, "A1")
+	if style.Font.Bold || !style.Font.Italic || style.Font.Color != "112233" || style.Fill.Pattern != 0 {
+		t.Errorf("style not restored: %+v %+v", style, style.Font)
+	}
+	if got := commentText(t, g, "A1"); got != "既存のメモ" {
+		t.Errorf("note after clear = %q", got)
+	}
+	if got := commentText(t, g, "B1"); got != "" {
+		t.Errorf("added note must be deleted, got %q", got)
+	}
+	if v, _ := GetCustomProperty(g, HighlightProperty); v != "" {
+		t.Errorf("record must be removed, got %q", v)
+	}
+	if v, _ := GetCustomProperty(g, "Owner"); v != "設計チーム" {
+		t.Errorf("other property lost: %q", v)
+	}
+}
+
+func TestNotes_OldValueAndClear(t *testing.T) {
+	run := NewRun(time.Date(2026, 10, 17, 15, 30, 45, 0, time.Local))
+	if got := run.OldValueNote("旧仕様"); got != "旧: 旧仕様 (2026-10-17 run 20261017_153045)" {
+		t.Errorf("OldValueNote = %q", got)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	f.AddComment("Sheet1", excelize.Comment{Cell: "A1", Author: "reviewer", Text: "既存のメモ"})
+	rec, err := loadNoteRecord(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{"A1", "B1"} {
+		if err := rec.add(f, "Sheet1", cell, run.OldValueNote("旧仕様")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A note whose runs were merged in Excel, of a value with two lines
+	multi := run.OldValueNote("旧\n仕様")
+	f.AddComment("Sheet1", excelize.Comment{Cell: "D1", Author: "reviewer", Text: "確認済み\n" + multi + "\n追記"})
+	rec.Notes = append(rec.Notes, recordedNote{Sheet: "Sheet1", Cell: "D1", Hash: noteHash(multi)})
+	if err := rec.save(f); err != nil {
+		t.Fatal(err)
+	}
+	var raw json.RawMessage
+	if _, err := loadRecord(f, NoteProperty, &raw); err != nil || strings.Contains(string(raw), "旧") {
+		t.Errorf("the record must not keep the old values: %s %v", raw, err)
+	}
+	hl, _ := newHighlighter(f, Highlight{Bold: true, Comment: "要確認"})
+	hl.apply("Sheet1", "C1")
+	hl.record.save(f)
+	if got := commentText(t, f, "A1"); got != "既存のメモ\n"+run.OldValueNote("旧仕様") {
+		t.Errorf("note = %q", got)
+	}
+
+	removed, found, err := clearNotes(f)
+	if err != nil || !found || removed != 4 {
+		t.Fatalf("clearNotes = %d, %v, %v", removed, found, err)
+	}
+	if got := commentText(t, f, "A1"); got != "既存のメモ" {
+		t.Errorf("note after clear = %q", got)
+	}
+	if got := commentText(t, f, "D1"); got != "確認済み\n追記" {
+		t.Errorf("merged note after clear = %q", got)
+	}
+	for _, cell := range []string{"B1", "C1"} {
+		if got := commentText(t, f, cell); got != "" {
+			t.Errorf("%s: added note must be deleted, got %q", cell, got)
+		}
+	}
+	if !cellStyle(t, f, "C1").Font.Bold {
+		t.Error("clearNotes must keep the highlight")
+	}
+	if _, found, _ := clearNotes(f); found {
+		t.Error("no notes must be left")
+	}
+}
+
+func TestChangeLog_AppendsAcrossRuns(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	first := NewRun(time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local))
+	changes := []report.Change{
+		{Sheet: "Sheet1", Cell: "A1", OldValue: "旧仕様", NewValue: "新仕様", Status: "Success"},
+		{Sheet: "Sheet1", Cell: "A2", OldValue: "=旧", NewValue: "=新", Status: "Success"},
+		{Sheet: "Sheet1", Cell: "A3", OldValue: "旧", Status: "Skipped (limit)"},
+	}
+	if err := writeChangeLog(f, DefaultChangeLogSheet, changes, first, "tanaka"); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	second := NewRun(time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local))
+	if err := writeChangeLog(g, DefaultChangeLogSheet, changes[:1], second, "suzuki"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := g.GetRows(DefaultChangeLogSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][2] != "Old Value" || rows[2][2] != "=旧" || rows[3][5] != second.ID || rows[3][6] != "suzuki" {
+		t.Fatalf("unexpected change log %q", rows)
+	}
+	if formula, _ := g.GetCellFormula(DefaultChangeLogSheet, "C3"); formula != "" {
+		t.Errorf("logged values must be text, got formula %q", formula)
+	}
+	tables, err := g.GetTables(DefaultChangeLogSheet)
+	if err != nil || len(tables) != 1 || tables[0].Range != "A1:G4" {
+		t.Errorf("tables = %+v, %v; want one table A1:G4", tables, err)
+	}
+	if sheets, _ := changeLogSheets(g); len(sheets) != 1 || sheets[0] != DefaultChangeLogSheet {
+		t.Errorf("recorded sheets = %q", sheets)
+	}
+}
+
+func TestProcessFile_ChangeLogOnDataSheet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.xlsx")
+	createTestExcel(t, path, "旧仕様")
+	r, err := replacer.NewSingle("旧仕様", "新仕様")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Replacer: r, Log: io.Discard, ChangeLog: "sheet1"}
+	if changes, err := ProcessFileWithOptions(path, opts); err == nil || len(changes) != 0 {
+		t.Fatalf("changes = %+v, %v; want an error", changes, err)
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := f.GetCellValue("Sheet1", "A1")
+	f.Close()
+	if v != "旧仕様" {
+		t.Errorf("data sheet modified: %q", v)
+	}
+
+	// A change log sheet recorded by an earlier run is appended to, and never
+	// replaced, whatever the letter case of its name
+	opts.ChangeLog = "Changes"
+	if _, err := ProcessFileWithOptions(path, opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Replacer, err = replacer.NewSingle("新仕様", "次仕様"); err != nil {
+		t.Fatal(err)
+	}
+	opts.ChangeLog = "changes"
+	if _, err := ProcessFileWithOptions(path, opts); err != nil {
+		t.Fatalf("recorded change log refused: %v", err)
+	}
+	if f, err = excelize.OpenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, _ := f.GetRows("Changes")
+	if len(rows) != 3 || rows[1][3] != "新仕様" || rows[2][3] != "次仕様" {
+		t.Errorf("unexpected change log %q", rows)
+	}
+	if sheets, _ := changeLogSheets(f); len(sheets) != 1 || sheets[0] != "Changes" {
+		t.Errorf("recorded sheets = %q", sheets)
+	}
+}
+
+func TestHighlight_Style(t *testing.T) {
+	if got := (Highlight{Comment: "要確認"}).WithDefault(DefaultReplaceStyle); !got.Bold || got.FontColor != "2980C4" || got.Comment != "要確認" {
+		t.Errorf("default replace style = %+v", got)
+	}
+	if got := (Highlight{Italic: true}).WithDefault(DefaultReplaceStyle); got.Bold || !got.Italic {
+		t.Errorf("formatting must replace the default, got %+v", got)
+	}
+	if err := (Highlight{Fill: "ffd966"}).Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (Highlight{FontColor: "blue"}).Validate(); err == nil {
+		t.Error("expected an invalid color to fail")
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	plain, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Underline: "double"}})
+	f.SetCellStyle("Sheet1", "A1", "A1", plain)
+	hl, err := newHighlighter(f, Highlight{Italic: true, Underline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hl.apply("Sheet1", "A1"); err != nil {
+		t.Fatal(err)
+	}
+	if style := cellStyle(t, f, "A1"); !style.Font.Italic || style.Font.Underline != "single" {
+		t.Errorf("style not applied: %+v", style.Font)
+	}
+	if err := hl.record.save(f); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, _, err := clearHighlights(f); err != nil || cleared != 1 {
+		t.Fatalf("cleared %d cells: %v", cleared, err)
+	}
+	if style := cellStyle(t, f, "A1"); style.Font.Italic || style.Font.Underline != "double" {
+		t.Errorf("style not restored: %+v", style.Font)
+	}
+}
+
+func TestCustomProperty_LongValue(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	long := strings.Repeat("あいう", 200)
+	if err := SetCustomProperty(f, "Note", long); err != nil {
+		t.Fatal(err)
+	}
+	props, _ := f.GetCustomProps()
+	if len(props) != 3 || props[1].Name != "Note.2" {
+		t.Errorf("expected 3 properties of at most %d characters, got %+v", maxPropertyLength, props)
+	}
+	if got, _ := GetCustomProperty(f, "Note"); got != long {
+		t.Error("value not joined again")
+	}
+	if err := SetCustomProperty(f, "Note", ""); err != nil {
+		t.Fatal(err)
+	}
+	if props, _ := f.GetCustomProps(); len(props) != 0 {
+		t.Errorf("expected no properties, got %+v", props)
+	}
+}
+
+// TestHighlightRecord_Ranges checks that the record stores the cells of a
+// column as ranges, and that a record that does not fit is refused.
+func TestHighlightRecord_Ranges(t *testing.T) {
+	cells := []string{"B3", "A1", "B2", "A2", "C7", "A3", "B2"}
+	if got := compactRanges(cells); got != "A1:A3 B2:B3 C7" {
+		t.Errorf("compactRanges = %q", got)
+	}
+	if got, err := expandRanges("A1:A3 C7"); err != nil || strings.Join(got, " ") != "A1 A2 A3 C7" {
+		t.Errorf("expandRanges = %v, %v", got, err)
+	}
+	if _, err := expandRanges("A1:C3"); err == nil {
+		t.Error("expected an error for a range over several columns")
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	hl, err := newHighlighter(f, DefaultHighlight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for row := 1; row <= 5000; row++ {
+		cell, _ := excelize.CoordinatesToCellName(2, row)
+		if err := hl.apply("Sheet1", cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hl.record.save(f); err != nil {
+		t.Fatal(err)
+	}
+	if props, _ := f.GetCustomProps(); len(props) != 1 {
+		t.Errorf("5000 cells of a column must fit in one property, got %d", len(props))
+	}
+	rec, err := loadHighlightRecord(f)
+	if err != nil || len(rec.cells) != 5000 || rec.cells[4999].Cell != "B5000" || rec.cells[0].prior.Fill == nil {
+		t.Fatalf("record not loaded again: %d cells, %v", len(rec.cells), err)
+	}
+
+	// Scattered cells with distinct notes do not compress
+	for i := 0; i < 20000; i++ {
+		rc := rec.add("Sheet1", fmt.Sprintf("D%d", 2*i+1))
+		rc.Note = fmt.Sprint(i)
+	}
+	if err := rec.save(f); !errors.Is(err, errRecordTooLarge) {
+		t.Errorf("expected errRecordTooLarge, got %v", err)
+	}
+}
+
+func cellStyle(t *testing.T, f *excelize.File, cell string) *excelize.Style {
+	t.Helper()
+	idx, err := f.GetCellStyle("Sheet1", cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := f.GetStyle(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.Font == nil {
+		style.Font = &excelize.Font{}
+	}
+	return style
+}
+
+func commentText(t *testing.T, f *excelize.File, cell string) string {
+	t.Helper()
+	c, _, err := cellComment(f, "Sheet1", cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	for _, r := range commentRuns(c) {
+		text += r.Text
+	}
+	return text
+}
@@ -0,0 +1,188 @@
+package excel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HeaderSearchRows is the number of leading rows searched for the header row
+// when it is not given.
+const HeaderSearchRows = 20
+
+// SheetLayout is the header row of a sheet and the columns a Scope targets by
+// their header text.
+type SheetLayout struct {
+	HeaderRow int      // 1-based; 0 if the sheet has no header row
+	Headers   []string // Header text by 0-based column
+	Missing   []string // Requested column titles that are not in the header row
+	// Header texts of [header] conditions that are not in the header row; the
+	// conditions cannot be evaluated, so no cell of the sheet is targeted
+	Unresolved []string
+	columns    map[int]bool
+}
+
+// Contains reports whether the cell (1-based row and column) is in one of the
+// targeted columns. The header row and the rows above it are never targeted.
+// Without column titles every cell is contained.
+func (l SheetLayout) Contains(row, col int) bool {
+	if l.columns == nil {
+		return true
+	}
+	return row > l.HeaderRow && l.columns[col-1]
+}
+
+// Empty reports whether no cell of the sheet is targeted: column titles were
+// requested but none was found, or a [header] condition is unresolved.
+func (l SheetLayout) Empty() bool {
+	return len(l.Unresolved) > 0 || l.columns != nil && len(l.columns) == 0
+}
+
+// Header returns the header text of the cell's column (1-based row and
+// column), or "" for the header row and the rows above it.
+func (l SheetLayout) Header(row, col int) string {
+	if row <= l.HeaderRow || col > len(l.Headers) {
+		return ""
+	}
+	return l.Headers[col-1]
+}
+
+// HeaderRowLimit returns how many leading rows of the sheet Layout needs.
+func (f *ScopeFilter) HeaderRowLimit(sheet string) int {
+	if row := f.headerRow(sheet); row > 0 {
+		return row
+	}
+	return HeaderSearchRows
+}
+
+// Layout finds the header row of the sheet in its leading rows (at least
+// HeaderRowLimit rows, if the sheet has them) and the targeted columns. The
+// header row is the one given for the sheet; otherwise the first row that
+// contains the most requested titles (columns and [header] conditions), or the
+// first non-empty row when no titles are requested.
+func (f *ScopeFilter) Layout(sheet string, rows [][]string) SheetLayout {
+	var l SheetLayout
+	titles := f.titles()
+	if row := f.headerRow(sheet); row > 0 {
+		l.HeaderRow = row
+	} else {
+		best := 0
+		for r := 0; r < len(rows) && r < HeaderSearchRows; r++ {
+			if len(titles) == 0 {
+				if !emptyRow(rows[r]) {
+					l.HeaderRow = r + 1
+					break
+				}
+				continue
+			}
+			if n := len(find(rows[r], titles)); n > best {
+				best, l.HeaderRow = n, r+1
+			}
+		}
+	}
+	if l.HeaderRow > 0 && l.HeaderRow <= len(rows) {
+		l.Headers = rows[l.HeaderRow-1]
+	}
+	found := find(l.Headers, titles)
+	for _, c := range f.conditions {
+		if _, ok := found[c.header]; c.header != "" && !ok {
+			l.Unresolved = append(l.Unresolved, c.header)
+		}
+	}
+	if len(f.columns) == 0 {
+		return l
+	}
+
+	l.columns = make(map[int]bool)
+	for _, title := range f.columns {
+		cols, ok := found[normalizeHeader(title)]
+		if !ok {
+			l.Missing = append(l.Missing, title)
+		}
+		for _, c := range cols {
+			l.columns[c] = true
+		}
+	}
+	return l
+}
+
+// titles returns the normalized header texts the scope refers to: the
+// requested columns and the headers of [header] conditions.
+func (f *ScopeFilter) titles() map[string]bool {
+	titles := make(map[string]bool)
+	for _, title := range f.columns {
+		if t := normalizeHeader(title); t != "" {
+			titles[t] = true
+		}
+	}
+	for _, c := range f.conditions {
+		if c.header != "" {
+			titles[c.header] = true
+		}
+	}
+	return titles
+}
+
+// find returns the 0-based columns of row by title (normalized).
+func find(row []string, titles map[string]bool) map[string][]int {
+	found := make(map[string][]int)
+	for c, v := range row {
+		if v = normalizeHeader(v); titles[v] {
+			found[v] = append(found[v], c)
+		}
+	}
+	return found
+}
+
+func (f *ScopeFilter) headerRow(sheet string) int {
+	row := 0
+	for _, h := range f.headerRows {
+		if h.sheet != nil && h.sheet.match(sheet) {
+			return h.row // A row for the sheet wins over one for all sheets
+		}
+		if h.sheet == nil && row == 0 {
+			row = h.row
+		}
+	}
+	return row
+}
+
+type sheetHeader struct {
+	sheet *sheetPattern // nil = all sheets
+	row   int
+}
+
+// parseHeaderRow parses "[sheet pattern!]row".
+func parseHeaderRow(s string) (sheetHeader, error) {
+	var h sheetHeader
+	ref := s
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		patterns, err := compileSheetPatterns([]string{s[:i]})
+		if err != nil {
+			return h, fmt.Errorf("header row %q: %w", s, err)
+		}
+		h.sheet = &patterns[0]
+		ref = s[i+1:]
+	}
+	row, err := strconv.Atoi(strings.TrimSpace(ref))
+	if err != nil || row < 1 {
+		return h, fmt.Errorf("header row %q: not a row number", s)
+	}
+	h.row = row
+	return h, nil
+}
+
+// normalizeHeader ignores white space and line breaks in header texts, so
+// "ステー\nタス" matches "ステータス".
+func normalizeHeader(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+func emptyRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
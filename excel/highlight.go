@@ -0,0 +1,619 @@
+package excel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"excel_converter/utils"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Highlight is the style applied to hits: by highlight mode, which does not
+// change their text, and to replaced cells. Only the attributes that are set
+// are changed; the rest of each cell's style (number format, borders,
+// alignment, ...) is kept.
+type Highlight struct {
+	FontColor string // RRGGBB, e.g. "C00000"
+	Fill      string // RRGGBB background, e.g. "FFFF00"
+	Bold      bool
+	Italic    bool
+	Underline bool
+	Comment   string // Note added to the cell; appended to an existing note
+}
+
+// DefaultHighlight is the style of highlight mode when no formatting is
+// chosen: a yellow fill.
+var DefaultHighlight = Highlight{Fill: "FFFF00"}
+
+// DefaultReplaceStyle is the style of replaced cells when no formatting is
+// chosen: bold, RGB(41,128,196).
+var DefaultReplaceStyle = Highlight{FontColor: "2980C4", Bold: true}
+
+// HighlightProperty is the custom document property that records the cells
+// this tool styled and their previous formatting (see ClearHighlights).
+const HighlightProperty = "ExcelConverterHighlights"
+
+// NoteAuthor is the author of the notes this tool adds.
+const NoteAuthor = "excel_converter"
+
+// Empty reports whether no attribute is set.
+func (h Highlight) Empty() bool {
+	return !h.Formats() && h.Comment == ""
+}
+
+// Formats reports whether a formatting attribute (anything but Comment) is set.
+func (h Highlight) Formats() bool {
+	return h.FontColor != "" || h.Fill != "" || h.Bold || h.Italic || h.Underline
+}
+
+// WithDefault returns h, or the formatting of def with the comment of h when h
+// sets no formatting.
+func (h Highlight) WithDefault(def Highlight) Highlight {
+	if h.Formats() {
+		return h
+	}
+	def.Comment = h.Comment
+	return def
+}
+
+// Validate checks the colors.
+func (h Highlight) Validate() error {
+	for _, c := range []struct{ name, value string }{{"font color", h.FontColor}, {"fill", h.Fill}} {
+		if c.value != "" && !isRGB(rgb(c.value)) {
+			return fmt.Errorf("%s %q: expected RRGGBB, e.g. FFFF00", c.name, c.value)
+		}
+	}
+	return nil
+}
+
+// String describes the highlight for reports, e.g. "fill FFFF00, bold".
+func (h Highlight) String() string {
+	var parts []string
+	if h.FontColor != "" {
+		parts = append(parts, "font color "+rgb(h.FontColor))
+	}
+	if h.Fill != "" {
+		parts = append(parts, "fill "+rgb(h.Fill))
+	}
+	for _, a := range []struct {
+		set  bool
+		name string
+	}{{h.Bold, "bold"}, {h.Italic, "italic"}, {h.Underline, "underline"}} {
+		if a.set {
+			parts = append(parts, a.name)
+		}
+	}
+	if h.Comment != "" {
+		parts = append(parts, fmt.Sprintf("comment %q", h.Comment))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rgb normalizes a color: "#ffff00" -> "FFFF00".
+func rgb(s string) string {
+	return strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+}
+
+func isRGB(s string) bool {
+	return len(s) == 6 && strings.Trim(s, "0123456789ABCDEF") == ""
+}
+
+// merge applies the highlight to style and returns the attributes it changed,
+// as they were before.
+func (h Highlight) merge(style *excelize.Style) priorStyle {
+	var prior priorStyle
+	if (h.FontColor != "" || h.Bold || h.Italic || h.Underline) && style.Font == nil {
+		style.Font = &excelize.Font{}
+	}
+	if h.FontColor != "" {
+		prior.Font = &priorFont{Color: style.Font.Color, Indexed: style.Font.ColorIndexed, Theme: style.Font.ColorTheme, Tint: style.Font.ColorTint}
+		style.Font.Color = rgb(h.FontColor)
+		style.Font.ColorIndexed, style.Font.ColorTheme, style.Font.ColorTint = 0, nil, 0
+	}
+	if h.Bold {
+		bold := style.Font.Bold
+		prior.Bold = &bold
+		style.Font.Bold = true
+	}
+	if h.Italic {
+		italic := style.Font.Italic
+		prior.Italic = &italic
+		style.Font.Italic = true
+	}
+	if h.Underline {
+		underline := style.Font.Underline
+		prior.Underline = &underline
+		style.Font.Underline = "single"
+	}
+	if h.Fill != "" {
+		fill := style.Fill
+		prior.Fill = &fill
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{rgb(h.Fill)}}
+	}
+	return prior
+}
+
+// priorStyle holds the attributes a highlight changed, as they were before;
+// nil means the attribute was not changed.
+type priorStyle struct {
+	Font      *priorFont     `json:"font,omitempty"`
+	Bold      *bool          `json:"bold,omitempty"`
+	Italic    *bool          `json:"italic,omitempty"`
+	Underline *string        `json:"underline,omitempty"`
+	Fill      *excelize.Fill `json:"fill,omitempty"`
+}
+
+type priorFont struct {
+	Color   string  `json:"color,omitempty"`
+	Indexed int     `json:"indexed,omitempty"`
+	Theme   *int    `json:"theme,omitempty"`
+	Tint    float64 `json:"tint,omitempty"`
+}
+
+// restore puts the recorded attributes back into style.
+func (p priorStyle) restore(style *excelize.Style) {
+	if (p.Font != nil || p.Bold != nil || p.Italic != nil || p.Underline != nil) && style.Font == nil {
+		style.Font = &excelize.Font{}
+	}
+	if p.Font != nil {
+		style.Font.Color, style.Font.ColorIndexed = p.Font.Color, p.Font.Indexed
+		style.Font.ColorTheme, style.Font.ColorTint = p.Font.Theme, p.Font.Tint
+	}
+	if p.Bold != nil {
+		style.Font.Bold = *p.Bold
+	}
+	if p.Italic != nil {
+		style.Font.Italic = *p.Italic
+	}
+	if p.Underline != nil {
+		style.Font.Underline = *p.Underline
+	}
+	if p.Fill != nil {
+		style.Fill = *p.Fill
+	}
+}
+
+// union adds the attributes of other that p does not record yet. A cell that
+// is highlighted again keeps the attributes it had before the first highlight.
+func (p priorStyle) union(other priorStyle) priorStyle {
+	if p.Font == nil {
+		p.Font = other.Font
+	}
+	if p.Bold == nil {
+		p.Bold = other.Bold
+	}
+	if p.Italic == nil {
+		p.Italic = other.Italic
+	}
+	if p.Underline == nil {
+		p.Underline = other.Underline
+	}
+	if p.Fill == nil {
+		p.Fill = other.Fill
+	}
+	return p
+}
+
+// highlightRecord is the content of HighlightProperty: the highlighted cells
+// and what to restore. Only the addresses are stored, as ranges of the cells
+// of a sheet that share their previous formatting (Styles) and note, and the
+// JSON is compressed because custom properties are short.
+type highlightRecord struct {
+	Version int            `json:"v"`
+	Styles  []priorStyle   `json:"styles,omitempty"`
+	Groups  []cellGroup    `json:"groups"`
+	cells   []recordedCell // Groups expanded while the workbook is processed
+	index   map[string]int // "sheet!cell" -> index into cells
+}
+
+type cellGroup struct {
+	Sheet  string `json:"s"`
+	Style  int    `json:"p"`           // Index into Styles
+	Note   string `json:"n,omitempty"` // Note text this tool added
+	Ranges string `json:"r"`           // e.g. "B2:B40 D5"
+}
+
+type recordedCell struct {
+	Sheet string
+	Cell  string
+	Style int    // Index into Styles of the loaded record
+	Note  string // Note text this tool added
+	prior priorStyle
+}
+
+func loadHighlightRecord(f *excelize.File) (*highlightRecord, error) {
+	rec := &highlightRecord{Version: 1}
+	if found, err := loadRecord(f, HighlightProperty, rec); err != nil || !found {
+		return rec, err
+	}
+	for _, g := range rec.Groups {
+		var prior priorStyle
+		if g.Style >= 0 && g.Style < len(rec.Styles) {
+			prior = rec.Styles[g.Style]
+		}
+		cells, err := expandRanges(g.Ranges)
+		if err != nil {
+			return rec, fmt.Errorf("%s: %w", HighlightProperty, err)
+		}
+		for _, cell := range cells {
+			rec.cells = append(rec.cells, recordedCell{Sheet: g.Sheet, Cell: cell, Style: g.Style, Note: g.Note, prior: prior})
+		}
+	}
+	return rec, nil
+}
+
+// save stores the record in the workbook, or removes the property when no
+// cell is recorded.
+func (r *highlightRecord) save(f *excelize.File) error {
+	if len(r.cells) == 0 {
+		return SetCustomProperty(f, HighlightProperty, "")
+	}
+	type groupKey struct {
+		sheet string
+		style int
+		note  string
+	}
+	r.Styles, r.Groups = nil, nil
+	styles := make(map[string]int)
+	groups := make(map[groupKey]int)
+	var addresses [][]string // By group
+	for _, rc := range r.cells {
+		key, _ := json.Marshal(rc.prior)
+		p, ok := styles[string(key)]
+		if !ok {
+			p = len(r.Styles)
+			styles[string(key)] = p
+			r.Styles = append(r.Styles, rc.prior)
+		}
+		gk := groupKey{rc.Sheet, p, rc.Note}
+		g, ok := groups[gk]
+		if !ok {
+			g = len(r.Groups)
+			groups[gk] = g
+			r.Groups = append(r.Groups, cellGroup{Sheet: rc.Sheet, Style: p, Note: rc.Note})
+			addresses = append(addresses, nil)
+		}
+		addresses[g] = append(addresses[g], rc.Cell)
+	}
+	for i := range r.Groups {
+		r.Groups[i].Ranges = compactRanges(addresses[i])
+	}
+	return saveRecord(f, HighlightProperty, r)
+}
+
+func (r *highlightRecord) find(sheet, cell string) *recordedCell {
+	if r.index == nil {
+		r.index = make(map[string]int)
+		for i, c := range r.cells {
+			r.index[c.Sheet+"!"+c.Cell] = i
+		}
+	}
+	if i, ok := r.index[sheet+"!"+cell]; ok {
+		return &r.cells[i]
+	}
+	return nil
+}
+
+func (r *highlightRecord) add(sheet, cell string) *recordedCell {
+	r.find(sheet, cell)
+	r.index[sheet+"!"+cell] = len(r.cells)
+	r.cells = append(r.cells, recordedCell{Sheet: sheet, Cell: cell})
+	return &r.cells[len(r.cells)-1]
+}
+
+// compactRanges writes cell addresses as ranges of consecutive cells in a
+// column: A1, A2, A3, C5 -> "A1:A3 C5".
+func compactRanges(cells []string) string {
+	type coords struct{ col, row int }
+	var sorted []coords
+	for _, cell := range cells {
+		if col, row, err := excelize.CellNameToCoordinates(cell); err == nil {
+			sorted = append(sorted, coords{col, row})
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].col != sorted[j].col {
+			return sorted[i].col < sorted[j].col
+		}
+		return sorted[i].row < sorted[j].row
+	})
+	var ranges []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1].col == sorted[i].col && sorted[j+1].row <= sorted[j].row+1 {
+			j++
+		}
+		r, _ := excelize.CoordinatesToCellName(sorted[i].col, sorted[i].row)
+		if sorted[j].row != sorted[i].row {
+			last, _ := excelize.CoordinatesToCellName(sorted[j].col, sorted[j].row)
+			r += ":" + last
+		}
+		ranges = append(ranges, r)
+		i = j + 1
+	}
+	return strings.Join(ranges, " ")
+}
+
+// expandRanges returns the cells of ranges written by compactRanges.
+func expandRanges(ranges string) ([]string, error) {
+	var cells []string
+	for _, r := range strings.Fields(ranges) {
+		first, last, found := strings.Cut(r, ":")
+		if !found {
+			last = first
+		}
+		col, row, err := excelize.CellNameToCoordinates(first)
+		if err != nil {
+			return nil, err
+		}
+		lastCol, lastRow, err := excelize.CellNameToCoordinates(last)
+		if err != nil {
+			return nil, err
+		}
+		if lastCol != col || lastRow < row {
+			return nil, fmt.Errorf("invalid range %q", r)
+		}
+		for ; row <= lastRow; row++ {
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			cells = append(cells, cell)
+		}
+	}
+	return cells, nil
+}
+
+// highlighter highlights the cells of one workbook and records them.
+type highlighter struct {
+	f      *excelize.File
+	h      Highlight
+	record *highlightRecord
+	styles map[int]highlightedStyle // By the cell's current style ID
+}
+
+type highlightedStyle struct {
+	id    int
+	prior priorStyle
+}
+
+func newHighlighter(f *excelize.File, h Highlight) (*highlighter, error) {
+	rec, err := loadHighlightRecord(f)
+	if err != nil {
+		return nil, err
+	}
+	return &highlighter{f: f, h: h, record: rec, styles: make(map[int]highlightedStyle)}, nil
+}
+
+// apply highlights one cell, keeping the rest of its style.
+func (hl *highlighter) apply(sheet, cell string) error {
+	current, err := hl.f.GetCellStyle(sheet, cell)
+	if err != nil {
+		return err
+	}
+	st, ok := hl.styles[current]
+	if !ok {
+		style, err := hl.f.GetStyle(current)
+		if err != nil {
+			return err
+		}
+		st.prior = hl.h.merge(style)
+		if st.id, err = hl.f.NewStyle(style); err != nil {
+			return err
+		}
+		hl.styles[current] = st
+	}
+	if err := hl.f.SetCellStyle(sheet, cell, cell, st.id); err != nil {
+		return err
+	}
+
+	rc := hl.record.find(sheet, cell)
+	if rc == nil {
+		rc = hl.record.add(sheet, cell)
+	}
+	rc.prior = rc.prior.union(st.prior)
+	if hl.h.Comment != "" && rc.Note == "" {
+		if err := addNote(hl.f, sheet, cell, hl.h.Comment); err != nil {
+			return err
+		}
+		rc.Note = hl.h.Comment
+	}
+	return nil
+}
+
+// addNote appends note to the note of the cell, or adds a new note.
+func addNote(f *excelize.File, sheet, cell, note string) error {
+	c, found, err := cellComment(f, sheet, cell)
+	if err != nil {
+		return err
+	}
+	runs := commentRuns(c)
+	if found {
+		if err := f.DeleteComment(sheet, cell); err != nil {
+			return err
+		}
+		note = "\n" + note
+	} else {
+		c = excelize.Comment{Cell: cell, Author: NoteAuthor}
+	}
+	c.Text, c.Paragraph = "", append(runs, excelize.RichTextRun{Text: note})
+	return f.AddComment(sheet, c)
+}
+
+// removeNote removes a note text added by addNote, recognized by isNote; a
+// note that is left empty is deleted.
+func removeNote(f *excelize.File, sheet, cell string, isNote func(text string) bool) error {
+	c, found, err := cellComment(f, sheet, cell)
+	if err != nil || !found {
+		return err
+	}
+	runs := commentRuns(c)
+	removed := false
+	for i := len(runs) - 1; i >= 0; i-- {
+		if isNote(strings.TrimPrefix(runs[i].Text, "\n")) {
+			runs = append(runs[:i], runs[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		// The runs were merged when the note was edited in Excel
+		var text strings.Builder
+		for _, r := range runs {
+			text.WriteString(r.Text)
+		}
+		i, end, ok := findNote(text.String(), isNote)
+		if !ok {
+			return nil
+		}
+		if i > 0 {
+			i-- // The line break before the note
+		}
+		runs = []excelize.RichTextRun{{Text: text.String()[:i] + text.String()[end:]}}
+	}
+	if err := f.DeleteComment(sheet, cell); err != nil {
+		return err
+	}
+	for _, r := range runs {
+		if strings.TrimSpace(r.Text) != "" {
+			c.Text, c.Paragraph = "", runs
+			return f.AddComment(sheet, c)
+		}
+	}
+	return nil
+}
+
+// findNote returns the offsets of the last lines of text that isNote
+// recognizes as a note.
+func findNote(text string, isNote func(string) bool) (start, end int, found bool) {
+	starts, ends := []int{0}, []int{}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			ends = append(ends, i)
+			starts = append(starts, i+1)
+		}
+	}
+	ends = append(ends, len(text))
+	for s := len(starts) - 1; s >= 0; s-- {
+		for e := s; e < len(ends); e++ {
+			if isNote(text[starts[s]:ends[e]]) {
+				return starts[s], ends[e], true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// isText returns a function for removeNote that recognizes the note text.
+func isText(note string) func(string) bool {
+	return func(text string) bool { return text == note }
+}
+
+func cellComment(f *excelize.File, sheet, cell string) (excelize.Comment, bool, error) {
+	comments, err := f.GetComments(sheet)
+	if err != nil {
+		return excelize.Comment{}, false, err
+	}
+	for _, c := range comments {
+		if c.Cell == cell {
+			return c, true, nil
+		}
+	}
+	return excelize.Comment{}, false, nil
+}
+
+// commentRuns returns the text of a comment as rich text runs.
+func commentRuns(c excelize.Comment) []excelize.RichTextRun {
+	var runs []excelize.RichTextRun
+	if c.Text != "" {
+		runs = append(runs, excelize.RichTextRun{Text: c.Text})
+	}
+	return append(runs, c.Paragraph...)
+}
+
+// ClearHighlights restores the formatting and notes of the cells that were
+// highlighted or styled as replaced in the workbook and removes the record.
+// Formatting changed since is kept, except for the attributes the highlight
+// had set. It returns the number of restored cells; a workbook without
+// highlights is not saved.
+func ClearHighlights(path, backupDir, baseDir string) (int, error) {
+	return clearWorkbook(path, backupDir, baseDir, clearHighlights)
+}
+
+// clearWorkbook opens a workbook, runs clear on it and saves it if clear
+// found something to undo.
+func clearWorkbook(path, backupDir, baseDir string, clear func(*excelize.File) (int, bool, error)) (int, error) {
+	f, err := excelize.OpenFile(utils.ToExtendedPath(path))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	cleared, found, err := clear(f)
+	if err != nil || !found {
+		return 0, err
+	}
+	if backupDir != "" {
+		if _, err := utils.BackupFile(path, baseDir, backupDir); err != nil {
+			return 0, fmt.Errorf("backup failed: %w", err)
+		}
+	}
+	if err := utils.SaveExcelSafe(f, path); err != nil {
+		return 0, fmt.Errorf("failed to save file: %w", err)
+	}
+	return cleared, nil
+}
+
+// hasSheet reports whether the workbook still has the sheet; recorded cells
+// of sheets that were deleted or renamed are skipped.
+func hasSheet(f *excelize.File, sheet string) bool {
+	idx, err := f.GetSheetIndex(sheet)
+	return err == nil && idx >= 0
+}
+
+// clearHighlights restores the recorded cells of an open workbook; found
+// reports whether the workbook had a record.
+func clearHighlights(f *excelize.File) (cleared int, found bool, err error) {
+	rec, err := loadHighlightRecord(f)
+	if err != nil || len(rec.cells) == 0 {
+		return 0, false, err
+	}
+	type styleKey struct{ current, prior int }
+	restored := make(map[styleKey]int) // Restored style ID
+	for _, rc := range rec.cells {
+		if !hasSheet(f, rc.Sheet) {
+			continue
+		}
+		current, err := f.GetCellStyle(rc.Sheet, rc.Cell)
+		if err != nil {
+			continue
+		}
+		key := styleKey{current, rc.Style}
+		id, ok := restored[key]
+		if !ok {
+			style, err := f.GetStyle(current)
+			if err != nil {
+				return cleared, true, err
+			}
+			rc.prior.restore(style)
+			if id, err = f.NewStyle(style); err != nil {
+				return cleared, true, err
+			}
+			restored[key] = id
+		}
+		if err := f.SetCellStyle(rc.Sheet, rc.Cell, rc.Cell, id); err != nil {
+			return cleared, true, err
+		}
+		if rc.Note != "" {
+			if err := removeNote(f, rc.Sheet, rc.Cell, isText(rc.Note)); err != nil {
+				return cleared, true, err
+			}
+		}
+		cleared++
+	}
+	rec.cells = nil
+	return cleared, true, rec.save(f)
+}
@@ -0,0 +1,143 @@
+package excel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Run identifies one run of the tool in the notes it adds to cells.
+type Run struct {
+	ID      string // e.g. "20261017_153045"
+	Started time.Time
+}
+
+// NewRun returns the run started at t. Its ID is the start time in the format
+// of the {timestamp} of report names.
+func NewRun(t time.Time) Run {
+	return Run{ID: t.Format("20060102_150405"), Started: t}
+}
+
+// OldValueNote returns the note that keeps the previous value of a replaced
+// cell (see Options.NoteOld).
+func (r Run) OldValueNote(old string) string {
+	return fmt.Sprintf("旧: %s (%s run %s)", old, r.Started.Format("2006-01-02"), r.ID)
+}
+
+// NoteProperty is the custom document property that records the old value
+// notes this tool added (see ClearNotes).
+const NoteProperty = "ExcelConverterNotes"
+
+// noteRecord is the content of NoteProperty. A cell replaced in several runs
+// has one note per run.
+type noteRecord struct {
+	Version int            `json:"v"`
+	Notes   []recordedNote `json:"notes"`
+}
+
+// recordedNote identifies a note by a hash of its text, so that the previous
+// values are not copied into the document properties.
+type recordedNote struct {
+	Sheet string `json:"s"`
+	Cell  string `json:"c"`
+	Hash  string `json:"h"` // noteHash of the note text
+}
+
+// isNote reports whether text is the recorded note.
+func (n recordedNote) isNote(text string) bool {
+	return noteHash(text) == n.Hash
+}
+
+func noteHash(note string) string {
+	sum := sha256.Sum256([]byte(note))
+	return hex.EncodeToString(sum[:8])
+}
+
+func loadNoteRecord(f *excelize.File) (*noteRecord, error) {
+	rec := &noteRecord{Version: 1}
+	if _, err := loadRecord(f, NoteProperty, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// save stores the record in the workbook, or removes the property when no
+// note is recorded.
+func (r *noteRecord) save(f *excelize.File) error {
+	if len(r.Notes) == 0 {
+		return SetCustomProperty(f, NoteProperty, "")
+	}
+	return saveRecord(f, NoteProperty, r)
+}
+
+// add appends note to the note of the cell and records it.
+func (r *noteRecord) add(f *excelize.File, sheet, cell, note string) error {
+	if err := addNote(f, sheet, cell, note); err != nil {
+		return err
+	}
+	r.Notes = append(r.Notes, recordedNote{Sheet: sheet, Cell: cell, Hash: noteHash(note)})
+	return nil
+}
+
+// ClearNotes removes the notes this tool added to the workbook: the old value
+// notes of replaced cells and the comments of highlighted and styled cells.
+// Notes written by people are kept, also where the tool appended to them, and
+// so is the formatting. It returns the number of removed notes; a workbook
+// without such notes is not saved.
+func ClearNotes(path, backupDir, baseDir string) (int, error) {
+	return clearWorkbook(path, backupDir, baseDir, clearNotes)
+}
+
+// clearNotes removes the recorded notes of an open workbook; found reports
+// whether the workbook had any.
+func clearNotes(f *excelize.File) (removed int, found bool, err error) {
+	rec, err := loadNoteRecord(f)
+	if err != nil {
+		return 0, false, err
+	}
+	hl, err := loadHighlightRecord(f)
+	if err != nil {
+		return 0, false, err
+	}
+	highlightNotes := 0
+	for _, rc := range hl.cells {
+		if rc.Note != "" {
+			highlightNotes++
+		}
+	}
+	if len(rec.Notes) == 0 && highlightNotes == 0 {
+		return 0, false, nil
+	}
+
+	for _, n := range rec.Notes {
+		if !hasSheet(f, n.Sheet) {
+			continue
+		}
+		if err := removeNote(f, n.Sheet, n.Cell, n.isNote); err != nil {
+			return removed, true, err
+		}
+		removed++
+	}
+	rec.Notes = nil
+	if err := rec.save(f); err != nil {
+		return removed, true, err
+	}
+	if highlightNotes == 0 {
+		return removed, true, nil
+	}
+	for i := range hl.cells {
+		rc := &hl.cells[i]
+		if rc.Note == "" || !hasSheet(f, rc.Sheet) {
+			continue
+		}
+		if err := removeNote(f, rc.Sheet, rc.Cell, isText(rc.Note)); err != nil {
+			return removed, true, err
+		}
+		rc.Note = ""
+		removed++
+	}
+	return removed, true, hl.save(f)
+}
@@ -0,0 +1,287 @@
+package excel
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Scope restricts processing to some sheets and cells. Cells outside the scope
+// are neither searched nor modified. The zero value covers every cell.
+type Scope struct {
+	Sheets        []string // Only these sheets: exact names, or regular expressions as "re:..." or "/.../" (empty = all)
+	ExcludeSheets []string // Skip these sheets: exact names or regular expressions (see Sheets)
+	// A1-style ranges, optionally for matching sheets only: "B5:H200", "C",
+	// "C:E", "3:10" or "変更履歴!A:C". A sheet without a range covers all cells.
+	Ranges []string
+	// Only the columns with these header texts (white space is ignored); the
+	// header row is found automatically unless given in HeaderRows.
+	Columns []string
+	// Header row numbers, optionally for matching sheets only: "3" or "一覧!2".
+	HeaderRows []string
+	// Row conditions that must all hold, e.g. `B == "完了"` (see Condition).
+	Conditions []string
+
+	SkipHiddenSheets  bool
+	SkipHiddenRows    bool
+	SkipHiddenColumns bool
+}
+
+// Active reports whether the scope excludes anything.
+func (s Scope) Active() bool {
+	return len(s.Sheets) > 0 || len(s.ExcludeSheets) > 0 || len(s.Ranges) > 0 || len(s.Columns) > 0 || len(s.Conditions) > 0 || s.SkipsHidden()
+}
+
+// SkipsHidden reports whether the scope depends on hidden sheets, rows or columns.
+func (s Scope) SkipsHidden() bool {
+	return s.SkipHiddenSheets || s.SkipHiddenRows || s.SkipHiddenColumns
+}
+
+// String describes the scope for reports.
+func (s Scope) String() string {
+	var parts, hidden []string
+	if len(s.Sheets) > 0 {
+		parts = append(parts, "sheets "+strings.Join(s.Sheets, ", "))
+	}
+	if len(s.ExcludeSheets) > 0 {
+		parts = append(parts, "excluding "+strings.Join(s.ExcludeSheets, ", "))
+	}
+	if len(s.Ranges) > 0 {
+		parts = append(parts, "ranges "+strings.Join(s.Ranges, ", "))
+	}
+	if len(s.Columns) > 0 {
+		parts = append(parts, "columns "+strings.Join(s.Columns, ", "))
+	}
+	if len(s.HeaderRows) > 0 {
+		parts = append(parts, "header rows "+strings.Join(s.HeaderRows, ", "))
+	}
+	if len(s.Conditions) > 0 {
+		parts = append(parts, "where "+strings.Join(s.Conditions, " and "))
+	}
+	for _, h := range []struct {
+		skip bool
+		name string
+	}{{s.SkipHiddenSheets, "sheets"}, {s.SkipHiddenRows, "rows"}, {s.SkipHiddenColumns, "columns"}} {
+		if h.skip {
+			hidden = append(hidden, h.name)
+		}
+	}
+	if len(hidden) > 0 {
+		parts = append(parts, "no hidden "+strings.Join(hidden, "/"))
+	}
+	if len(parts) == 0 {
+		return "all cells"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Filter compiles the sheet patterns and ranges of the scope.
+func (s Scope) Filter() (*ScopeFilter, error) {
+	f := &ScopeFilter{}
+	var err error
+	if f.include, err = compileSheetPatterns(s.Sheets); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileSheetPatterns(s.ExcludeSheets); err != nil {
+		return nil, err
+	}
+	for _, r := range s.Ranges {
+		sr, err := parseSheetRange(r)
+		if err != nil {
+			return nil, err
+		}
+		f.ranges = append(f.ranges, sr)
+	}
+	for _, c := range s.Columns {
+		if normalizeHeader(c) == "" {
+			return nil, fmt.Errorf("empty column title")
+		}
+		f.columns = append(f.columns, c)
+	}
+	for _, h := range s.HeaderRows {
+		sh, err := parseHeaderRow(h)
+		if err != nil {
+			return nil, err
+		}
+		f.headerRows = append(f.headerRows, sh)
+	}
+	if f.conditions, err = ParseConditions(s.Conditions); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ScopeFilter decides which sheets and cells a Scope covers. Sheet and Ranges
+// only need names and coordinates; columns by header text need the leading
+// rows of the sheet (see Layout), and hidden sheets, rows and columns are
+// checked while the workbook is read.
+type ScopeFilter struct {
+	include, exclude []sheetPattern
+	ranges           []sheetRange
+	columns          []string
+	headerRows       []sheetHeader
+	conditions       []*Condition
+}
+
+// Sheet reports whether the sheet is in scope.
+func (f *ScopeFilter) Sheet(name string) bool {
+	if len(f.include) > 0 && !matchSheet(f.include, name) {
+		return false
+	}
+	return !matchSheet(f.exclude, name)
+}
+
+// Ranges returns a function that reports whether a cell (1-based row and
+// column) of the sheet is in scope.
+func (f *ScopeFilter) Ranges(sheet string) func(row, col int) bool {
+	var ranges []cellRange
+	for _, r := range f.ranges {
+		if r.sheet == nil || r.sheet.match(sheet) {
+			ranges = append(ranges, r.cells)
+		}
+	}
+	if len(ranges) == 0 {
+		return func(row, col int) bool { return true }
+	}
+	return func(row, col int) bool {
+		for _, r := range ranges {
+			if r.contains(row, col) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sheetPattern matches a sheet by its name, ignoring letter case as Excel
+// does, or, when the pattern is written as "re:expr" or "/expr/", by the
+// regular expression. Sheet names can contain neither ':' nor '/', so the
+// markers never clash with a name.
+type sheetPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func (p sheetPattern) match(sheet string) bool {
+	if p.re != nil {
+		return p.re.MatchString(sheet)
+	}
+	return strings.EqualFold(sheet, p.name)
+}
+
+func compileSheetPatterns(patterns []string) ([]sheetPattern, error) {
+	var compiled []sheetPattern
+	for _, p := range patterns {
+		if p == "" {
+			return nil, fmt.Errorf("empty sheet pattern")
+		}
+		expr, isRegexp := strings.CutPrefix(p, "re:")
+		if !isRegexp && len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr, isRegexp = p[1:len(p)-1], true
+		}
+		if !isRegexp {
+			compiled = append(compiled, sheetPattern{name: p})
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("sheet pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, sheetPattern{name: p, re: re})
+	}
+	return compiled, nil
+}
+
+func matchSheet(patterns []sheetPattern, sheet string) bool {
+	for _, p := range patterns {
+		if p.match(sheet) {
+			return true
+		}
+	}
+	return false
+}
+
+// cellRange is a rectangle of 1-based rows and columns; 0 means unbounded.
+type cellRange struct {
+	row1, col1, row2, col2 int
+}
+
+func (r cellRange) contains(row, col int) bool {
+	return (r.row1 == 0 || row >= r.row1) && (r.row2 == 0 || row <= r.row2) &&
+		(r.col1 == 0 || col >= r.col1) && (r.col2 == 0 || col <= r.col2)
+}
+
+type sheetRange struct {
+	sheet *sheetPattern // nil = all sheets
+	cells cellRange
+}
+
+// parseSheetRange parses "[sheet pattern!]range".
+func parseSheetRange(s string) (sheetRange, error) {
+	var sr sheetRange
+	ref := s
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		patterns, err := compileSheetPatterns([]string{s[:i]})
+		if err != nil {
+			return sr, fmt.Errorf("range %q: %w", s, err)
+		}
+		sr.sheet = &patterns[0]
+		ref = s[i+1:]
+	}
+	cells, err := parseRange(ref)
+	if err != nil {
+		return sr, fmt.Errorf("range %q: %w", s, err)
+	}
+	sr.cells = cells
+	return sr, nil
+}
+
+// parseRange parses an A1 reference: a cell ("B5"), a column ("C"), a row
+// ("3") or a range of one of these kinds ("B5:H200", "C:E", "3:10").
+func parseRange(ref string) (cellRange, error) {
+	ref = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(ref), "$", ""))
+	first, last, found := strings.Cut(ref, ":")
+	if !found {
+		last = first
+	}
+	c1, r1, kind1, err := parseRef(first)
+	if err != nil {
+		return cellRange{}, err
+	}
+	c2, r2, kind2, err := parseRef(last)
+	if err != nil {
+		return cellRange{}, err
+	}
+	if kind1 != kind2 {
+		return cellRange{}, fmt.Errorf("mixed cell, column and row references")
+	}
+	if c1 > c2 {
+		c1, c2 = c2, c1
+	}
+	if r1 > r2 {
+		r1, r2 = r2, r1
+	}
+	return cellRange{row1: r1, col1: c1, row2: r2, col2: c2}, nil
+}
+
+// parseRef parses one end of a range; kind is 'c' (cell), 'C' (column) or 'R' (row).
+func parseRef(ref string) (col, row int, kind byte, err error) {
+	if ref == "" {
+		return 0, 0, 0, fmt.Errorf("empty reference")
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid row %q", ref)
+		}
+		return 0, n, 'R', nil
+	}
+	if strings.Trim(ref, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		col, err := excelize.ColumnNameToNumber(ref)
+		return col, 0, 'C', err
+	}
+	col, row, err = excelize.CellNameToCoordinates(ref)
+	return col, row, 'c', err
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/index"
+	"excel_converter/processor"
+	"excel_converter/replacer"
+	"excel_converter/report"
+	"excel_converter/utils"
+)
+
+// runConfig holds everything needed for one search or replace run.
+type runConfig struct {
+	Log        io.Writer // Console messages (default: stdout, or stderr for grep and JSON runs)
+	Name       string    // Job name, for the combined summary
+	Dir        string
+	Search     string
+	Replace    string
+	SearchOnly bool
+	DictPath   string
+	Format     string
+	BackupDir  string
+	Confirm    func(files int) bool  // Asked before modifying files; nil means no confirmation
+	Grep       *report.GrepFormatter // Print hits grep-style to stdout (messages go to stderr)
+	NoReport   bool                  // Don't write a report file
+	Header     bool                  // Record column headers as context
+	RowContext bool                  // Record the row of each hit as context
+
+	Rules      []replacer.Rule // Used instead of Search/Replace when set
+	Filter     processor.FileFilter
+	FileList   string // Explicit list of workbooks ("-" = stdin) used instead of scanning Dir
+	IndexPath  string // Search from (and update) this index instead of reading every file
+	Preview    bool   // Print the resolved file list before processing
+	ReportDir  string // Default: Dir
+	ReportName string // Report file name template (see report.ReportName)
+	Encoding   string // CSV/TSV report encoding
+	Fallback   string // Replacement for characters the encoding lacks
+
+	AllowFormulas bool // Write CSV/TSV values verbatim (see report.EscapeFormula)
+	PerOccurrence bool // One report row per match instead of per cell
+
+	Limit replacer.Limit // Replace only some occurrences (replace mode)
+	Scope excel.Scope    // Sheets, ranges and hidden cells to leave out
+
+	Verbose bool // Report hits in rows whose condition is false
+
+	Highlight *excel.Highlight // Highlight the hits instead of replacing them
+	Style     *excel.Highlight // Style of replaced cells (nil = excel.DefaultReplaceStyle)
+	NoteOld   bool             // Note the previous value on replaced cells
+	ChangeLog string           // Sheet listing the replaced cells in each workbook ("" = none)
+	Operator  string           // Operator in the change log (default: the current user)
+}
+
+// runSummary is the outcome of one run, used for the combined summary of job files.
+type runSummary struct {
+	Name        string
+	Mode        string // "search", "replace" or "highlight"
+	Files       int
+	Hits        int
+	Occurrences int
+	FailedFiles int
+	ReportPath  string
+	Duration    time.Duration
+	Code        int
+}
+
+// execute runs a search or replace over cfg.Dir, writes the report and prints
+// the summary. It returns one of the Exit* codes.
+func execute(cfg runConfig) int {
+	return executeRun(cfg).Code
+}
+
+func executeRun(cfg runConfig) runSummary {
+	sum := runSummary{Name: cfg.Name, Mode: cfg.mode(), Code: ExitError}
+
+	// In grep mode stdout carries only the hits; everything else goes to stderr
+	// The same applies to the JSON formats, which print the run summary to stdout.
+	out := io.Writer(os.Stdout)
+	jsonSummary := cfg.Format == "json" || cfg.Format == "jsonl"
+	switch {
+	case cfg.Log != nil:
+		out = cfg.Log
+	case cfg.Grep != nil || jsonSummary:
+		out = os.Stderr
+	}
+
+	// A dictionary replaces the single search/replace pair
+	rules := cfg.Rules
+	if rules == nil {
+		rules = []replacer.Rule{{Search: cfg.Search, Replace: cfg.Replace}}
+	}
+	if cfg.DictPath != "" {
+		dictRules, err := replacer.LoadDictionary(cfg.DictPath)
+		if err != nil {
+			fmt.Fprintf(out, "Error loading dictionary: %v\n", err)
+			return sum
+		}
+		rules = dictRules
+	}
+	rep, err := replacer.New(rules)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return sum
+	}
+
+	searchOnly := cfg.SearchOnly
+	highlight := cfg.Highlight != nil && !searchOnly
+	if searchOnly {
+		fmt.Fprintln(out, "Mode: Search Only")
+	} else if highlight {
+		fmt.Fprintln(out, "Mode: Highlight")
+	} else {
+		fmt.Fprintln(out, "Mode: Replace")
+	}
+
+	rootDir := cfg.Dir
+	if cfg.FileList != "" {
+		fmt.Fprintf(out, "File List: %s\n", cfg.FileList)
+	} else {
+		fmt.Fprintf(out, "Target Directory: %s\n", rootDir)
+	}
+	if cfg.DictPath != "" {
+		fmt.Fprintf(out, "Dictionary: %s (%d entries)\n", cfg.DictPath, len(rules))
+	} else if cfg.Rules != nil {
+		fmt.Fprintf(out, "Pairs: %d\n", len(rules))
+	} else {
+		fmt.Fprintf(out, "Search: %s\n", cfg.Search)
+		if !searchOnly && !highlight {
+			fmt.Fprintf(out, "Replace: %s\n", cfg.Replace)
+		}
+	}
+	if cfg.Limit.Active() && !searchOnly && !highlight {
+		fmt.Fprintf(out, "Limit: %s\n", cfg.Limit)
+	}
+	if highlight {
+		fmt.Fprintf(out, "Highlight: %s\n", cfg.Highlight)
+	} else if !searchOnly {
+		fmt.Fprintf(out, "Style: %s\n", cfg.style())
+	}
+	if cfg.NoteOld && cfg.mode() == "replace" {
+		fmt.Fprintln(out, "Notes: previous values")
+	}
+	if cfg.ChangeLog != "" && cfg.mode() == "replace" {
+		fmt.Fprintf(out, "Change Log: %s\n", cfg.ChangeLog)
+	}
+	if cfg.Scope.Active() {
+		fmt.Fprintf(out, "Scope: %s\n", cfg.Scope)
+	}
+	fmt.Fprintln(out, "--------------------------------------------------")
+
+	// 3. Force Close Excel
+	fmt.Fprintln(out, "Closing Excel processes...")
+	if err := utils.ForceCloseExcel(); err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+
+	// 4. Collect Files
+	fmt.Fprintln(out, "Scanning for Excel files...")
+	files, skipped, err := selectFilesSkipped(rootDir, cfg.Filter, cfg.FileList, out)
+	if err != nil {
+		fmt.Fprintf(out, "Error scanning files: %v\n", err)
+		return sum
+	}
+	totalFiles := len(files)
+	sum.Files = totalFiles
+	if cfg.Preview {
+		for _, path := range files {
+			fmt.Fprintf(out, "  %s\n", path)
+		}
+	}
+	fmt.Fprintf(out, "Found %d Excel files.\n", totalFiles)
+	fmt.Fprintln(out, "--------------------------------------------------")
+
+	if totalFiles == 0 {
+		fmt.Fprintln(out, "No Excel files found.")
+		if jsonSummary {
+			info := cfg.runInfo(cfg.options(rep, out, excel.NewRun(time.Now())))
+			report.WriteSummaryJSON(os.Stdout, nil, info.Summary(0, &processor.Result{}, skipped), "")
+		}
+		sum.Code = ExitOK
+		return sum
+	}
+
+	if !searchOnly && cfg.Confirm != nil && !cfg.Confirm(totalFiles) {
+		fmt.Fprintln(out, "Cancelled.")
+		return sum
+	}
+
+	// 5. Process Files
+	startTime := time.Now()
+	fmt.Fprintln(out, "Processing files...")
+
+	// Simple Progress Bar
+	// [====================] 100% (50/50)
+
+	progress := func(current, total int, path string, workerCounts map[int]int) {
+		if cfg.Grep != nil {
+			return
+		}
+		percent := float64(current) / float64(total) * 100
+		barLength := 50
+		filledLength := int(float64(barLength) * percent / 100)
+		bar := strings.Repeat("=", filledLength) + strings.Repeat(" ", barLength-filledLength)
+
+		// \r to overwrite line
+		fmt.Fprintf(out, "\r[%s] %.1f%% (%d/%d) %s", bar, percent, current, total, filepath.Base(path))
+		// Clear rest of line if filename is shorter than previous
+		fmt.Fprint(out, "                                        ")
+	}
+
+	opts := cfg.options(rep, out, excel.NewRun(startTime))
+	scope, err := cfg.Scope.Filter()
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return sum
+	}
+	var result *processor.Result
+	if cfg.IndexPath != "" {
+		// Bring the index up to date; only changed files are reopened
+		ix, err := index.Load(cfg.IndexPath)
+		if err != nil {
+			fmt.Fprintf(out, "Error loading index: %v\n", err)
+			return sum
+		}
+		stats := ix.Update(files, progress)
+		fmt.Fprintln(out)
+		if err := ix.Save(cfg.IndexPath); err != nil {
+			fmt.Fprintf(out, "Warning: could not save index: %v\n", err)
+		}
+		fmt.Fprintf(out, "Index: %d unchanged, %d reopened, %d unreadable\n", stats.Unchanged+stats.Touched, stats.Reread, len(stats.Errors))
+		switch {
+		case searchOnly && (cfg.Scope.SkipsHidden() || len(cfg.Scope.Conditions) > 0):
+			fmt.Fprintln(out, "The index does not record hidden cells or evaluate row conditions; searching the live files.")
+		case searchOnly:
+			result = &processor.Result{Changes: ix.Search(files, rep, scope, cfg.Header || len(cfg.Scope.Columns) > 0, cfg.RowContext), FileErrors: stats.Errors}
+			result.TotalReplacements = len(result.Changes)
+			result.TotalOccurrences = report.Occurrences(result.Changes)
+		default:
+			// Replace re-verifies every candidate against the live file
+			files = ix.Candidates(files, rep)
+			fmt.Fprintf(out, "%d files contain matches according to the index.\n", len(files))
+		}
+	}
+	// CSV, TSV and JSON Lines reports are written while the files are processed,
+	// so the changes never have to fit in memory at once
+	reportOpts := cfg.reportOptions()
+	var stream *report.StreamWriter
+	if result == nil && !cfg.NoReport && cfg.Grep == nil && report.Streamable(cfg.Format) {
+		if stream, err = report.NewStreamWriter(reportOpts); err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			return sum
+		}
+	}
+	if result == nil {
+		// Ctrl+C stops after the files in progress and still writes the report;
+		// a second Ctrl+C terminates immediately
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+		if stream != nil {
+			result, err = processor.ProcessFilesToSink(ctx, files, opts, stream, progress)
+		} else {
+			var changes report.Collector
+			result, err = processor.ProcessFilesToSink(ctx, files, opts, &changes, progress)
+			if result != nil {
+				result.Changes = changes.Changes
+			}
+		}
+		stop()
+		fmt.Fprintln(out) // New line after progress bar
+	}
+
+	if err != nil {
+		fmt.Fprintf(out, "Error processing files: %v\n", err)
+		if stream != nil {
+			stream.Abort()
+		}
+		return sum
+	}
+	if result.Cancelled {
+		fmt.Fprintf(out, "Interrupted: %d of %d files processed. The report covers the processed files only.\n", result.Processed, len(files))
+	}
+
+	duration := time.Since(startTime)
+	sum.Duration = duration
+	sum.Hits = result.TotalReplacements
+	sum.Occurrences = result.TotalOccurrences
+	sum.FailedFiles = len(result.FileErrors)
+
+	// 6. Generate Report
+	if cfg.Grep != nil {
+		cfg.Grep.Find = func(value string) [][2]int {
+			var spans [][2]int
+			for _, m := range rep.Find(value) {
+				spans = append(spans, [2]int{m.Start, m.End})
+			}
+			return spans
+		}
+		if err := cfg.Grep.Write(os.Stdout, result.Changes); err != nil {
+			fmt.Fprintf(out, "Error writing output: %v\n", err)
+		}
+	}
+	runSum := cfg.runInfo(opts).Summary(totalFiles, result, skipped)
+	if stream != nil {
+		counts := stream.Counts()
+		runSum.Counts = &counts
+	}
+	substituted := 0
+	if cfg.NoReport {
+		// Hits were printed above
+	} else if processor.WantsReport(cfg.Format, result) {
+		var written report.Output
+		if stream != nil {
+			written, err = stream.Finish(runSum)
+		} else {
+			written, err = report.Generate(result.Changes, runSum, reportOpts)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error generating report: %v\n", err)
+		} else {
+			fmt.Fprintf(out, "Report generated: %s\n", written.Path)
+			sum.ReportPath = written.Path
+			substituted = written.Substituted
+		}
+	} else {
+		if stream != nil {
+			stream.Abort()
+		}
+		fmt.Fprintln(out, "No changes made.")
+	}
+
+	// 7. Stats
+	fmt.Fprintln(out, "--------------------------------------------------")
+	fmt.Fprintln(out, "Execution Summary:")
+	fmt.Fprintf(out, "  Time Elapsed:      %v\n", duration)
+	fmt.Fprintf(out, "  Files Processed:   %d\n", totalFiles)
+	if searchOnly {
+		fmt.Fprintf(out, "  Total Hits:        %d cells, %d occurrences\n", result.TotalReplacements, result.TotalOccurrences)
+	} else if highlight {
+		fmt.Fprintf(out, "  Total Highlighted: %d cells, %d occurrences\n", result.TotalReplacements, result.TotalOccurrences)
+	} else {
+		fmt.Fprintf(out, "  Total Replacements: %d cells, %d occurrences\n", result.TotalReplacements, result.TotalOccurrences)
+	}
+	if result.Skipped > 0 {
+		fmt.Fprintf(out, "  Skipped:           %d cells (occurrence limit or row condition)\n", result.Skipped)
+	}
+	if len(result.FileErrors) > 0 {
+		fmt.Fprintf(out, "  Failed Files:      %d\n", len(result.FileErrors))
+	}
+	if substituted > 0 {
+		fmt.Fprintf(out, "  Substituted Chars: %d (not representable in the report encoding)\n", substituted)
+	}
+	if cfg.BackupDir != "" && !searchOnly {
+		fmt.Fprintf(out, "  Backup Directory:  %s\n", cfg.BackupDir)
+	}
+	fmt.Fprintln(out, "--------------------------------------------------")
+	fmt.Fprintln(out, "Done.")
+	if jsonSummary {
+		if err := report.WriteSummaryJSON(os.Stdout, result.Changes, runSum, sum.ReportPath); err != nil {
+			fmt.Fprintf(out, "Error writing summary: %v\n", err)
+		}
+	}
+
+	switch {
+	case len(result.FileErrors) > 0 || result.Cancelled:
+		sum.Code = ExitPartialFailure
+	case searchOnly && result.TotalReplacements > 0:
+		sum.Code = ExitHitsFound
+	default:
+		sum.Code = ExitOK
+	}
+	return sum
+}
+
+// mode returns the report mode of the run: "search", "replace" or "highlight".
+func (cfg runConfig) mode() string {
+	switch {
+	case cfg.SearchOnly:
+		return "search"
+	case cfg.Highlight != nil:
+		return "highlight"
+	}
+	return "replace"
+}
+
+// style returns the style of replaced cells.
+func (cfg runConfig) style() excel.Highlight {
+	if cfg.Style != nil {
+		return *cfg.Style
+	}
+	return excel.DefaultReplaceStyle
+}
+
+// reportOptions says where and how the report of the run is written.
+func (cfg runConfig) reportOptions() report.Options {
+	opts := report.Options{
+		Format:   cfg.Format,
+		Dir:      cfg.ReportDir,
+		Name:     cfg.ReportName,
+		Encoding: cfg.Encoding,
+		Fallback: cfg.Fallback,
+		Job:      cfg.Name,
+
+		PerOccurrence: cfg.PerOccurrence,
+		AllowFormulas: cfg.AllowFormulas,
+		Header:        cfg.Header || len(cfg.Scope.Columns) > 0,
+	}
+	if opts.Dir == "" {
+		opts.Dir = cfg.Dir
+	}
+	opts.Mode = cfg.mode()
+	return opts
+}
+
+// options are the processing options of the run.
+func (cfg runConfig) options(rep *replacer.Replacer, log io.Writer, run excel.Run) excel.Options {
+	return excel.Options{
+		Replacer:   rep,
+		SearchOnly: cfg.SearchOnly,
+		Log:        log,
+		BackupDir:  cfg.BackupDir,
+		BaseDir:    cfg.Dir,
+		Header:     cfg.Header,
+		RowContext: cfg.RowContext,
+		Limit:      cfg.Limit,
+		Scope:      cfg.Scope,
+		Verbose:    cfg.Verbose,
+		Highlight:  cfg.Highlight,
+		Style:      cfg.Style,
+		NoteOld:    cfg.NoteOld,
+		Run:        run,
+		ChangeLog:  cfg.ChangeLog,
+		Operator:   cfg.Operator,
+	}
+}
+
+// runInfo describes the run for the report summary.
+func (cfg runConfig) runInfo(opts excel.Options) processor.RunInfo {
+	info := processor.RunInfo{Target: cfg.Dir, Job: cfg.Name, Options: opts}
+	if cfg.FileList != "" {
+		info.Target = cfg.FileList
+	}
+	switch {
+	case cfg.DictPath != "":
+		info.Dictionary = cfg.DictPath
+	case cfg.Rules != nil:
+		info.Pairs = len(cfg.Rules)
+	default:
+		info.Search, info.Replace = cfg.Search, cfg.Replace
+	}
+	return info
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"excel_converter/excel"
+	"excel_converter/processor"
+)
+
+// stringList is a flag that can be repeated or given as a comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// exprList is a flag that can be repeated; each value is kept whole.
+type exprList []string
+
+func (l *exprList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *exprList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// addFilterFlags registers the file selection flags on fs. The returned function
+// builds the filter after fs.Parse.
+func addFilterFlags(fs *flag.FlagSet) func() (processor.FileFilter, error) {
+	var include, exclude, excludeDirs, excludeExts stringList
+	fs.Var(&include, "include", "Only process files matching this glob (relative path, ** allowed; repeatable)")
+	fs.Var(&exclude, "exclude", "Skip files/directories matching this glob (repeatable)")
+	fs.Var(&excludeDirs, "exclude-dir", "Skip this directory (repeatable)")
+	fs.Var(&excludeExts, "exclude-ext", "Skip files with this extension, e.g. .xlsm (repeatable)")
+	noIgnore := fs.Bool("no-ignore-file", false, "Don't honor "+processor.DefaultIgnoreFile+" files")
+	maxDepth := fs.Int("max-depth", 0, "Maximum directory depth (1 = only the top directory, 0 = unlimited)")
+	minSize := fs.String("min-size", "", "Minimum file size, e.g. 10KB")
+	maxSize := fs.String("max-size", "", "Maximum file size, e.g. 50MB")
+	since := fs.String("modified-since", "", "Only files modified on or after this date (YYYY-MM-DD)")
+	before := fs.String("modified-before", "", "Only files modified before this date (YYYY-MM-DD)")
+	follow := fs.Bool("follow-symlinks", false, "Follow symbolic links to directories")
+
+	return func() (processor.FileFilter, error) {
+		filter := processor.FileFilter{
+			ExcludeExtensions: excludeExts,
+			ExcludeDirs:       excludeDirs,
+			Include:           include,
+			Exclude:           exclude,
+			IgnoreFile:        processor.DefaultIgnoreFile,
+			MaxDepth:          *maxDepth,
+			FollowSymlinks:    *follow,
+		}
+		if *noIgnore {
+			filter.IgnoreFile = ""
+		}
+		var err error
+		if filter.MinSize, err = processor.ParseSize(*minSize); err != nil {
+			return filter, err
+		}
+		if filter.MaxSize, err = processor.ParseSize(*maxSize); err != nil {
+			return filter, err
+		}
+		if filter.ModifiedSince, err = processor.ParseDate(*since); err != nil {
+			return filter, err
+		}
+		if filter.ModifiedBefore, err = processor.ParseDate(*before); err != nil {
+			return filter, err
+		}
+		return filter, nil
+	}
+}
+
+// addScopeFlags registers the sheet and cell selection flags on fs. The
+// returned function builds the scope after fs.Parse.
+func addScopeFlags(fs *flag.FlagSet) func() (excel.Scope, error) {
+	var sheets, excludeSheets, ranges, columns, headerRows stringList
+	var conditions exprList
+	fs.Var(&sheets, "sheet", "Only process the sheet with this name, or the sheets matching re:REGEXP or /REGEXP/ (repeatable)")
+	fs.Var(&excludeSheets, "exclude-sheet", "Skip the sheet with this name, or the sheets matching re:REGEXP or /REGEXP/, e.g. re:^old_ (repeatable)")
+	fs.Var(&ranges, "range", "Only process these cells: B5:H200, C, C:E, 3:10, optionally per sheet as SHEET!RANGE (repeatable)")
+	fs.Var(&columns, "column", "Only process the columns with this header text, e.g. ステータス (repeatable; the report shows the header)")
+	fs.Var(&headerRows, "header-row", "Header row for -column, optionally per sheet as SHEET!ROW (default: found automatically)")
+	fs.Var(&conditions, "where", "Only process rows where this condition holds, e.g. 'B == \"完了\"', '[ステータス] =~ ^済', 'row contains ★' (repeatable; all must hold)")
+	hiddenSheets := fs.Bool("skip-hidden-sheets", false, "Skip hidden sheets")
+	hiddenRows := fs.Bool("skip-hidden-rows", false, "Skip hidden rows")
+	hiddenCols := fs.Bool("skip-hidden-columns", false, "Skip hidden columns")
+
+	return func() (excel.Scope, error) {
+		scope := excel.Scope{
+			Sheets:            sheets,
+			ExcludeSheets:     excludeSheets,
+			Ranges:            ranges,
+			Columns:           columns,
+			HeaderRows:        headerRows,
+			Conditions:        conditions,
+			SkipHiddenSheets:  *hiddenSheets,
+			SkipHiddenRows:    *hiddenRows,
+			SkipHiddenColumns: *hiddenCols,
+		}
+		_, err := scope.Filter()
+		return scope, err
+	}
+}
+
+// addFileListFlag registers -files-from on fs.
+func addFileListFlag(fs *flag.FlagSet) *string {
+	return fs.String("files-from", "", "Process the workbooks listed in this file instead of scanning -dir (newline or NUL separated, - = stdin)")
+}
+
+// selectFiles returns the files to process: the explicit list when listPath is
+// set, otherwise the files under dir selected by filter. Listed paths that can
+// not be processed are reported to out with the reason.
+func selectFiles(dir string, filter processor.FileFilter, listPath string, out io.Writer) ([]string, error) {
+	files, _, err := selectFilesSkipped(dir, filter, listPath, out)
+	return files, err
+}
+
+// selectFilesSkipped is selectFiles that also returns the skipped listed
+// paths, for the report.
+func selectFilesSkipped(dir string, filter processor.FileFilter, listPath string, out io.Writer) ([]string, []processor.SkippedFile, error) {
+	if listPath == "" {
+		files, err := processor.CollectTargetFilesWithFilter(dir, filter)
+		return files, nil, err
+	}
+	var paths []string
+	var err error
+	if listPath == "-" {
+		paths, err = processor.ReadFileList(os.Stdin)
+	} else {
+		paths, err = processor.LoadFileList(listPath)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading file list: %w", err)
+	}
+	files, skipped := processor.CheckFileList(paths, "")
+	for _, s := range skipped {
+		fmt.Fprintf(out, "Skipped: %s (%s)\n", s.Path, s.Reason)
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "Skipped %d of %d listed files.\n", len(skipped), len(paths))
+	}
+	return files, skipped, nil
+}
@@ -0,0 +1,238 @@
+package glossary
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+
+	"excel_converter/excel"
+	"excel_converter/processor"
+	"excel_converter/replacer"
+)
+
+// Term is a canonical spelling and the variants that should be normalized to it.
+type Term struct {
+	Canonical string
+	Variants  []string
+}
+
+// Forms returns the canonical spelling followed by its variants.
+func (t Term) Forms() []string {
+	return append([]string{t.Canonical}, t.Variants...)
+}
+
+// Load reads a glossary from a CSV, TSV or XLSX file.
+//
+// Each row is "canonical, variant1, variant2, ...". A first row whose first
+// cell is "canonical" or "正" is treated as a header; rows starting with "#"
+// are ignored. If widthVariants is true, full-width and half-width forms of
+// every spelling are added as variants as well.
+func Load(path string, widthVariants bool) ([]Term, error) {
+	rows, err := replacer.ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filepath.Base(path), rows, widthVariants)
+}
+
+// Parse converts table rows into terms. name is used in error messages.
+func Parse(name string, rows [][]string, widthVariants bool) ([]Term, error) {
+	var terms []Term
+	seen := make(map[string]string) // form -> canonical, to catch ambiguous glossaries
+	for i, row := range rows {
+		line := i + 1
+		var cells []string
+		for _, c := range row {
+			if c = strings.TrimSpace(c); c != "" {
+				cells = append(cells, c)
+			}
+		}
+		if len(cells) == 0 || strings.HasPrefix(cells[0], "#") {
+			continue
+		}
+		if i == 0 && isHeader(cells[0]) {
+			continue
+		}
+
+		term := Term{Canonical: cells[0]}
+		add := func(form string) error {
+			if prev, ok := seen[form]; ok {
+				if prev == term.Canonical {
+					return nil
+				}
+				return fmt.Errorf("%s:%d: %q is already listed under %q", name, line, form, prev)
+			}
+			seen[form] = term.Canonical
+			if form != term.Canonical {
+				term.Variants = append(term.Variants, form)
+			}
+			return nil
+		}
+		if err := add(term.Canonical); err != nil {
+			return nil, err
+		}
+		for _, v := range cells[1:] {
+			if err := add(v); err != nil {
+				return nil, err
+			}
+		}
+		if widthVariants {
+			for _, form := range term.Forms() {
+				for _, v := range []string{narrow(form), widen(form)} {
+					if _, ok := seen[v]; !ok {
+						add(v)
+					}
+				}
+			}
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%s: no terms found", name)
+	}
+	return terms, nil
+}
+
+// width does not convert dakuten/handakuten, so map the combining marks (NFD)
+// to their half-width forms and back explicitly.
+var (
+	toHalfWidthMarks = strings.NewReplacer("\u3099", "\uFF9E", "\u309A", "\uFF9F")
+	toCombiningMarks = strings.NewReplacer("\uFF9E", "\u3099", "\uFF9F", "\u309A", "\u309B", "\u3099", "\u309C", "\u309A")
+)
+
+// narrow returns the half-width form of s (e.g. "ＤＢ" → "DB", "サーバー" → "ｻｰﾊﾞｰ").
+func narrow(s string) string {
+	return width.Narrow.String(toHalfWidthMarks.Replace(norm.NFD.String(s)))
+}
+
+// widen returns the full-width form of s (e.g. "DB" → "ＤＢ", "ｻｰﾊﾞｰ" → "サーバー").
+func widen(s string) string {
+	return norm.NFC.String(width.Widen.String(toCombiningMarks.Replace(s)))
+}
+
+func isHeader(cell string) bool {
+	switch strings.ToLower(cell) {
+	case "canonical", "term", "正", "正規表記":
+		return true
+	}
+	return false
+}
+
+// Hit is one cell containing a glossary spelling.
+type Hit struct {
+	FilePath  string
+	Sheet     string
+	Cell      string
+	Value     string
+	Canonical string
+	Form      string
+	Count     int
+}
+
+// Result is the outcome of an audit.
+type Result struct {
+	Terms  []Term
+	Files  []string
+	Hits   []Hit
+	Counts map[string]map[string]int // file -> form -> occurrences
+}
+
+// Total returns the number of occurrences of form across all files.
+func (r *Result) Total(form string) int {
+	n := 0
+	for _, counts := range r.Counts {
+		n += counts[form]
+	}
+	return n
+}
+
+// FoundVariants returns, per term, the variants that occur at least once.
+func (r *Result) FoundVariants() []Term {
+	var out []Term
+	for _, t := range r.Terms {
+		found := Term{Canonical: t.Canonical}
+		for _, v := range t.Variants {
+			if r.Total(v) > 0 {
+				found.Variants = append(found.Variants, v)
+			}
+		}
+		if len(found.Variants) > 0 {
+			out = append(out, found)
+		}
+	}
+	return out
+}
+
+// Rules returns replace rules that normalize the given variants to their canonical spelling.
+// Canonical spellings are included as no-op rules so that a longer canonical form
+// (e.g. "サーバー") is never partially rewritten by a shorter variant (e.g. "サーバ").
+func Rules(terms []Term) []replacer.Rule {
+	var rules []replacer.Rule
+	for _, t := range terms {
+		rules = append(rules, replacer.Rule{Search: t.Canonical, Replace: t.Canonical})
+		for _, v := range t.Variants {
+			rules = append(rules, replacer.Rule{Search: v, Replace: t.Canonical, Label: v + " → " + t.Canonical})
+		}
+	}
+	return rules
+}
+
+// Audit scans the files read-only and counts every spelling of every term.
+func Audit(files []string, terms []Term, onProgress func(current, total int, path string, workerCounts map[int]int)) (*Result, error) {
+	canonicalOf := make(map[string]string)
+	var rules []replacer.Rule
+	for _, t := range terms {
+		for _, form := range t.Forms() {
+			canonicalOf[form] = t.Canonical
+			rules = append(rules, replacer.Rule{Search: form, Replace: form, Label: form})
+		}
+	}
+	rep, err := replacer.New(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := excel.Options{Replacer: rep, SearchOnly: true, Log: io.Discard}
+	result, err := processor.ProcessFilesWithOptions(files, opts, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	changes := result.Changes
+
+	res := &Result{Terms: terms, Files: append([]string(nil), files...), Counts: make(map[string]map[string]int)}
+	sort.Strings(res.Files)
+	for _, c := range changes {
+		perForm := make(map[string]int)
+		var order []string
+		for _, m := range rep.Find(c.OldValue) {
+			if perForm[m.Rule.Search] == 0 {
+				order = append(order, m.Rule.Search)
+			}
+			perForm[m.Rule.Search]++
+		}
+		if res.Counts[c.FilePath] == nil {
+			res.Counts[c.FilePath] = make(map[string]int)
+		}
+		for _, form := range order {
+			res.Counts[c.FilePath][form] += perForm[form]
+			res.Hits = append(res.Hits, Hit{
+				FilePath:  c.FilePath,
+				Sheet:     c.Sheet,
+				Cell:      c.Cell,
+				Value:     c.OldValue,
+				Canonical: canonicalOf[form],
+				Form:      form,
+				Count:     perForm[form],
+			})
+		}
+	}
+	sort.SliceStable(res.Hits, func(i, j int) bool {
+		return res.Hits[i].FilePath < res.Hits[j].FilePath
+	})
+	return res, nil
+}
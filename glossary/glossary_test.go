@@ -0,0 +1,67 @@
+package glossary
+
+import (
+	"testing"
+
+	"excel_converter/replacer"
+)
+
+func TestParse_WidthVariants(t *testing.T) {
+	terms, err := Parse("g.csv", [][]string{
+		{"canonical", "variants"},
+		{"サーバー", "サーバ"},
+		{"ＤＢ"},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(terms) != 2 {
+		t.Fatalf("expected 2 terms, got %d", len(terms))
+	}
+
+	want := map[string]bool{"サーバ": true, "ｻｰﾊﾞｰ": true, "ｻｰﾊﾞ": true}
+	for _, v := range terms[0].Variants {
+		delete(want, v)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing variants %v in %v", want, terms[0].Variants)
+	}
+	if len(terms[1].Variants) != 1 || terms[1].Variants[0] != "DB" {
+		t.Errorf("expected half-width variant DB, got %v", terms[1].Variants)
+	}
+}
+
+func TestParse_AmbiguousVariant(t *testing.T) {
+	_, err := Parse("g.csv", [][]string{{"ユーザー", "ユーザ"}, {"利用者", "ユーザ"}}, false)
+	if err == nil {
+		t.Fatal("expected an error for a variant listed under two terms")
+	}
+}
+
+func TestRules_NormalizeWithoutPartialRewrite(t *testing.T) {
+	r, err := replacer.New(Rules([]Term{{Canonical: "サーバー", Variants: []string{"サーバ"}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Replace("サーバとサーバー"); got != "サーバーとサーバー" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestResult_Matrix(t *testing.T) {
+	res := &Result{
+		Terms:  []Term{{Canonical: "サーバー", Variants: []string{"サーバ"}}},
+		Files:  []string{"a.xlsx", "b.xlsx"},
+		Counts: map[string]map[string]int{"a.xlsx": {"サーバー": 2, "サーバ": 1}},
+	}
+	rows := res.matrix()
+	if len(rows) != 4 {
+		t.Fatalf("expected header, 2 files and total, got %d rows", len(rows))
+	}
+	if got := rows[1]; got[1] != "2" || got[2] != "1" || got[3] != "1" {
+		t.Errorf("unexpected row for a.xlsx: %v", got)
+	}
+	if got := rows[2]; got[1] != "0" || got[3] != "0" {
+		t.Errorf("unexpected row for b.xlsx: %v", got)
+	}
+}
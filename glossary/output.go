@@ -0,0 +1,164 @@
+package glossary
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"excel_converter/report"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// matrix returns the files × spellings table: a header row and one row per file.
+// Each term contributes one column per spelling; a term total column follows them.
+func (r *Result) matrix() [][]string {
+	header := []string{"File Path"}
+	for _, t := range r.Terms {
+		for _, form := range t.Forms() {
+			label := form
+			if form != t.Canonical {
+				label = fmt.Sprintf("%s (→%s)", form, t.Canonical)
+			}
+			header = append(header, label)
+		}
+		header = append(header, fmt.Sprintf("%s 揺れ計", t.Canonical))
+	}
+	rows := [][]string{header}
+
+	addRow := func(name string, count func(form string) int) {
+		row := []string{name}
+		for _, t := range r.Terms {
+			for _, form := range t.Forms() {
+				row = append(row, fmt.Sprint(count(form)))
+			}
+			variants := 0
+			for _, v := range t.Variants {
+				variants += count(v)
+			}
+			row = append(row, fmt.Sprint(variants))
+		}
+		rows = append(rows, row)
+	}
+	for _, file := range r.Files {
+		counts := r.Counts[file]
+		addRow(file, func(form string) int { return counts[form] })
+	}
+	addRow("合計", r.Total)
+	return rows
+}
+
+// WriteReport writes the audit summary into outputDir and returns its path.
+// format is "xlsx" (Matrix and Locations sheets) or "csv"/"tsv" (matrix only).
+func (r *Result) WriteReport(outputDir, format string) (string, error) {
+	timestamp := time.Now().Format("20060102_150405")
+	switch format {
+	case "xlsx":
+		path := filepath.Join(outputDir, fmt.Sprintf("notation_audit_%s.xlsx", timestamp))
+		return path, r.writeXLSX(path)
+	case "tsv":
+		path := filepath.Join(outputDir, fmt.Sprintf("notation_audit_%s.tsv", timestamp))
+		return path, writeCSV(path, '\t', r.matrix())
+	default:
+		path := filepath.Join(outputDir, fmt.Sprintf("notation_audit_%s.csv", timestamp))
+		return path, writeCSV(path, ',', r.matrix())
+	}
+}
+
+// WriteDictionary writes a replace dictionary (variant → canonical) for the variants
+// that were found. Users can delete rows they don't want and pass the file to -dict.
+func (r *Result) WriteDictionary(outputDir string) (string, error) {
+	timestamp := time.Now().Format("20060102_150405")
+	path := filepath.Join(outputDir, fmt.Sprintf("normalize_dictionary_%s.csv", timestamp))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	// UTF-8 with BOM so that both Excel and LoadDictionary read it correctly
+	if _, err := file.WriteString("\xEF\xBB\xBF"); err != nil {
+		file.Close()
+		return "", err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"search", "replace", "options"})
+	for _, t := range r.FoundVariants() {
+		w.Write([]string{t.Canonical, t.Canonical, ""})
+		for _, v := range t.Variants {
+			w.Write([]string{v, t.Canonical, ""})
+		}
+	}
+	w.Flush()
+	err = w.Error()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return path, err
+}
+
+func writeCSV(path string, separator rune, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// Same encoding as the replacement report. Closing the encoder writes the
+	// rest of the buffered output.
+	enc, err := report.NewTextWriter(file, report.EncodingCP932, "")
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w := csv.NewWriter(enc)
+	w.Comma = separator
+	for _, row := range rows {
+		for i := range row {
+			row[i] = report.EscapeFormula(row[i])
+		}
+	}
+	err = w.WriteAll(rows)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (r *Result) writeXLSX(path string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	f.SetSheetName("Sheet1", "Matrix")
+	for i, row := range r.matrix() {
+		for j, v := range row {
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if i > 0 && j > 0 {
+				n, _ := strconv.Atoi(v)
+				f.SetCellValue("Matrix", cell, n)
+			} else {
+				f.SetCellValue("Matrix", cell, v)
+			}
+		}
+	}
+
+	if _, err := f.NewSheet("Locations"); err != nil {
+		return err
+	}
+	f.SetSheetRow("Locations", "A1", &[]string{"File Path", "Sheet", "Cell", "Term", "Found", "Count", "Value"})
+	for i, h := range r.Hits {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		f.SetSheetRow("Locations", cell, &[]interface{}{h.FilePath, h.Sheet, h.Cell, h.Canonical, h.Form, h.Count, h.Value})
+	}
+
+	for _, sheet := range []string{"Matrix", "Locations"} {
+		f.SetPanes(sheet, &excelize.Panes{Freeze: true, XSplit: 1, YSplit: 1, TopLeftCell: "B2", ActivePane: "bottomRight"})
+		f.SetColWidth(sheet, "A", "A", 60)
+	}
+	return f.SaveAs(path)
+}
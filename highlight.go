@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"excel_converter/excel"
+	"excel_converter/utils"
+)
+
+// addHighlightFlags registers the style flags of highlighted or replaced
+// cells on fs. The returned function builds the style after fs.Parse; without
+// a formatting flag it has the formatting of def.
+func addHighlightFlags(fs *flag.FlagSet, def excel.Highlight) func() (*excel.Highlight, error) {
+	fontColor := fs.String("font-color", "", "Font color of styled cells as RRGGBB, e.g. C00000")
+	fill := fs.String("fill", "", "Background color of styled cells as RRGGBB, e.g. FFFF00")
+	bold := fs.Bool("bold", false, "Make styled cells bold")
+	italic := fs.Bool("italic", false, "Make styled cells italic")
+	underline := fs.Bool("underline", false, "Underline styled cells")
+	none := fs.Bool("no-style", false, "Leave the formatting of the cells unchanged (without any formatting flag: "+def.String()+")")
+	comment := fs.String("comment", "", "Add this note to styled cells (appended to existing notes)")
+
+	return func() (*excel.Highlight, error) {
+		h := excel.Highlight{FontColor: *fontColor, Fill: *fill, Bold: *bold, Italic: *italic, Underline: *underline, Comment: *comment}
+		if *none {
+			if h.Formats() {
+				return nil, fmt.Errorf("-no-style can not be combined with formatting flags")
+			}
+			return &h, nil
+		}
+		h = h.WithDefault(def)
+		return &h, h.Validate()
+	}
+}
+
+// runHighlight implements the "highlight" command: like search, but the hits
+// are marked in the workbooks, which are saved.
+func runHighlight(args []string) int {
+	fs := flag.NewFlagSet("highlight", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to search in")
+	searchFlag := fs.String("search", "", "Text to search for")
+	dictFlag := fs.String("dict", "", "Dictionary file (CSV/TSV/XLSX); all search terms are highlighted at once")
+	formatFlag := fs.String("format", "csv", "Output format (csv, tsv, xlsx, html, json or jsonl; json/jsonl also print the summary to stdout)")
+	backupFlag := fs.String("backup-dir", "", "Copy each file here before overwriting it (restore with 'restore')")
+	yesFlag := fs.Bool("yes", false, "Do not ask for confirmation")
+	previewFlag := fs.Bool("preview", false, "List the selected files before asking for confirmation")
+	highlightFlags := addHighlightFlags(fs, excel.DefaultHighlight)
+	reportOpts := addReportFlags(fs)
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	scopeFlags := addScopeFlags(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	scope, err := scopeFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	highlight, err := highlightFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	switch {
+	case highlight.Empty():
+		fmt.Fprintln(os.Stderr, "Error: nothing to highlight (-no-style needs -comment)")
+		return ExitError
+	case *searchFlag == "" && *dictFlag == "":
+		fmt.Fprintln(os.Stderr, "Error: -search or -dict is required")
+		return ExitError
+	case *searchFlag != "" && *dictFlag != "":
+		fmt.Fprintln(os.Stderr, "Error: -dict and -search can not be combined")
+		return ExitError
+	}
+
+	printBanner(*formatFlag)
+	cfg := runConfig{
+		Dir:       *dirFlag,
+		Search:    *searchFlag,
+		DictPath:  *dictFlag,
+		Format:    *formatFlag,
+		BackupDir: *backupFlag,
+		Filter:    filter,
+		FileList:  *filesFromFlag,
+		Preview:   *previewFlag,
+		Scope:     scope,
+		Highlight: highlight,
+	}
+	if err := reportOpts.apply(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if !*yesFlag {
+		cfg.Confirm = func(files int) bool {
+			return confirm(fmt.Sprintf("%d files may be overwritten. Continue?", files))
+		}
+	}
+	return execute(cfg)
+}
+
+// runClearHighlights implements the "clear-highlights" command: the cells
+// highlighted or replaced by earlier runs get their previous formatting and
+// notes back.
+func runClearHighlights(args []string) int {
+	return runClear("clear-highlights", args, "Remove the highlights in %d files?", "cells", "restored", excel.ClearHighlights)
+}
+
+// runClearNotes implements the "clear-notes" command: the notes added by
+// earlier runs are removed; notes written by people and the formatting stay.
+func runClearNotes(args []string) int {
+	return runClear("clear-notes", args, "Remove the notes added by this tool in %d files?", "notes", "removed", excel.ClearNotes)
+}
+
+// runClear runs clear on the selected workbooks. question is the format of
+// the confirmation; clear returns the number of units it restored or removed.
+func runClear(name string, args []string, question, unit, verb string, clear func(path, backupDir, baseDir string) (int, error)) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to clear")
+	backupFlag := fs.String("backup-dir", "", "Copy each file here before overwriting it (restore with 'restore')")
+	yesFlag := fs.Bool("yes", false, "Do not ask for confirmation")
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	files, err := selectFiles(*dirFlag, filter, *filesFromFlag, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning files: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("Excel Converter v%s\n", Version)
+	fmt.Printf("Found %d Excel files.\n", len(files))
+	if len(files) == 0 {
+		return ExitOK
+	}
+	if !*yesFlag && !confirm(fmt.Sprintf(question, len(files))) {
+		fmt.Println("Cancelled.")
+		return ExitError
+	}
+	if err := utils.ForceCloseExcel(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	var workbooks, total, failed int
+	for _, path := range files {
+		n, err := clear(path, *backupFlag, *dirFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		if n > 0 {
+			fmt.Printf("Cleared: %s (%d %s)\n", path, n, unit)
+			workbooks++
+			total += n
+		}
+	}
+	fmt.Printf("%d %s %s in %d files.\n", total, unit, verb, workbooks)
+	if failed > 0 {
+		fmt.Printf("Failed Files: %d\n", failed)
+		return ExitPartialFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"excel_converter/index"
+)
+
+// indexPath returns the index file for a root directory: file if set, otherwise the default location.
+func indexPath(dir, file string) string {
+	if file != "" {
+		return file
+	}
+	return index.DefaultPath(dir)
+}
+
+// runIndex implements "index build", "index status" and "index prune".
+func runIndex(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: excel_converter index build|status|prune [-dir DIR] [-index-file FILE] [file selection flags]")
+		return ExitError
+	}
+	action := args[0]
+	switch action {
+	case "build", "status", "prune":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown index command %q (build, status or prune)\n", action)
+		return ExitError
+	}
+
+	fs := flag.NewFlagSet("index "+action, flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to index")
+	indexFileFlag := fs.String("index-file", "", "Index file (default: DIR/"+index.DefaultName+")")
+	rebuildFlag := fs.Bool("rebuild", false, "With build, discard the existing index and read every file again")
+	filterFlags := addFilterFlags(fs)
+	filesFromFlag := addFileListFlag(fs)
+	fs.Parse(args[1:])
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	path := indexPath(*dirFlag, *indexFileFlag)
+	ix, err := index.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading index: %v\n", err)
+		return ExitError
+	}
+	files, err := selectFiles(*dirFlag, filter, *filesFromFlag, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning files: %v\n", err)
+		return ExitError
+	}
+
+	switch action {
+	case "build":
+		if *rebuildFlag {
+			ix = index.New()
+		}
+		fmt.Printf("Indexing %d Excel files into %s...\n", len(files), path)
+		stats := ix.Update(files, func(current, total int, p string, workerCounts map[int]int) {
+			fmt.Printf("\r(%d/%d) %s                                        ", current, total, filepath.Base(p))
+		})
+		fmt.Println()
+		for _, fe := range stats.Errors {
+			fmt.Printf("Error reading %s: %v\n", fe.Path, fe.Err)
+		}
+		if err := ix.Save(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving index: %v\n", err)
+			return ExitError
+		}
+		fmt.Printf("Unchanged: %d, touched: %d, reopened: %d, unreadable: %d\n", stats.Unchanged, stats.Touched, stats.Reread, len(stats.Errors))
+		fmt.Printf("Index: %d files, %d cells\n", len(ix.Files), ix.CellCount())
+		if len(stats.Errors) > 0 {
+			return ExitPartialFailure
+		}
+
+	case "status":
+		counts := make(map[string]int)
+		for _, s := range ix.Status(files) {
+			counts[s.State]++
+			if s.State != "indexed" {
+				fmt.Printf("%-8s %s\n", s.State, s.Path)
+			}
+		}
+		fmt.Printf("Index: %s (%d files, %d cells)\n", path, len(ix.Files), ix.CellCount())
+		fmt.Printf("Up to date: %d, modified: %d, new: %d, deleted: %d\n", counts["indexed"], counts["modified"], counts["new"], counts["deleted"])
+
+	case "prune":
+		removed := ix.Prune(files)
+		for _, p := range removed {
+			fmt.Printf("Removed %s\n", p)
+		}
+		if err := ix.Save(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving index: %v\n", err)
+			return ExitError
+		}
+		fmt.Printf("Removed %d entries; %d files remain in the index.\n", len(removed), len(ix.Files))
+	}
+	return ExitOK
+}
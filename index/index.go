@@ -0,0 +1,453 @@
+// Package index keeps an on-disk index of the cell text of workbooks, so that
+// repeated searches over a large tree only reopen the files that have changed.
+package index
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/processor"
+	"excel_converter/replacer"
+	"excel_converter/report"
+	"excel_converter/utils"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// DefaultName is the file name of the index when no path is given.
+const DefaultName = ".excel_converter.index"
+
+// formatVersion is bumped whenever the stored layout changes; older indexes are rebuilt.
+const formatVersion = 1
+
+// Index is the cell text of a set of workbooks, keyed by absolute path.
+type Index struct {
+	Version int
+	Files   map[string]*Entry
+}
+
+// Entry is one indexed workbook. Size, ModTime and Hash identify the content
+// the cells were read from.
+type Entry struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string // SHA-256 of the file content
+	Indexed time.Time
+	Sheets  []Sheet
+}
+
+// Sheet holds the non-empty cells of a sheet in row-major order.
+type Sheet struct {
+	Name  string
+	Cells []Cell
+}
+
+// Cell is a non-empty cell. Row and Col are 1-based.
+type Cell struct {
+	Row, Col int
+	Text     string
+}
+
+// Stats is the outcome of Update.
+type Stats struct {
+	Unchanged int // Size and modification time match
+	Touched   int // Modification time changed but the content hash did not
+	Reread    int // Changed or new files that were reopened
+	Errors    []processor.FileError
+}
+
+// DefaultPath returns the default index location for a root directory.
+func DefaultPath(rootDir string) string {
+	return filepath.Join(rootDir, DefaultName)
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{Version: formatVersion, Files: make(map[string]*Entry)}
+}
+
+// Load reads an index file. A missing file, or one written by an incompatible
+// version, yields an empty index.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	ix := New()
+	if err := gob.NewDecoder(zr).Decode(ix); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if ix.Version != formatVersion || ix.Files == nil {
+		return New(), nil
+	}
+	return ix, nil
+}
+
+// Save writes the index to path, replacing the previous file only once the
+// new one is complete.
+func (ix *Index) Save(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	err = gob.NewEncoder(zw).Encode(ix)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// key returns the map key of a workbook path.
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Update brings the entries of files up to date. Files whose size and
+// modification time are unchanged are not opened; otherwise the content hash
+// decides whether the cells have to be read again.
+func (ix *Index) Update(files []string, onProgress func(current, total int, path string, workerCounts map[int]int)) Stats {
+	var stats Stats
+	type result struct {
+		path     string
+		entry    *Entry
+		reread   bool
+		err      error
+		workerID int
+	}
+
+	jobs := make(chan string, len(files))
+	results := make(chan result, len(files))
+	var mu sync.Mutex // Guards ix.Files while workers look up previous entries
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		workerID := i
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				mu.Lock()
+				old := ix.Files[key(path)]
+				mu.Unlock()
+				entry, reread, err := refresh(path, old)
+				results <- result{path: path, entry: entry, reread: reread, err: err, workerID: workerID}
+			}
+		}()
+	}
+	for _, path := range files {
+		jobs <- path
+	}
+	close(jobs)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	processed := 0
+	workerCounts := make(map[int]int)
+	for res := range results {
+		processed++
+		workerCounts[res.workerID]++
+		if onProgress != nil {
+			onProgress(processed, len(files), res.path, workerCounts)
+		}
+		mu.Lock()
+		old := ix.Files[key(res.path)]
+		switch {
+		case res.err != nil:
+			stats.Errors = append(stats.Errors, processor.FileError{Path: res.path, Err: res.err})
+			delete(ix.Files, key(res.path))
+		case res.reread:
+			stats.Reread++
+			ix.Files[key(res.path)] = res.entry
+		case old != nil && !old.ModTime.Equal(res.entry.ModTime):
+			stats.Touched++
+			ix.Files[key(res.path)] = res.entry
+		default:
+			stats.Unchanged++
+		}
+		mu.Unlock()
+	}
+	return stats
+}
+
+// refresh returns the up-to-date entry for path and whether the workbook was reopened.
+func refresh(path string, old *Entry) (*Entry, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if old != nil && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+		return old, false, nil
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if old != nil && old.Hash == hash {
+		touched := *old
+		touched.Size, touched.ModTime = info.Size(), info.ModTime()
+		return &touched, false, nil
+	}
+	sheets, err := readSheets(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Entry{Size: info.Size(), ModTime: info.ModTime(), Hash: hash, Indexed: time.Now(), Sheets: sheets}, true, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readSheets reads the non-empty cells of every sheet, like the search in the excel package.
+func readSheets(path string) ([]Sheet, error) {
+	f, err := excelize.OpenFile(utils.ToExtendedPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sheets []Sheet
+	for _, name := range f.GetSheetList() {
+		rows, err := f.GetRows(name)
+		if err != nil {
+			continue // Skip sheets we can't read
+		}
+		sheet := Sheet{Name: name}
+		for r, row := range rows {
+			for c, v := range row {
+				if v != "" {
+					sheet.Cells = append(sheet.Cells, Cell{Row: r + 1, Col: c + 1, Text: v})
+				}
+			}
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
+
+// Search answers a search from the index. The changes are the ones a live
+// search of the same files would record (status "Found"). Files that are not
+// indexed are ignored, so call Update first. A non-nil scope limits the search
+// to its sheets, ranges and columns; the index does not know which sheets, rows
+// and columns are hidden.
+func (ix *Index) Search(files []string, rep *replacer.Replacer, scope *excel.ScopeFilter, header, rowContext bool) []report.Change {
+	var changes []report.Change
+	if scope == nil {
+		scope, _ = excel.Scope{}.Filter()
+	}
+	for _, path := range files {
+		entry := ix.Files[key(path)]
+		if entry == nil {
+			continue
+		}
+		for _, sheet := range entry.Sheets {
+			if !scope.Sheet(sheet.Name) {
+				continue
+			}
+			layout := scope.Layout(sheet.Name, sheet.leadingRows(scope.HeaderRowLimit(sheet.Name)))
+			if layout.Empty() {
+				continue
+			}
+			inRange := scope.Ranges(sheet.Name)
+			for i, cell := range sheet.Cells {
+				if !inRange(cell.Row, cell.Col) || !layout.Contains(cell.Row, cell.Col) {
+					continue
+				}
+				matches := rep.Find(cell.Text)
+				if len(matches) == 0 {
+					continue
+				}
+				cellName, _ := excelize.CoordinatesToCellName(cell.Col, cell.Row)
+				change := report.Change{
+					FilePath: path,
+					Sheet:    sheet.Name,
+					Cell:     cellName,
+					OldValue: cell.Text,
+					NewValue: cell.Text,
+					Status:   "Found",
+					Entry:    replacer.Labels(matches),
+
+					Occurrences: len(matches),
+					Matches:     excel.MatchOffsets(cell.Text, matches),
+				}
+				change.NewMatches = change.Matches
+				if header {
+					change.Header = layout.Header(cell.Row, cell.Col)
+				}
+				if rowContext {
+					change.RowText = sheet.rowText(i)
+				}
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// Candidates returns the files whose indexed cells contain a match. Files that
+// are not indexed are kept, so that they are checked against the live file.
+func (ix *Index) Candidates(files []string, rep *replacer.Replacer) []string {
+	var candidates []string
+	for _, path := range files {
+		entry := ix.Files[key(path)]
+		if entry == nil || entry.hasMatch(rep) {
+			candidates = append(candidates, path)
+		}
+	}
+	return candidates
+}
+
+func (e *Entry) hasMatch(rep *replacer.Replacer) bool {
+	for _, sheet := range e.Sheets {
+		for _, cell := range sheet.Cells {
+			if len(rep.Find(cell.Text)) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leadingRows returns the first n rows of the sheet the way excelize's GetRows
+// does (without trailing empty cells).
+func (s Sheet) leadingRows(n int) [][]string {
+	var rows [][]string
+	for _, c := range s.Cells {
+		if c.Row > n {
+			break
+		}
+		for len(rows) < c.Row {
+			rows = append(rows, nil)
+		}
+		row := rows[c.Row-1]
+		for len(row) < c.Col {
+			row = append(row, "")
+		}
+		row[c.Col-1] = c.Text
+		rows[c.Row-1] = row
+	}
+	return rows
+}
+
+// rowText joins the cells of the row of Cells[i], like the excel package does for context.
+func (s Sheet) rowText(i int) string {
+	row := s.Cells[i].Row
+	start := i
+	for start > 0 && s.Cells[start-1].Row == row {
+		start--
+	}
+	var cells []string
+	for j := start; j < len(s.Cells) && s.Cells[j].Row == row; j++ {
+		cells = append(cells, s.Cells[j].Text)
+	}
+	return strings.Join(cells, " | ")
+}
+
+// FileStatus is the state of one workbook relative to the index.
+type FileStatus struct {
+	Path  string
+	State string // "indexed", "modified", "new" or "deleted"
+}
+
+// Status compares files with the index using size and modification time only.
+// Indexed paths that are not in files and no longer exist are reported as "deleted".
+func (ix *Index) Status(files []string) []FileStatus {
+	var statuses []FileStatus
+	listed := make(map[string]bool)
+	for _, path := range files {
+		listed[key(path)] = true
+		entry := ix.Files[key(path)]
+		state := "indexed"
+		if entry == nil {
+			state = "new"
+		} else if info, err := os.Stat(path); err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+			state = "modified"
+		}
+		statuses = append(statuses, FileStatus{Path: path, State: state})
+	}
+	var deleted []string
+	for path := range ix.Files {
+		if listed[path] {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(deleted)
+	for _, path := range deleted {
+		statuses = append(statuses, FileStatus{Path: path, State: "deleted"})
+	}
+	return statuses
+}
+
+// Prune removes the entries of workbooks that are not in files and returns
+// the removed paths.
+func (ix *Index) Prune(files []string) []string {
+	keep := make(map[string]bool)
+	for _, path := range files {
+		keep[key(path)] = true
+	}
+	var removed []string
+	for path := range ix.Files {
+		if !keep[path] {
+			removed = append(removed, path)
+			delete(ix.Files, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// CellCount returns the number of indexed cells.
+func (ix *Index) CellCount() int {
+	n := 0
+	for _, e := range ix.Files {
+		for _, s := range e.Sheets {
+			n += len(s.Cells)
+		}
+	}
+	return n
+}
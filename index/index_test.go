@@ -0,0 +1,106 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/replacer"
+)
+
+func testIndex(path string) *Index {
+	ix := New()
+	ix.Files[key(path)] = &Entry{Sheets: []Sheet{{
+		Name: "仕様",
+		Cells: []Cell{
+			{Row: 1, Col: 1, Text: "項目"}, {Row: 1, Col: 2, Text: "内容"},
+			{Row: 2, Col: 1, Text: "機能A"}, {Row: 2, Col: 2, Text: "旧仕様に準拠"},
+		},
+	}}}
+	return ix
+}
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.xlsx")
+	ix := testIndex(path)
+	rep, _ := replacer.NewSingle("旧仕様", "")
+
+	changes := ix.Search([]string{path}, rep, nil, true, true)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(changes))
+	}
+	c := changes[0]
+	if c.Sheet != "仕様" || c.Cell != "B2" || c.Status != "Found" || c.NewValue != c.OldValue {
+		t.Errorf("unexpected change: %+v", c)
+	}
+	if c.Header != "内容" || c.RowText != "機能A | 旧仕様に準拠" {
+		t.Errorf("unexpected context: %q %q", c.Header, c.RowText)
+	}
+
+	scope, err := excel.Scope{Columns: []string{"項目"}}.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.Search([]string{path}, rep, scope, true, false); len(got) != 0 {
+		t.Errorf("column 項目 has no hit, got %d", len(got))
+	}
+
+	other := filepath.Join(filepath.Dir(path), "b.xlsx")
+	none, _ := replacer.NewSingle("該当なし", "")
+	if got := ix.Candidates([]string{path, other}, none); len(got) != 1 || got[0] != other {
+		t.Errorf("candidates: got %v, want only the unindexed file", got)
+	}
+}
+
+func TestUpdate_TouchedFileIsNotReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.xlsx")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := hashFile(path)
+	ix := testIndex(path)
+	entry := ix.Files[key(path)]
+	entry.Size, entry.Hash = 7, hash
+	entry.ModTime = time.Now().Add(-time.Hour) // Touched since it was indexed
+
+	// The file is not a real workbook, so reopening it would fail
+	stats := ix.Update([]string{path}, nil)
+	if stats.Touched != 1 || stats.Reread != 0 || len(stats.Errors) != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats = ix.Update([]string{path}, nil); stats.Unchanged != 1 {
+		t.Errorf("second update: %+v", stats)
+	}
+	if len(ix.Files[key(path)].Sheets) != 1 {
+		t.Error("cells of a touched file must be kept")
+	}
+}
+
+func TestSaveLoadPrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.xlsx")
+	ix := testIndex(path)
+	ix.Files[key(filepath.Join(dir, "gone.xlsx"))] = &Entry{}
+
+	indexFile := DefaultPath(dir)
+	if err := ix.Save(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Files) != 2 || loaded.CellCount() != 4 {
+		t.Fatalf("round trip: %d files, %d cells", len(loaded.Files), loaded.CellCount())
+	}
+
+	statuses := loaded.Status([]string{path})
+	if len(statuses) != 2 || statuses[0].State != "modified" || statuses[1].State != "deleted" {
+		t.Errorf("unexpected status: %+v", statuses)
+	}
+	if removed := loaded.Prune([]string{path}); len(removed) != 1 || len(loaded.Files) != 1 {
+		t.Errorf("prune removed %v", removed)
+	}
+}
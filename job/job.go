@@ -0,0 +1,413 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/processor"
+	"excel_converter/replacer"
+	"excel_converter/report"
+)
+
+// File is a job file: one or more jobs that are run in sequence.
+type File struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Job describes one repeatable search or replace run.
+type Job struct {
+	Name              string   `json:"name,omitempty"`
+	Root              string   `json:"root"`
+	ExcludeExtensions []string `json:"excludeExtensions,omitempty"`
+	ExcludeDir        string   `json:"excludeDir,omitempty"`
+	Files             Files    `json:"files,omitempty"`
+
+	Mode             string `json:"mode"` // "search", "replace" or "highlight"
+	Search           string `json:"search,omitempty"`
+	Replace          string `json:"replace,omitempty"`
+	ReplaceWithEmpty bool   `json:"replaceWithEmpty,omitempty"`
+	IgnoreCase       bool   `json:"ignoreCase,omitempty"`
+	Regex            bool   `json:"regex,omitempty"`
+	WholeCell        bool   `json:"wholeCell,omitempty"`
+	Pairs            []Pair `json:"pairs,omitempty"`      // Inline dictionary
+	Dictionary       string `json:"dictionary,omitempty"` // Dictionary file (CSV/TSV/XLSX)
+	Limit            Limit  `json:"limit,omitempty"`      // Replace only some occurrences
+	Scope            Scope  `json:"scope,omitempty"`      // Sheets and cells to process
+
+	Highlight Highlight `json:"highlight,omitempty"` // Style of highlighted or replaced cells
+	NoteOld   bool      `json:"noteOld,omitempty"`   // Replace: add a note with the previous value to replaced cells
+	ChangeLog string    `json:"changeLog,omitempty"` // Replace: sheet listing the replaced cells in each workbook
+	Operator  string    `json:"operator,omitempty"`  // Operator in the change log (default: the current user)
+
+	Report Report `json:"report,omitempty"`
+	Backup Backup `json:"backup,omitempty"`
+}
+
+// Pair is an inline search/replace pair.
+type Pair struct {
+	Search     string `json:"search"`
+	Replace    string `json:"replace"`
+	IgnoreCase bool   `json:"ignoreCase,omitempty"`
+	Regex      bool   `json:"regex,omitempty"`
+	WholeCell  bool   `json:"wholeCell,omitempty"`
+}
+
+// Limit restricts a replace job to some occurrences (see replacer.Limit).
+type Limit struct {
+	First int    `json:"first,omitempty"` // Only the first N occurrences
+	Nth   int    `json:"nth,omitempty"`   // Only the Nth occurrence
+	Scope string `json:"scope,omitempty"` // "cell" (default), "sheet" or "file"
+	Unit  string `json:"unit,omitempty"`  // "occurrence" (default) or "cell": count the cells with a match
+}
+
+// Highlight is the style highlight jobs apply to the hits and replace jobs to
+// the replaced cells (see excel.Highlight). Without formatting attributes
+// highlighted cells get a yellow fill and replaced cells bold 2980C4 text,
+// unless None is set.
+type Highlight struct {
+	FontColor string `json:"fontColor,omitempty"` // RRGGBB
+	Fill      string `json:"fill,omitempty"`      // RRGGBB
+	Bold      bool   `json:"bold,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	None      bool   `json:"none,omitempty"`    // Leave the formatting unchanged
+	Comment   string `json:"comment,omitempty"` // Note added to the cells
+}
+
+// style returns the excel style, with the formatting of def when none is set.
+func (h Highlight) style(def excel.Highlight) *excel.Highlight {
+	style := excel.Highlight{FontColor: h.FontColor, Fill: h.Fill, Bold: h.Bold, Italic: h.Italic, Underline: h.Underline, Comment: h.Comment}
+	if !h.None {
+		style = style.WithDefault(def)
+	}
+	return &style
+}
+
+// Scope selects the sheets and cells of each workbook (see excel.Scope).
+type Scope struct {
+	Sheets            []string `json:"sheets,omitempty"`        // Sheet names, or regular expressions as "re:..." or "/.../"
+	ExcludeSheets     []string `json:"excludeSheets,omitempty"` // e.g. "re:^old_"
+	Ranges            []string `json:"ranges,omitempty"`        // e.g. "B5:H200", "C" or "変更履歴!A:C"
+	Columns           []string `json:"columns,omitempty"`       // Header texts, e.g. "ステータス"
+	HeaderRows        []string `json:"headerRows,omitempty"`    // e.g. "3" or "一覧!2"; found automatically when empty
+	Conditions        []string `json:"conditions,omitempty"`    // Row conditions, e.g. "B == \"完了\""
+	SkipHiddenSheets  bool     `json:"skipHiddenSheets,omitempty"`
+	SkipHiddenRows    bool     `json:"skipHiddenRows,omitempty"`
+	SkipHiddenColumns bool     `json:"skipHiddenColumns,omitempty"`
+}
+
+// Files holds the file selection rules (see processor.FileFilter).
+type Files struct {
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	ExcludeDirs    []string `json:"excludeDirs,omitempty"`
+	NoIgnoreFile   bool     `json:"noIgnoreFile,omitempty"` // Don't honor .excelignore files
+	MaxDepth       int      `json:"maxDepth,omitempty"`
+	MinSize        string   `json:"minSize,omitempty"` // e.g. "10KB"
+	MaxSize        string   `json:"maxSize,omitempty"` // e.g. "50MB"
+	ModifiedSince  string   `json:"modifiedSince,omitempty"`
+	ModifiedBefore string   `json:"modifiedBefore,omitempty"`
+	FollowSymlinks bool     `json:"followSymlinks,omitempty"`
+}
+
+// Report says where and how the report is written.
+type Report struct {
+	Format string `json:"format,omitempty"` // "csv" (default), "tsv", "xlsx", "html", "json" or "jsonl"
+	Dir    string `json:"dir,omitempty"`    // Default: the job root
+	Name   string `json:"name,omitempty"`   // File name template, e.g. "{job}_{date}.{ext}"
+
+	Encoding string `json:"encoding,omitempty"` // CSV/TSV: "cp932" (default), "shift-jis", "utf-8-bom", "utf-8" or "utf-16le"
+	Fallback string `json:"fallback,omitempty"` // Replacement for characters Shift-JIS lacks, "codepoint" or "error"
+
+	AllowFormulas bool `json:"allowFormulas,omitempty"` // Don't escape CSV/TSV values starting with = + - @
+	PerOccurrence bool `json:"perOccurrence,omitempty"` // One row per match instead of one per cell
+	Verbose       bool `json:"verbose,omitempty"`       // List hits in rows whose condition is false
+}
+
+// Backup is the backup policy for replace jobs.
+type Backup struct {
+	Dir         string `json:"dir,omitempty"`         // No backup when empty
+	Timestamped bool   `json:"timestamped,omitempty"` // Back up into a new Dir/YYYYMMDD_HHMMSS folder each run
+}
+
+// Load reads a job file. Relative paths in the jobs are resolved against the
+// directory of the job file, so job files can be kept next to the documents.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(f.Jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs defined", path)
+	}
+	base := filepath.Dir(path)
+	for i := range f.Jobs {
+		j := &f.Jobs[i]
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job %d", i+1)
+		}
+		j.Root = resolve(base, j.Root)
+		j.ExcludeDir = resolve(base, j.ExcludeDir)
+		for k := range j.Files.ExcludeDirs {
+			j.Files.ExcludeDirs[k] = resolve(base, j.Files.ExcludeDirs[k])
+		}
+		j.Dictionary = resolve(base, j.Dictionary)
+		j.Report.Dir = resolve(base, j.Report.Dir)
+		j.Backup.Dir = resolve(base, j.Backup.Dir)
+		if err := j.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, j.Name, err)
+		}
+	}
+	return &f, nil
+}
+
+// Save writes a job file as indented JSON. An existing file is replaced only
+// if overwrite is set; otherwise the error wraps os.ErrExist.
+func Save(path string, f *File, overwrite bool) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	out, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func resolve(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// Validate checks that the job is complete and consistent.
+func (j *Job) Validate() error {
+	if j.Root == "" {
+		return fmt.Errorf("root is required")
+	}
+	switch j.Mode {
+	case "search", "replace", "highlight":
+	case "":
+		return fmt.Errorf("mode is required (search, replace or highlight)")
+	default:
+		return fmt.Errorf("unknown mode %q", j.Mode)
+	}
+	sources := 0
+	for _, set := range []bool{j.Search != "", len(j.Pairs) > 0, j.Dictionary != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of search, pairs or dictionary is required")
+	}
+	if j.Mode == "replace" && j.Search != "" && j.Replace == "" && !j.ReplaceWithEmpty {
+		return fmt.Errorf("replace is empty (set replaceWithEmpty to delete the matches)")
+	}
+	if _, err := j.Filter(); err != nil {
+		return err
+	}
+	switch j.Report.Format {
+	case "", "csv", "tsv", "xlsx", "html", "json", "jsonl":
+	default:
+		return fmt.Errorf("unknown report format %q", j.Report.Format)
+	}
+	if _, err := report.ParseEncoding(j.Report.Encoding); err != nil {
+		return err
+	}
+	if err := j.ReplaceLimit().Validate(); err != nil {
+		return fmt.Errorf("limit: %w", err)
+	}
+	if _, err := j.CellScope().Filter(); err != nil {
+		return fmt.Errorf("scope: %w", err)
+	}
+	style := j.Highlight.style(excel.Highlight{})
+	if j.Highlight.None && style.Formats() {
+		return fmt.Errorf("highlight: none can not be combined with formatting attributes")
+	}
+	if err := style.Validate(); err != nil {
+		return fmt.Errorf("highlight: %w", err)
+	}
+	if h := j.HighlightStyle(); h != nil && h.Empty() {
+		return fmt.Errorf("highlight: nothing to highlight (none needs a comment)")
+	}
+	if j.ChangeLog != "" {
+		if err := excel.ValidateSheetName(j.ChangeLog); err != nil {
+			return fmt.Errorf("changeLog: %w", err)
+		}
+	}
+	return nil
+}
+
+// HighlightStyle returns the style of a highlight job, or nil for other modes.
+func (j *Job) HighlightStyle() *excel.Highlight {
+	if j.Mode != "highlight" {
+		return nil
+	}
+	return j.Highlight.style(excel.DefaultHighlight)
+}
+
+// ReplaceStyle returns the style of the replaced cells of a replace job, or
+// nil for other modes.
+func (j *Job) ReplaceStyle() *excel.Highlight {
+	if j.Mode != "replace" {
+		return nil
+	}
+	return j.Highlight.style(excel.DefaultReplaceStyle)
+}
+
+// NoteOldValues reports whether replaced cells get a note with their
+// previous value; only replace jobs add notes.
+func (j *Job) NoteOldValues() bool {
+	return j.Mode == "replace" && j.NoteOld
+}
+
+// ChangeLogSheet returns the change log sheet of a replace job, or "" when
+// the job keeps no change log.
+func (j *Job) ChangeLogSheet() string {
+	if j.Mode != "replace" {
+		return ""
+	}
+	return j.ChangeLog
+}
+
+// CellScope returns the sheets and cells the job processes.
+func (j *Job) CellScope() excel.Scope {
+	return excel.Scope{
+		Sheets:            j.Scope.Sheets,
+		ExcludeSheets:     j.Scope.ExcludeSheets,
+		Ranges:            j.Scope.Ranges,
+		Columns:           j.Scope.Columns,
+		HeaderRows:        j.Scope.HeaderRows,
+		Conditions:        j.Scope.Conditions,
+		SkipHiddenSheets:  j.Scope.SkipHiddenSheets,
+		SkipHiddenRows:    j.Scope.SkipHiddenRows,
+		SkipHiddenColumns: j.Scope.SkipHiddenColumns,
+	}
+}
+
+// ReplaceLimit returns the occurrence limit of the job.
+func (j *Job) ReplaceLimit() replacer.Limit {
+	return replacer.Limit{First: j.Limit.First, Nth: j.Limit.Nth, Scope: j.Limit.Scope, Unit: j.Limit.Unit}
+}
+
+// SearchOnly reports whether the job must not modify files.
+func (j *Job) SearchOnly() bool {
+	return j.Mode == "search"
+}
+
+// Rules returns the search/replace rules of the job.
+func (j *Job) Rules() ([]replacer.Rule, error) {
+	switch {
+	case j.Dictionary != "":
+		return replacer.LoadDictionary(j.Dictionary)
+	case len(j.Pairs) > 0:
+		var rules []replacer.Rule
+		for i, p := range j.Pairs {
+			rules = append(rules, replacer.Rule{
+				Search:     p.Search,
+				Replace:    p.Replace,
+				IgnoreCase: p.IgnoreCase,
+				Regex:      p.Regex,
+				WholeCell:  p.WholeCell,
+				Label:      fmt.Sprintf("%s pair %d", j.Name, i+1),
+			})
+		}
+		return rules, nil
+	default:
+		return []replacer.Rule{{
+			Search:     j.Search,
+			Replace:    j.Replace,
+			IgnoreCase: j.IgnoreCase,
+			Regex:      j.Regex,
+			WholeCell:  j.WholeCell,
+		}}, nil
+	}
+}
+
+// Filter returns the file selection rules of the job.
+func (j *Job) Filter() (processor.FileFilter, error) {
+	filter := processor.FileFilter{
+		ExcludeExtensions: j.ExcludeExtensions,
+		ExcludeDirs:       j.Files.ExcludeDirs,
+		Include:           j.Files.Include,
+		Exclude:           j.Files.Exclude,
+		IgnoreFile:        processor.DefaultIgnoreFile,
+		MaxDepth:          j.Files.MaxDepth,
+		FollowSymlinks:    j.Files.FollowSymlinks,
+	}
+	if j.ExcludeDir != "" {
+		filter.ExcludeDirs = append([]string{j.ExcludeDir}, filter.ExcludeDirs...)
+	}
+	if j.Files.NoIgnoreFile {
+		filter.IgnoreFile = ""
+	}
+	var err error
+	if filter.MinSize, err = processor.ParseSize(j.Files.MinSize); err != nil {
+		return filter, err
+	}
+	if filter.MaxSize, err = processor.ParseSize(j.Files.MaxSize); err != nil {
+		return filter, err
+	}
+	if filter.ModifiedSince, err = processor.ParseDate(j.Files.ModifiedSince); err != nil {
+		return filter, err
+	}
+	if filter.ModifiedBefore, err = processor.ParseDate(j.Files.ModifiedBefore); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// ReportDir returns the directory the report is written to.
+func (j *Job) ReportDir() string {
+	if j.Report.Dir != "" {
+		return j.Report.Dir
+	}
+	return j.Root
+}
+
+// ReportOptions returns where and how the report of the job is written.
+func (j *Job) ReportOptions() report.Options {
+	return report.Options{
+		Format:   j.Report.Format,
+		Dir:      j.ReportDir(),
+		Name:     j.Report.Name,
+		Encoding: j.Report.Encoding,
+		Fallback: j.Report.Fallback,
+		Mode:     j.Mode,
+		Job:      j.Name,
+
+		AllowFormulas: j.Report.AllowFormulas,
+		PerOccurrence: j.Report.PerOccurrence,
+		Header:        len(j.Scope.Columns) > 0,
+	}
+}
+
+// BackupDir returns the backup directory for a run started at t, or "" for no backup.
+func (j *Job) BackupDir(t time.Time) string {
+	if j.Backup.Dir == "" || j.SearchOnly() {
+		return ""
+	}
+	if j.Backup.Timestamped {
+		return filepath.Join(j.Backup.Dir, t.Format("20060102_150405"))
+	}
+	return j.Backup.Dir
+}
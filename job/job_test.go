@@ -0,0 +1,127 @@
+package job
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad_ResolvesRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sprint.json")
+	content := `{
+  "jobs": [
+    {"name": "check", "root": "docs", "mode": "search", "search": "旧仕様"},
+    {"root": "docs", "mode": "replace", "pairs": [{"search": "サーバ", "replace": "サーバー"}],
+     "report": {"format": "tsv", "dir": "reports"}, "backup": {"dir": "backup", "timestamped": true}}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(f.Jobs))
+	}
+	first, second := f.Jobs[0], f.Jobs[1]
+	if first.Root != filepath.Join(dir, "docs") || first.ReportDir() != first.Root {
+		t.Errorf("unexpected root/report dir: %q %q", first.Root, first.ReportDir())
+	}
+	if first.BackupDir(time.Now()) != "" {
+		t.Error("search jobs must not back up")
+	}
+	if second.Name != "job 2" || second.ReportDir() != filepath.Join(dir, "reports") {
+		t.Errorf("unexpected defaults: %+v", second)
+	}
+	ts := time.Date(2026, 10, 17, 9, 30, 0, 0, time.Local)
+	if got, want := second.BackupDir(ts), filepath.Join(dir, "backup", "20261017_093000"); got != want {
+		t.Errorf("BackupDir = %q, want %q", got, want)
+	}
+
+	rules, err := second.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Replace != "サーバー" {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		ok   bool
+	}{
+		{"search", Job{Root: ".", Mode: "search", Search: "x"}, true},
+		{"no mode", Job{Root: ".", Search: "x"}, false},
+		{"two sources", Job{Root: ".", Mode: "search", Search: "x", Dictionary: "d.csv"}, false},
+		{"empty replace", Job{Root: ".", Mode: "replace", Search: "x"}, false},
+		{"replace with empty", Job{Root: ".", Mode: "replace", Search: "x", ReplaceWithEmpty: true}, true},
+		{"utf-8 report", Job{Root: ".", Mode: "search", Search: "x", Report: Report{Encoding: "utf-8-bom"}}, true},
+		{"unknown encoding", Job{Root: ".", Mode: "search", Search: "x", Report: Report{Encoding: "latin1"}}, false},
+		{"nth limit", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", Limit: Limit{Nth: 2, Scope: "sheet"}}, true},
+		{"first and nth", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", Limit: Limit{First: 1, Nth: 2}}, false},
+		{"first cell per sheet", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", Limit: Limit{First: 1, Scope: "sheet", Unit: "cell"}}, true},
+		{"sheet range", Job{Root: ".", Mode: "search", Search: "x", Scope: Scope{Ranges: []string{"変更履歴!B5:H200"}}}, true},
+		{"bad condition", Job{Root: ".", Mode: "search", Search: "x", Scope: Scope{Conditions: []string{"B ~ x"}}}, false},
+		{"bad range", Job{Root: ".", Mode: "search", Search: "x", Scope: Scope{Ranges: []string{"B5:C"}}}, false},
+		{"highlight", Job{Root: ".", Mode: "highlight", Search: "x", Highlight: Highlight{Fill: "#ffff00", Comment: "要確認"}}, true},
+		{"bad highlight color", Job{Root: ".", Mode: "highlight", Search: "x", Highlight: Highlight{FontColor: "red"}}, false},
+		{"unstyled replace", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", Highlight: Highlight{None: true}}, true},
+		{"none and bold", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", Highlight: Highlight{None: true, Bold: true}}, false},
+		{"nothing to highlight", Job{Root: ".", Mode: "highlight", Search: "x", Highlight: Highlight{None: true}}, false},
+		{"change log", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", NoteOld: true, ChangeLog: "変更ログ"}, true},
+		{"bad change log sheet", Job{Root: ".", Mode: "replace", Search: "x", Replace: "y", ChangeLog: "ログ[2026]"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.job.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	j := Job{Root: "r", Mode: "search", Search: "x", ExcludeDir: "old",
+		Files: Files{ExcludeDirs: []string{"tmp"}, MinSize: "1KB", NoIgnoreFile: true}}
+	filter, err := j.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.ExcludeDirs) != 2 || filter.ExcludeDirs[0] != "old" || filter.MinSize != 1024 || filter.IgnoreFile != "" {
+		t.Errorf("unexpected filter: %+v", filter)
+	}
+
+	j.Files.ModifiedSince = "yesterday"
+	if err := j.Validate(); err == nil {
+		t.Error("expected an invalid date to fail validation")
+	}
+}
+
+func TestSave_KeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.json")
+	first := &File{Jobs: []Job{{Name: "first", Root: "docs", Mode: "search", Search: "旧"}}}
+	if err := Save(path, first, false); err != nil {
+		t.Fatal(err)
+	}
+	second := &File{Jobs: []Job{{Name: "second", Root: "docs", Mode: "search", Search: "新"}}}
+	if err := Save(path, second, false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("existing file overwritten: %v", err)
+	}
+	if f, err := Load(path); err != nil || f.Jobs[0].Name != "first" {
+		t.Fatalf("Load = %+v, %v", f, err)
+	}
+	if err := Save(path, second, true); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := Load(path); err != nil || f.Jobs[0].Name != "second" {
+		t.Errorf("Load = %+v, %v", f, err)
+	}
+}
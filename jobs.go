@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"excel_converter/job"
+)
+
+// runJobs implements the "run" command: every job of a job file is run in
+// sequence and a combined summary is printed at the end. The exit code is the
+// most severe code of all jobs. When a job writes a json or jsonl report,
+// stdout carries only JSON (the summary line of each such job and a combined
+// summary line); all other output goes to stderr.
+func runJobs(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	yesFlag := fs.Bool("yes", false, "Do not ask for confirmation before replace and highlight jobs")
+	onlyFlag := fs.String("only", "", "Run only the job with this name")
+	previewFlag := fs.Bool("preview", false, "List the selected files of each job before processing")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: excel_converter run [-yes] [-only NAME] job.json")
+		return ExitError
+	}
+	jobFile, err := job.Load(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading job file: %v\n", err)
+		return ExitError
+	}
+
+	var jobs []job.Job
+	jsonRun := false
+	for _, j := range jobFile.Jobs {
+		if *onlyFlag != "" && j.Name != *onlyFlag {
+			continue
+		}
+		jobs = append(jobs, j)
+		jsonRun = jsonRun || j.Report.Format == "json" || j.Report.Format == "jsonl"
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintf(os.Stderr, "No job named %q\n", *onlyFlag)
+		return ExitError
+	}
+	out := io.Writer(os.Stdout)
+	if jsonRun {
+		out = os.Stderr
+	}
+
+	fmt.Fprintf(out, "Excel Converter v%s\n", Version)
+	var summaries []runSummary
+	for _, j := range jobs {
+		fmt.Fprintln(out, "==================================================")
+		fmt.Fprintf(out, "Job: %s\n", j.Name)
+
+		rules, err := j.Rules()
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			summaries = append(summaries, runSummary{Name: j.Name, Mode: j.Mode, Code: ExitError})
+			continue
+		}
+		filter, err := j.Filter()
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			summaries = append(summaries, runSummary{Name: j.Name, Mode: j.Mode, Code: ExitError})
+			continue
+		}
+		cfg := runConfig{
+			Log:        out,
+			Name:       j.Name,
+			Dir:        j.Root,
+			SearchOnly: j.SearchOnly(),
+			Rules:      rules,
+			Format:     j.Report.Format,
+			ReportDir:  j.ReportDir(),
+			ReportName: j.Report.Name,
+			Encoding:   j.Report.Encoding,
+			Fallback:   j.Report.Fallback,
+			Filter:     filter,
+			Preview:    *previewFlag,
+			BackupDir:  j.BackupDir(time.Now()),
+
+			AllowFormulas: j.Report.AllowFormulas,
+			PerOccurrence: j.Report.PerOccurrence,
+			Limit:         j.ReplaceLimit(),
+			Scope:         j.CellScope(),
+			Verbose:       j.Report.Verbose,
+			Highlight:     j.HighlightStyle(),
+			Style:         j.ReplaceStyle(),
+			NoteOld:       j.NoteOldValues(),
+			ChangeLog:     j.ChangeLogSheet(),
+			Operator:      j.Operator,
+		}
+		if !*yesFlag {
+			name := j.Name
+			cfg.Confirm = func(files int) bool {
+				return confirm(fmt.Sprintf("[%s] %d files may be overwritten. Continue?", name, files))
+			}
+		}
+		summaries = append(summaries, executeRun(cfg))
+	}
+
+	combined := combineSummaries(summaries)
+	if jsonRun {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(combined); err != nil {
+			fmt.Fprintf(out, "Error writing summary: %v\n", err)
+		}
+		return combined.Code
+	}
+	fmt.Fprintln(out, "==================================================")
+	fmt.Fprintln(out, "Combined Summary:")
+	for _, s := range summaries {
+		fmt.Fprintf(out, "  %-20s %-9s files=%-5d hits=%-6d occurrences=%-6d failed=%-3d exit=%d %s\n",
+			s.Name, s.Mode, s.Files, s.Hits, s.Occurrences, s.FailedFiles, s.Code, s.ReportPath)
+	}
+	fmt.Fprintf(out, "  Total: %d jobs, %d files, %d hits (%d occurrences), %d failed files, %v\n",
+		len(summaries), combined.Files, combined.Hits, combined.Occurrences, combined.FailedFiles, combined.Duration)
+	return combined.Code
+}
+
+// combinedSummary is the combined summary of a job file run. Its JSON form is
+// the last line on stdout when a job writes a json or jsonl report.
+type combinedSummary struct {
+	Type        string        `json:"type"` // "combined"
+	Jobs        []jobSummary  `json:"jobs"`
+	Files       int           `json:"files"`
+	Hits        int           `json:"hits"`
+	Occurrences int           `json:"occurrences"`
+	FailedFiles int           `json:"failedFiles"`
+	Duration    time.Duration `json:"-"`
+	DurationMs  int64         `json:"durationMs"`
+	Code        int           `json:"exitCode"`
+}
+
+// jobSummary is the JSON form of a runSummary.
+type jobSummary struct {
+	Name        string `json:"name"`
+	Mode        string `json:"mode"`
+	Files       int    `json:"files"`
+	Hits        int    `json:"hits"`
+	Occurrences int    `json:"occurrences"`
+	FailedFiles int    `json:"failedFiles"`
+	DurationMs  int64  `json:"durationMs"`
+	Report      string `json:"report,omitempty"`
+	Code        int    `json:"exitCode"`
+}
+
+// combineSummaries totals the runs of a job file; the exit code is the most
+// severe one.
+func combineSummaries(summaries []runSummary) combinedSummary {
+	c := combinedSummary{Type: "combined", Jobs: []jobSummary{}, Code: ExitOK}
+	for _, s := range summaries {
+		c.Jobs = append(c.Jobs, jobSummary{
+			Name:        s.Name,
+			Mode:        s.Mode,
+			Files:       s.Files,
+			Hits:        s.Hits,
+			Occurrences: s.Occurrences,
+			FailedFiles: s.FailedFiles,
+			DurationMs:  s.Duration.Milliseconds(),
+			Report:      s.ReportPath,
+			Code:        s.Code,
+		})
+		c.Files += s.Files
+		c.Hits += s.Hits
+		c.Occurrences += s.Occurrences
+		c.FailedFiles += s.FailedFiles
+		c.Duration += s.Duration
+		c.Code = worseExitCode(c.Code, s.Code)
+	}
+	c.DurationMs = c.Duration.Milliseconds()
+	return c
+}
+
+// worseExitCode returns the more severe of two exit codes:
+// ExitError > ExitPartialFailure > ExitHitsFound > ExitOK.
+func worseExitCode(a, b int) int {
+	rank := map[int]int{ExitOK: 0, ExitHitsFound: 1, ExitPartialFailure: 2, ExitError: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
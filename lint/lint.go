@@ -0,0 +1,197 @@
+package lint
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"excel_converter/excel"
+	"excel_converter/processor"
+	"excel_converter/replacer"
+)
+
+// Severity levels. Only SeverityError makes a check fail.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Rule is a forbidden term.
+type Rule struct {
+	Pattern    string
+	Regex      bool
+	IgnoreCase bool
+	Severity   string
+	Message    string
+	Label      string // "rules.csv:3"
+
+	matcher *replacer.Replacer
+}
+
+// Violation is one cell that matches a rule.
+type Violation struct {
+	FilePath string
+	Sheet    string
+	Cell     string
+	Value    string
+	Matched  string // First matched text in the cell
+	Count    int    // Number of matches in the cell
+	Rule     *Rule
+}
+
+// String formats the violation as "file:sheet!cell: severity: message".
+func (v Violation) String() string {
+	return fmt.Sprintf("%s:%s!%s: %s: %s", v.FilePath, v.Sheet, v.Cell, v.Rule.Severity, v.Rule.Message)
+}
+
+// LoadRules reads lint rules from a CSV, TSV or XLSX file.
+//
+// Each row is "pattern, type, severity, message" where type is "literal"
+// (default), "regex" or "ignorecase", and severity is "error" (default),
+// "warning" or "info". If message is empty, one is generated from the pattern.
+// A first row whose first cell is "pattern" or "パターン" is treated as a header;
+// rows starting with "#" are ignored.
+func LoadRules(path string) ([]*Rule, error) {
+	rows, err := replacer.ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(filepath.Base(path), rows)
+}
+
+// ParseRules converts table rows into compiled rules. name is used for labels.
+func ParseRules(name string, rows [][]string) ([]*Rule, error) {
+	var rules []*Rule
+	for i, row := range rows {
+		line := i + 1
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" || strings.HasPrefix(row[0], "#") {
+			continue
+		}
+		if i == 0 && isHeader(row[0]) {
+			continue
+		}
+		cell := func(n int) string {
+			if n < len(row) {
+				return strings.TrimSpace(row[n])
+			}
+			return ""
+		}
+
+		rule := &Rule{
+			Pattern:  row[0],
+			Severity: strings.ToLower(cell(2)),
+			Message:  cell(3),
+			Label:    fmt.Sprintf("%s:%d", name, line),
+		}
+		for _, t := range strings.FieldsFunc(strings.ToLower(cell(1)), func(r rune) bool { return r == ' ' || r == ',' }) {
+			switch t {
+			case "literal":
+			case "regex", "re":
+				rule.Regex = true
+			case "ignorecase", "i":
+				rule.IgnoreCase = true
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown type %q", name, line, t)
+			}
+		}
+		switch rule.Severity {
+		case "":
+			rule.Severity = SeverityError
+		case SeverityError, SeverityWarning, SeverityInfo:
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown severity %q", name, line, rule.Severity)
+		}
+		if rule.Message == "" {
+			rule.Message = fmt.Sprintf("forbidden term %q", rule.Pattern)
+		}
+
+		m, err := replacer.New([]replacer.Rule{rule.replacerRule()})
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rule.matcher = m
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules found", name)
+	}
+	return rules, nil
+}
+
+func isHeader(cell string) bool {
+	switch strings.ToLower(strings.TrimSpace(cell)) {
+	case "pattern", "パターン":
+		return true
+	}
+	return false
+}
+
+func (r *Rule) replacerRule() replacer.Rule {
+	return replacer.Rule{Search: r.Pattern, Replace: r.Pattern, Regex: r.Regex, IgnoreCase: r.IgnoreCase, Label: r.Label}
+}
+
+// Check scans the files read-only and returns every rule violation,
+// sorted by file path (cells keep their sheet/row order within a file),
+// together with the files that could not be read.
+func Check(files []string, rules []*Rule, onProgress func(current, total int, path string, workerCounts map[int]int)) ([]Violation, []processor.FileError, error) {
+	var all []replacer.Rule
+	for _, r := range rules {
+		all = append(all, r.replacerRule())
+	}
+	// The combined replacer only selects candidate cells; each rule is then
+	// evaluated on its own so that overlapping rules all report.
+	rep, err := replacer.New(all)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := excel.Options{Replacer: rep, SearchOnly: true, Log: io.Discard}
+	result, err := processor.ProcessFilesWithOptions(files, opts, onProgress)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := result.Changes
+
+	var violations []Violation
+	for _, c := range changes {
+		violations = append(violations, CheckValue(c.FilePath, c.Sheet, c.Cell, c.OldValue, rules)...)
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].FilePath < violations[j].FilePath
+	})
+	return violations, result.FileErrors, nil
+}
+
+// CheckValue returns the violations of a single cell value.
+func CheckValue(path, sheet, cell, value string, rules []*Rule) []Violation {
+	var out []Violation
+	for _, r := range rules {
+		matches := r.matcher.Find(value)
+		if len(matches) == 0 {
+			continue
+		}
+		out = append(out, Violation{
+			FilePath: path,
+			Sheet:    sheet,
+			Cell:     cell,
+			Value:    value,
+			Matched:  value[matches[0].Start:matches[0].End],
+			Count:    len(matches),
+			Rule:     r,
+		})
+	}
+	return out
+}
+
+// HasErrors reports whether any violation is of error severity.
+func HasErrors(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Rule.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
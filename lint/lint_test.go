@@ -0,0 +1,40 @@
+package lint
+
+import "testing"
+
+func TestCheckValue(t *testing.T) {
+	rules, err := ParseRules("rules.csv", [][]string{
+		{"pattern", "type", "severity", "message"},
+		{"Phoenix", "ignorecase", "error", "internal codename"},
+		{`旧(システム|基盤)`, "regex", "warning", ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations := CheckValue("a.xlsx", "表紙", "B2", "PHOENIX は旧システムと旧基盤を置き換える", rules)
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %d", len(violations))
+	}
+	if got := violations[0].String(); got != "a.xlsx:表紙!B2: error: internal codename" {
+		t.Errorf("unexpected format: %s", got)
+	}
+	if violations[1].Count != 2 || violations[1].Matched != "旧システム" {
+		t.Errorf("unexpected regex violation: %+v", violations[1])
+	}
+	if !HasErrors(violations) {
+		t.Error("expected HasErrors to be true")
+	}
+	if HasErrors(violations[1:]) {
+		t.Error("warnings alone must not fail the check")
+	}
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	if _, err := ParseRules("rules.csv", [][]string{{"x", "literal", "fatal"}}); err == nil {
+		t.Error("expected error for unknown severity")
+	}
+	if _, err := ParseRules("rules.csv", [][]string{{"(", "regex"}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
@@ -5,19 +5,27 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
 
 	"excel_converter/processor"
-	"excel_converter/report"
 	"excel_converter/server"
-	"excel_converter/utils"
 )
 
 const Version = "4.8"
 
 func main() {
+	// Subcommands (search, replace, serve, ...). Anything else, including no
+	// arguments at all, keeps the original flag/interactive behavior.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+	os.Exit(runInteractive())
+}
+
+// runInteractive is the original entry point used when the exe is double-clicked
+// or started with flags only. Missing values are asked for on the console, and it
+// waits for Enter before exiting unless -no-pause is given.
+func runInteractive() int {
 	fmt.Printf("Excel Converter v%s\n", Version)
 
 	// 1. Parse Flags
@@ -26,23 +34,46 @@ func main() {
 	dirFlag := flag.String("dir", ".", "Directory to search in")
 	serverFlag := flag.Bool("server", false, "Run in Web Server mode")
 	portFlag := flag.String("port", "8080", "Port for Web Server")
-	formatFlag := flag.String("format", "csv", "Output format (csv or tsv)")
+	formatFlag := flag.String("format", "csv", "Output format (csv, tsv, xlsx or html)")
+	dictFlag := flag.String("dict", "", "Dictionary file (CSV/TSV/XLSX) of search/replace pairs applied in one pass")
+	replaceEmptyFlag := flag.Bool("replace-with-empty", false, "Replace matches with an empty string (delete them)")
+	noPauseFlag := flag.Bool("no-pause", false, "Do not wait for Enter before exiting")
 	flag.Parse()
 
 	// Check if we should run in server mode
 	if *serverFlag {
-		server.StartServer(*portFlag)
-		return
+		if err := server.StartServer(*portFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitError
+		}
+		return ExitOK
 	}
 
-	search := *searchFlag
-	replace := *replaceFlag
-	rootDir := *dirFlag
+	cfg := runConfig{
+		Dir:      *dirFlag,
+		Search:   *searchFlag,
+		Replace:  *replaceFlag,
+		DictPath: *dictFlag,
+		Format:   *formatFlag,
+		Filter:   processor.FileFilter{IgnoreFile: processor.DefaultIgnoreFile},
+	}
+
+	if cfg.DictPath != "" && (cfg.Replace != "" || *replaceEmptyFlag) {
+		fmt.Println("Error: -dict can not be combined with -replace or -replace-with-empty (the replacements come from the dictionary)")
+		return ExitError
+	}
 
 	// 2. Interactive Mode if flags are missing
 	reader := bufio.NewReader(os.Stdin)
+	pause := func() {
+		if !*noPauseFlag {
+			// Pause to let user see output if double-clicked
+			fmt.Println("Press Enter to exit...")
+			reader.ReadString('\n')
+		}
+	}
 
-	if search == "" {
+	if cfg.Search == "" && cfg.DictPath == "" {
 		fmt.Println("Select Mode:")
 		fmt.Println("1. CLI (Command Line Interface)")
 		fmt.Println("2. Web GUI")
@@ -51,119 +82,34 @@ func main() {
 		choice = strings.TrimSpace(choice)
 
 		if choice == "2" {
-			server.StartServer(*portFlag)
-			return
+			if err := server.StartServer(*portFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				pause()
+				return ExitError
+			}
+			return ExitOK
 		}
 
 		fmt.Print("検索する文字列を入力してください: ")
 		input, _ := reader.ReadString('\n')
-		search = strings.TrimSpace(input)
+		cfg.Search = strings.TrimSpace(input)
 	}
 
-	if replace == "" {
+	if cfg.Replace == "" && cfg.DictPath == "" && !*replaceEmptyFlag {
 		fmt.Print("置換後の文字列を入力してください (検索モードの場合は空のままEnter): ")
 		input, _ := reader.ReadString('\n')
-		replace = strings.TrimSpace(input)
+		cfg.Replace = strings.TrimSpace(input)
 	}
 
-	if search == "" {
+	if cfg.Search == "" && cfg.DictPath == "" {
 		fmt.Println("検索文字列が指定されていません。終了します。")
-		return
-	}
-
-	// Determine mode
-	searchOnly := false
-	if replace == "" {
-		searchOnly = true
-		fmt.Println("Mode: Search Only")
-	} else {
-		fmt.Println("Mode: Replace")
-	}
-
-	fmt.Printf("Target Directory: %s\n", rootDir)
-	fmt.Printf("Search: %s\n", search)
-	if !searchOnly {
-		fmt.Printf("Replace: %s\n", replace)
+		return ExitError
 	}
-	fmt.Println("--------------------------------------------------")
 
-	// 3. Force Close Excel
-	fmt.Println("Closing Excel processes...")
-	if err := utils.ForceCloseExcel(); err != nil {
-		fmt.Printf("Warning: %v\n", err)
-	}
-
-	// 4. Collect Files
-	fmt.Println("Scanning for Excel files...")
-	files, err := processor.CollectTargetFiles(rootDir, nil, "")
-	if err != nil {
-		fmt.Printf("Error scanning files: %v\n", err)
-		os.Exit(1)
-	}
-	totalFiles := len(files)
-	fmt.Printf("Found %d Excel files.\n", totalFiles)
-	fmt.Println("--------------------------------------------------")
-
-	if totalFiles == 0 {
-		fmt.Println("No Excel files found.")
-		fmt.Println("Press Enter to exit...")
-		reader.ReadString('\n')
-		return
-	}
-
-	// 5. Process Files
-	startTime := time.Now()
-	fmt.Println("Processing files...")
-
-	// Simple Progress Bar
-	// [====================] 100% (50/50)
-
-	totalReplacements, changes, err := processor.ProcessFiles(files, search, replace, searchOnly, func(current, total int, path string, workerCounts map[int]int) {
-		percent := float64(current) / float64(total) * 100
-		barLength := 50
-		filledLength := int(float64(barLength) * percent / 100)
-		bar := strings.Repeat("=", filledLength) + strings.Repeat(" ", barLength-filledLength)
-
-		// \r to overwrite line
-		fmt.Printf("\r[%s] %.1f%% (%d/%d) %s", bar, percent, current, total, filepath.Base(path))
-		// Clear rest of line if filename is shorter than previous
-		fmt.Print("                                        ")
-	})
-	fmt.Println() // New line after progress bar
-
-	if err != nil {
-		fmt.Printf("Error processing files: %v\n", err)
-		os.Exit(1)
-	}
-
-	duration := time.Since(startTime)
-
-	// 6. Generate Report
-	if len(changes) > 0 {
-		reportPath, err := report.GenerateReport(changes, rootDir, *formatFlag)
-		if err != nil {
-			fmt.Printf("Error generating report: %v\n", err)
-		} else {
-			fmt.Printf("Report generated: %s\n", reportPath)
-		}
-	} else {
-		fmt.Println("No changes made.")
-	}
-
-	// 7. Stats
-	fmt.Println("--------------------------------------------------")
-	fmt.Println("Execution Summary:")
-	fmt.Printf("  Time Elapsed:      %v\n", duration)
-	fmt.Printf("  Files Processed:   %d\n", totalFiles)
-	if searchOnly {
-		fmt.Printf("  Total Hits:        %d\n", totalReplacements)
-	} else {
-		fmt.Printf("  Total Replacements: %d\n", totalReplacements)
-	}
-	fmt.Println("--------------------------------------------------")
-	fmt.Println("Done.")
+	// Determine mode: an empty replacement means search only, unless explicitly requested
+	cfg.SearchOnly = cfg.Replace == "" && cfg.DictPath == "" && !*replaceEmptyFlag
 
-	// Pause to let user see output if double-clicked
-	fmt.Println("Press Enter to exit...")
-	reader.ReadString('\n')
+	code := execute(cfg)
+	pause()
+	return code
 }
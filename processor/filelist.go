@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SkippedFile is a path from an explicit file list that is not processed.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// ReadFileList reads workbook paths separated by newlines, or by NUL bytes when
+// the input contains any (as produced by "git diff -z" or "find -print0").
+// Blank lines and a UTF-8 BOM are ignored.
+func ReadFileList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	sep := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = "\x00"
+	}
+	var paths []string
+	for _, p := range strings.Split(string(data), sep) {
+		if sep == "\n" {
+			p = strings.TrimSpace(p)
+		}
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// LoadFileList reads a file list from a file (see ReadFileList).
+func LoadFileList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFileList(f)
+}
+
+// CheckFileList splits an explicit file list into the workbooks that can be
+// processed and the ones that are skipped, with the reason. Relative paths are
+// resolved against baseDir ("" = the current directory). Paths that name the
+// same file as an earlier one (os.SameFile) are dropped as duplicates, so case
+// only matters where the file system is case-sensitive.
+func CheckFileList(paths []string, baseDir string) ([]string, []SkippedFile) {
+	var files []string
+	var skipped []SkippedFile
+	seen := make(map[int64][]os.FileInfo) // Accepted files by size
+	for _, p := range paths {
+		full := p
+		if baseDir != "" && !filepath.IsAbs(full) {
+			full = filepath.Join(baseDir, full)
+		}
+		full = filepath.Clean(full)
+
+		info, err := os.Stat(full)
+		ext := strings.ToLower(filepath.Ext(full))
+		reason := ""
+		switch {
+		case os.IsNotExist(err):
+			reason = "not found"
+		case err != nil:
+			reason = err.Error()
+		case info.IsDir():
+			reason = "is a directory"
+		case strings.HasPrefix(filepath.Base(full), "~$"):
+			reason = "temporary Excel file"
+		case ext != ".xlsx" && ext != ".xlsm":
+			reason = "unsupported file type, only .xlsx and .xlsm are processed"
+		case sameAsAny(info, seen[info.Size()]):
+			reason = "duplicate"
+		}
+		if reason != "" {
+			skipped = append(skipped, SkippedFile{Path: p, Reason: reason})
+			continue
+		}
+		seen[info.Size()] = append(seen[info.Size()], info)
+		files = append(files, full)
+	}
+	return files, skipped
+}
+
+func sameAsAny(info os.FileInfo, infos []os.FileInfo) bool {
+	for _, other := range infos {
+		if os.SameFile(info, other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	paths, err := ReadFileList(strings.NewReader("\xEF\xBB\xBFa.xlsx\r\n\n b/c.xlsm \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != "a.xlsx" || paths[1] != "b/c.xlsm" {
+		t.Errorf("newline list: got %q", paths)
+	}
+
+	// NUL separated lists keep surrounding spaces, which are valid in file names
+	paths, _ = ReadFileList(strings.NewReader("a b.xlsx\x00 c.xlsx\x00"))
+	if len(paths) != 2 || paths[0] != "a b.xlsx" || paths[1] != " c.xlsx" {
+		t.Errorf("NUL list: got %q", paths)
+	}
+}
+
+func TestCheckFileList(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "a.xlsx", "sub/b.xlsm", "c.csv", "~$d.xlsx")
+
+	files, skipped := CheckFileList([]string{"a.xlsx", "sub/b.xlsm", "sub/../a.xlsx", "c.csv", "~$d.xlsx", "missing.xlsx", "sub"}, root)
+	if len(files) != 2 || files[0] != filepath.Join(root, "a.xlsx") || files[1] != filepath.Join(root, "sub", "b.xlsm") {
+		t.Errorf("files: got %v", files)
+	}
+	reasons := make(map[string]string)
+	for _, s := range skipped {
+		reasons[s.Path] = s.Reason
+	}
+	for path, want := range map[string]string{"sub/../a.xlsx": "duplicate", "missing.xlsx": "not found", "~$d.xlsx": "temporary", "c.csv": "unsupported", "sub": "is a directory"} {
+		if !strings.HasPrefix(reasons[path], want) {
+			t.Errorf("%s: reason %q, want %q", path, reasons[path], want)
+		}
+	}
+}
+
+func TestCheckFileList_Case(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "a.xlsx")
+	if _, err := os.Stat(filepath.Join(root, "A.xlsx")); err == nil {
+		// Case-insensitive file system: both names are the same file
+		files, skipped := CheckFileList([]string{"a.xlsx", "A.xlsx"}, root)
+		if len(files) != 1 || len(skipped) != 1 || skipped[0].Reason != "duplicate" {
+			t.Errorf("got %v, skipped %v", files, skipped)
+		}
+		return
+	}
+
+	// Case-sensitive file system: names differing in case are different files
+	touch(t, root, "A.xlsx")
+	files, skipped := CheckFileList([]string{"a.xlsx", "A.xlsx"}, root)
+	if len(files) != 2 || len(skipped) != 0 {
+		t.Errorf("got %v, skipped %v", files, skipped)
+	}
+}
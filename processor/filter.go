@@ -0,0 +1,370 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"excel_converter/utils"
+)
+
+// DefaultIgnoreFile is the per-directory ignore file honored by CollectTargetFilesWithFilter.
+const DefaultIgnoreFile = ".excelignore"
+
+// FileFilter selects which workbooks CollectTargetFilesWithFilter returns.
+// The zero value selects every .xlsx/.xlsm file under the root.
+//
+// Patterns are globs on slash-separated paths relative to the root
+// ("*", "?" and "[...]" within a segment, "**" for any number of directories).
+// A pattern without "/" matches the file or directory name at any depth.
+type FileFilter struct {
+	ExcludeExtensions []string  // e.g. ".xlsm"
+	ExcludeDirs       []string  // Directories to skip (absolute, or relative to the root)
+	Include           []string  // If set, a file must match one of these patterns
+	Exclude           []string  // Files and directories matching these patterns are skipped
+	IgnoreFile        string    // Name of the per-directory ignore file ("" = none)
+	MaxDepth          int       // 1 = only files directly in the root; 0 = unlimited
+	MinSize           int64     // Bytes; 0 = no limit
+	MaxSize           int64     // Bytes; 0 = no limit
+	ModifiedSince     time.Time // Zero = no limit
+	ModifiedBefore    time.Time // Zero = no limit
+	FollowSymlinks    bool      // Descend into symlinked directories (loops are detected)
+}
+
+// ignoreRule is a pattern from an ignore file, relative to the directory that contains it.
+type ignoreRule struct {
+	base    string // Slash-separated directory of the ignore file, relative to the root
+	pattern string
+	dirOnly bool
+}
+
+// CollectTargetFilesWithFilter walks rootDir and returns the Excel files selected by filter.
+func CollectTargetFilesWithFilter(rootDir string, filter FileFilter) ([]string, error) {
+	c := newCollector(rootDir, filter)
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", rootDir)
+	}
+	if err := c.walk(rootDir, "", 0, nil); err != nil {
+		return nil, err
+	}
+	return c.files, nil
+}
+
+// Selects reports whether path, a file under rootDir, would be returned by
+// CollectTargetFilesWithFilter. Single files (e.g. from change notifications)
+// can be checked this way without walking the whole tree.
+func (filter FileFilter) Selects(rootDir, path string) bool {
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if filter.MaxDepth > 0 && len(parts) > filter.MaxDepth {
+		return false
+	}
+
+	c := newCollector(rootDir, filter)
+	var ignores []ignoreRule
+	dir, dirRel := rootDir, ""
+	for i := 0; ; i++ {
+		if filter.IgnoreFile != "" {
+			rules, err := readIgnoreFile(filepath.Join(dir, filter.IgnoreFile), dirRel)
+			if err != nil {
+				return false
+			}
+			ignores = append(ignores, rules...)
+		}
+		if i == len(parts)-1 {
+			break
+		}
+		dir, dirRel = filepath.Join(dir, parts[i]), joinRel(dirRel, parts[i])
+		if c.isExcludedDir(dir, dirRel, ignores) {
+			return false
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return c.selectFile(filepath.ToSlash(rel), info, ignores)
+}
+
+func newCollector(rootDir string, filter FileFilter) *collector {
+	c := &collector{
+		filter:  filter,
+		extMap:  make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+	for _, ext := range filter.ExcludeExtensions {
+		c.extMap[strings.ToLower(ext)] = true
+	}
+	for _, dir := range filter.ExcludeDirs {
+		if dir == "" {
+			continue
+		}
+		// Relative directories are under rootDir, unless they already name a directory in it
+		if _, inRoot := utils.Within(rootDir, dir); !filepath.IsAbs(dir) && !inRoot {
+			dir = filepath.Join(rootDir, dir)
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			c.excludeDirs = append(c.excludeDirs, abs)
+		}
+	}
+	return c
+}
+
+type collector struct {
+	filter      FileFilter
+	extMap      map[string]bool
+	excludeDirs []string
+	visited     map[string]bool // Real paths of visited directories, for symlink loop detection
+	files       []string
+}
+
+func (c *collector) walk(dir, rel string, depth int, ignores []ignoreRule) error {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if c.visited[real] {
+			return nil // Symlink loop, or a directory reachable twice
+		}
+		c.visited[real] = true
+	}
+
+	if c.filter.IgnoreFile != "" {
+		rules, err := readIgnoreFile(filepath.Join(dir, c.filter.IgnoreFile), rel)
+		if err != nil {
+			return err
+		}
+		ignores = append(ignores[:len(ignores):len(ignores)], rules...)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		full := filepath.Join(dir, entry.Name())
+		entryRel := joinRel(rel, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		isDir := info.IsDir()
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(full)
+			if err != nil {
+				continue // Broken link
+			}
+			if target.IsDir() && !c.filter.FollowSymlinks {
+				continue
+			}
+			info, isDir = target, target.IsDir()
+		}
+
+		if isDir {
+			if c.isExcludedDir(full, entryRel, ignores) {
+				continue
+			}
+			if c.filter.MaxDepth > 0 && depth+1 >= c.filter.MaxDepth {
+				continue
+			}
+			if err := c.walk(full, entryRel, depth+1, ignores); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if c.selectFile(entryRel, info, ignores) {
+			c.files = append(c.files, full)
+		}
+	}
+	return nil
+}
+
+func (c *collector) isExcludedDir(dir, rel string, ignores []ignoreRule) bool {
+	if abs, err := filepath.Abs(dir); err == nil {
+		for _, dir := range c.excludeDirs {
+			if abs == dir {
+				return true
+			}
+		}
+	}
+	return matchAny(c.filter.Exclude, rel) || isIgnored(ignores, rel, true)
+}
+
+func (c *collector) selectFile(rel string, info os.FileInfo, ignores []ignoreRule) bool {
+	name := info.Name()
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".xlsx" && ext != ".xlsm" {
+		return false
+	}
+	// Skip if extension is excluded, and skip temporary files (start with ~$)
+	if c.extMap[ext] || strings.HasPrefix(path.Base(rel), "~$") {
+		return false
+	}
+	if len(c.filter.Include) > 0 && !matchAny(c.filter.Include, rel) {
+		return false
+	}
+	if matchAny(c.filter.Exclude, rel) || isIgnored(ignores, rel, false) {
+		return false
+	}
+	if c.filter.MinSize > 0 && info.Size() < c.filter.MinSize {
+		return false
+	}
+	if c.filter.MaxSize > 0 && info.Size() > c.filter.MaxSize {
+		return false
+	}
+	if !c.filter.ModifiedSince.IsZero() && info.ModTime().Before(c.filter.ModifiedSince) {
+		return false
+	}
+	if !c.filter.ModifiedBefore.IsZero() && !info.ModTime().Before(c.filter.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+func joinRel(rel, name string) string {
+	if rel == "" {
+		return name
+	}
+	return rel + "/" + name
+}
+
+// readIgnoreFile reads glob patterns (one per line, "#" comments, trailing "/"
+// for directories only) from an ignore file. A missing file yields no rules.
+func readIgnoreFile(path, base string) ([]ignoreRule, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.ReplaceAll(line, `\`, "/")
+		rule := ignoreRule{base: base, pattern: strings.TrimPrefix(line, "/")}
+		if strings.HasSuffix(rule.pattern, "/") {
+			rule.dirOnly = true
+			rule.pattern = strings.TrimSuffix(rule.pattern, "/")
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func isIgnored(rules []ignoreRule, rel string, isDir bool) bool {
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if MatchGlob(r.pattern, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash-separated relative path matches pattern.
+// "**" matches any number of path segments; a pattern without "/" matches the
+// last segment (the file or directory name). Matching is case-insensitive, as on Windows.
+func MatchGlob(pattern, rel string) bool {
+	pattern = strings.ToLower(strings.ReplaceAll(pattern, `\`, "/"))
+	rel = strings.ToLower(rel)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// ParseSize parses a size such as "500", "200KB", "10MB" or "1GB" into bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseDate parses "2006-01-02", "2006-01-02 15:04" or RFC 3339 in local time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006/01/02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", s)
+}
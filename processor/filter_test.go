@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.xlsx", "a/b/見積.xlsx", true},
+		{"見積*", "a/見積_2024.xlsx", true},
+		{"old/**", "old/x/y.xlsx", true},
+		{"**/tmp/*.xlsx", "a/b/tmp/c.xlsx", true},
+		{"**/tmp/*.xlsx", "tmp/c.xlsx", true},
+		{"docs/*.xlsx", "docs/sub/c.xlsx", false},
+		{"*.XLSX", "a.xlsx", true},
+		{`old\*.xlsx`, "old/a.xlsx", true},
+	}
+	for _, c := range cases {
+		if got := MatchGlob(c.pattern, c.rel); got != c.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
+
+func touch(t *testing.T, root string, rels ...string) {
+	t.Helper()
+	for _, rel := range rels {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func collectRel(t *testing.T, root string, filter FileFilter) []string {
+	t.Helper()
+	files, err := CollectTargetFilesWithFilter(root, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+func TestCollect_ExcludeDirIsNotAPrefixMatch(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "docs/a.xlsx", "docs_old/b.xlsx", "c.xlsm", "d.csv", "~$e.xlsx")
+
+	got := collectRel(t, root, FileFilter{ExcludeDirs: []string{filepath.Join(root, "docs")}})
+	want := []string{"c.xlsm", "docs_old/b.xlsx"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCollect_RelativeExcludeDir(t *testing.T) {
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	touch(t, "docs", "a.xlsx", "sub/b.xlsx", "docs_old/c.xlsx", "docs_old/d.xlsx")
+
+	// "docs_old" is relative to the root although it starts with "docs"
+	got := collectRel(t, "docs", FileFilter{ExcludeDirs: []string{"docs_old", filepath.Join("docs", "sub")}})
+	if len(got) != 1 || got[0] != "a.xlsx" {
+		t.Errorf("got %v, want [a.xlsx]", got)
+	}
+}
+
+func TestCollect_IgnoreFileAndDepth(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "top.xlsx", "keep/a.xlsx", "keep/a_bak.xlsx", "keep/tmp/b.xlsx", "keep/deep/x/c.xlsx")
+	if err := os.WriteFile(filepath.Join(root, "keep", DefaultIgnoreFile), []byte("# comment\n*_bak.xlsx\ntmp/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collectRel(t, root, FileFilter{IgnoreFile: DefaultIgnoreFile})
+	want := []string{"keep/a.xlsx", "keep/deep/x/c.xlsx", "top.xlsx"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	got = collectRel(t, root, FileFilter{MaxDepth: 2, Include: []string{"keep/**"}})
+	if len(got) != 2 || got[0] != "keep/a.xlsx" || got[1] != "keep/a_bak.xlsx" {
+		t.Errorf("max depth/include: got %v", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"": 0, "500": 500, "10KB": 10 << 10, "1.5mb": 3 << 19, "2 GB": 2 << 30}
+	for in, want := range cases {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseSize("big"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestSelects_MatchesCollect(t *testing.T) {
+	root := t.TempDir()
+	touch(t, root, "a.xlsx", "keep/b.xlsx", "keep/b_bak.xlsx", "keep/tmp/c.xlsx", "old/d.xlsx", "e.csv", "deep/x/y/f.xlsx")
+	if err := os.WriteFile(filepath.Join(root, "keep", DefaultIgnoreFile), []byte("*_bak.xlsx\ntmp/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filter := FileFilter{IgnoreFile: DefaultIgnoreFile, ExcludeDirs: []string{"old"}, MaxDepth: 3}
+
+	selected := make(map[string]bool)
+	for _, rel := range collectRel(t, root, filter) {
+		selected[rel] = true
+	}
+	for _, rel := range []string{"a.xlsx", "keep/b.xlsx", "keep/b_bak.xlsx", "keep/tmp/c.xlsx", "old/d.xlsx", "e.csv", "deep/x/y/f.xlsx"} {
+		if got := filter.Selects(root, filepath.Join(root, filepath.FromSlash(rel))); got != selected[rel] {
+			t.Errorf("Selects(%s) = %v, collect = %v", rel, got, selected[rel])
+		}
+	}
+}
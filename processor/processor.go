@@ -1,62 +1,24 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
 	"sync"
 
 	"excel_converter/excel"
+	"excel_converter/replacer"
 	"excel_converter/report"
 )
 
 // CollectTargetFiles walks the directory and returns a list of Excel files to process.
 func CollectTargetFiles(rootDir string, excludeExtensions []string, excludeDir string) ([]string, error) {
-	var files []string
-
-	// Normalize excludeDir for comparison
+	filter := FileFilter{ExcludeExtensions: excludeExtensions}
 	if excludeDir != "" {
-		excludeDir = filepath.Clean(excludeDir)
-	}
-
-	// Create a map for faster extension lookup
-	excludeExtMap := make(map[string]bool)
-	for _, ext := range excludeExtensions {
-		excludeExtMap[strings.ToLower(ext)] = true
+		filter.ExcludeDirs = []string{excludeDir}
 	}
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Check excluded directory
-		if info.IsDir() {
-			if excludeDir != "" && strings.HasPrefix(filepath.Clean(path), excludeDir) {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Check extension
-		ext := strings.ToLower(filepath.Ext(path))
-
-		// Skip if extension is excluded
-		if excludeExtMap[ext] {
-			return nil
-		}
-
-		if ext == ".xlsx" || ext == ".xlsm" {
-			// Skip temporary files (start with ~$)
-			if strings.HasPrefix(filepath.Base(path), "~$") {
-				return nil
-			}
-			files = append(files, path)
-		}
-		return nil
-	})
-	return files, err
+	return CollectTargetFilesWithFilter(rootDir, filter)
 }
 
 type processResult struct {
@@ -69,10 +31,58 @@ type processResult struct {
 // ProcessFiles processes the given list of Excel files using a worker pool.
 // It accepts a callback function to report progress.
 func ProcessFiles(files []string, search, replace string, searchOnly bool, onProgress func(current, total int, path string, workerCounts map[int]int)) (int, []report.Change, error) {
+	r, err := replacer.NewSingle(search, replace)
+	if err != nil {
+		return 0, nil, err
+	}
+	res, err := ProcessFilesWithOptions(files, excel.Options{Replacer: r, SearchOnly: searchOnly}, onProgress)
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.TotalReplacements, res.Changes, nil
+}
+
+// FileError is a file that could not be (fully) processed.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Result is the outcome of ProcessFilesWithOptions.
+type Result struct {
+	TotalReplacements int             // Number of changed (or found) cells
+	TotalOccurrences  int             // Number of matches in the changed (or found) cells
+	Skipped           int             // Number of "Skipped (...)" rows, e.g. matches left alone by an occurrence limit
+	Changes           []report.Change // All changes, including failed ones (not set by ProcessFilesToSink)
+	FileErrors        []FileError     // Files that failed to open or save
+	Processed         int             // Number of files that were processed
+	Cancelled         bool            // The context was cancelled before all files were processed
+}
+
+// ProcessFilesWithOptions is like ProcessFiles but applies all rules of opts in one pass per cell.
+func ProcessFilesWithOptions(files []string, opts excel.Options, onProgress func(current, total int, path string, workerCounts map[int]int)) (*Result, error) {
+	var changes report.Collector
+	result, err := ProcessFilesToSink(context.Background(), files, opts, &changes, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	result.Changes = changes.Changes
+	return result, nil
+}
+
+// ProcessFilesToSink processes files like ProcessFilesWithOptions but hands the
+// changes of each file to sink as soon as the file is done instead of keeping
+// them. When ctx is cancelled no further files are started; files in progress
+// are finished, so no workbook is left half-written. An error from sink stops
+// the run and is returned.
+func ProcessFilesToSink(ctx context.Context, files []string, opts excel.Options, sink report.Sink, onProgress func(current, total int, path string, workerCounts map[int]int)) (*Result, error) {
+	result := &Result{}
 	totalFiles := len(files)
 	if totalFiles == 0 {
-		return 0, nil, nil
+		return result, nil
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Worker Pool Configuration
 	numWorkers := 2
@@ -87,7 +97,10 @@ func ProcessFiles(files []string, search, replace string, searchOnly bool, onPro
 		go func() {
 			defer wg.Done()
 			for path := range jobs {
-				changes, err := excel.ProcessFile(path, search, replace, searchOnly)
+				if ctx.Err() != nil {
+					continue // Drain the remaining jobs
+				}
+				changes, err := excel.ProcessFileWithOptions(path, opts)
 				results <- processResult{path: path, changes: changes, err: err, workerID: workerID}
 			}
 		}()
@@ -106,29 +119,46 @@ func ProcessFiles(files []string, search, replace string, searchOnly bool, onPro
 	}()
 
 	// Collect Results
-	var allChanges []report.Change
-	totalReplacements := 0
-	processedCount := 0
 	workerCounts := make(map[int]int)
+	var sinkErr error
 
 	for res := range results {
-		processedCount++
+		result.Processed++
 		workerCounts[res.workerID]++
 
 		if onProgress != nil {
-			onProgress(processedCount, totalFiles, res.path, workerCounts)
+			onProgress(result.Processed, totalFiles, res.path, workerCounts)
 		}
 
 		if res.err != nil {
-			fmt.Printf("\nError processing %s: %v\n", res.path, res.err)
+			fmt.Fprintf(logWriter(opts), "\nError processing %s: %v\n", res.path, res.err)
+			result.FileErrors = append(result.FileErrors, FileError{Path: res.path, Err: res.err})
 			// Don't continue; we might have partial results (e.g. failed save)
 		}
 
-		if len(res.changes) > 0 {
-			allChanges = append(allChanges, res.changes...)
-			totalReplacements += len(res.changes)
+		if len(res.changes) > 0 && sinkErr == nil {
+			if err := sink.Add(res.changes); err != nil {
+				sinkErr = err
+				cancel()
+				continue
+			}
+			skipped := report.Skipped(res.changes)
+			result.TotalReplacements += len(res.changes) - skipped
+			result.TotalOccurrences += report.Occurrences(res.changes)
+			result.Skipped += skipped
 		}
 	}
 
-	return totalReplacements, allChanges, nil
+	if sinkErr != nil {
+		return result, sinkErr
+	}
+	result.Cancelled = result.Processed < totalFiles
+	return result, nil
+}
+
+func logWriter(opts excel.Options) io.Writer {
+	if opts.Log != nil {
+		return opts.Log
+	}
+	return os.Stdout
 }
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/replacer"
+	"excel_converter/report"
+)
+
+func TestProcessFilesToSink_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var sink report.Collector
+	result, err := ProcessFilesToSink(ctx, []string{"a.xlsx", "b.xlsx", "c.xlsx"}, excel.Options{}, &sink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Cancelled || result.Processed != 0 || len(sink.Changes) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestRunInfo_Summary(t *testing.T) {
+	started := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+	info := RunInfo{
+		Target:  "docs",
+		Search:  "旧",
+		Replace: "新",
+		Job:     "weekly",
+		Options: excel.Options{
+			Limit:     replacer.Limit{First: 1, Scope: replacer.ScopeSheet},
+			ChangeLog: "変更ログ",
+			BackupDir: "backup",
+			Run:       excel.NewRun(started),
+		},
+	}
+	result := &Result{Cancelled: true, FileErrors: []FileError{{Path: "a.xlsx", Err: errors.New("locked")}}}
+	s := info.Summary(3, result, []SkippedFile{{Path: "b.txt", Reason: "unsupported extension"}})
+
+	var names []string
+	for _, p := range s.Parameters {
+		names = append(names, p.Name)
+	}
+	if got, want := strings.Join(names, ", "), "Search, Replace, Limit, Style, Run ID, Change Log, Job, Backup Directory"; got != want {
+		t.Errorf("parameters %s, want %s", got, want)
+	}
+	if s.Mode != "replace" || s.Files != 3 || s.FailedFiles != 1 || !s.Cancelled || !s.Started.Equal(started) {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	if len(s.FileErrors) != 1 || s.FileErrors[0].Message != "locked" || len(s.Skipped) != 1 || s.Skipped[0].Path != "b.txt" {
+		t.Errorf("file errors %+v, skipped %+v", s.FileErrors, s.Skipped)
+	}
+
+	// Search runs leave out the replace-only parameters
+	info.Options.SearchOnly = true
+	names = nil
+	for _, p := range info.Summary(3, &Result{}, nil).Parameters {
+		names = append(names, p.Name)
+	}
+	if got, want := strings.Join(names, ", "), "Search, Job"; got != want {
+		t.Errorf("search parameters %s, want %s", got, want)
+	}
+}
+
+func TestWantsReport(t *testing.T) {
+	none, hits := &Result{}, &Result{TotalReplacements: 1}
+	if WantsReport("csv", none) || !WantsReport("csv", hits) || !WantsReport("json", none) || !WantsReport("jsonl", none) {
+		t.Error("a report is written for hits, and always for the JSON formats")
+	}
+}
@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"excel_converter/excel"
+	"excel_converter/report"
+)
+
+// RunInfo describes a run for the summary of its report. The CLI and the web
+// UI both build the summary from it, so a new option is added in one place.
+type RunInfo struct {
+	Target     string        // Root directory or file list
+	Search     string        // The single search text (unless Dictionary or Pairs is set)
+	Replace    string        // Its replacement (replace mode)
+	Dictionary string        // Dictionary file the rules were loaded from
+	Pairs      int           // Number of pairs when the rules were given as a list
+	Job        string        // Job name, if any
+	Options    excel.Options // The options the files were processed with
+}
+
+// Mode returns the report mode of the run: "search", "replace" or "highlight".
+func (info RunInfo) Mode() string {
+	switch {
+	case info.Options.SearchOnly:
+		return "search"
+	case info.Options.Highlight != nil:
+		return "highlight"
+	}
+	return "replace"
+}
+
+// Summary builds the report summary of a run over files; skipped are the
+// listed files that were not processed.
+func (info RunInfo) Summary(files int, result *Result, skipped []SkippedFile) report.Summary {
+	opts := info.Options
+	s := report.Summary{
+		Mode:        info.Mode(),
+		Target:      info.Target,
+		Files:       files,
+		FailedFiles: len(result.FileErrors),
+		Started:     opts.Run.Started,
+		Cancelled:   result.Cancelled,
+	}
+	if !s.Started.IsZero() {
+		s.Duration = time.Since(s.Started)
+	}
+	for _, fe := range result.FileErrors {
+		s.FileErrors = append(s.FileErrors, report.FileError{Path: fe.Path, Message: fe.Err.Error()})
+	}
+	for _, sf := range skipped {
+		s.Skipped = append(s.Skipped, report.SkippedFile{Path: sf.Path, Reason: sf.Reason})
+	}
+
+	param := func(name, value string) {
+		s.Parameters = append(s.Parameters, report.Param{Name: name, Value: value})
+	}
+	switch {
+	case info.Dictionary != "":
+		entries := 0
+		if opts.Replacer != nil {
+			entries = len(opts.Replacer.Rules())
+		}
+		param("Dictionary", fmt.Sprintf("%s (%d entries)", info.Dictionary, entries))
+	case info.Pairs > 0:
+		param("Pairs", fmt.Sprint(info.Pairs))
+	default:
+		param("Search", info.Search)
+		if s.Mode == "replace" {
+			param("Replace", info.Replace)
+		}
+	}
+	if opts.Limit.Active() && s.Mode == "replace" {
+		param("Limit", opts.Limit.String())
+	}
+	switch s.Mode {
+	case "highlight":
+		param("Highlight", opts.Highlight.String())
+	case "replace":
+		style := excel.DefaultReplaceStyle
+		if opts.Style != nil {
+			style = *opts.Style
+		}
+		param("Style", style.String())
+	}
+	if s.Mode == "replace" && (opts.NoteOld || opts.ChangeLog != "") {
+		param("Run ID", opts.Run.ID)
+		if opts.NoteOld {
+			param("Old Value Notes", "yes")
+		}
+		if opts.ChangeLog != "" {
+			param("Change Log", opts.ChangeLog)
+		}
+	}
+	if opts.Scope.Active() {
+		param("Scope", opts.Scope.String())
+	}
+	if info.Job != "" {
+		param("Job", info.Job)
+	}
+	if opts.BackupDir != "" && s.Mode != "search" {
+		param("Backup Directory", opts.BackupDir)
+	}
+	return s
+}
+
+// WantsReport reports whether a run writes a report file: when cells were
+// found or skipped, and always for the JSON formats, whose summary is the
+// record of the run.
+func WantsReport(format string, result *Result) bool {
+	return result.TotalReplacements+result.Skipped > 0 || format == "json" || format == "jsonl"
+}
@@ -0,0 +1,157 @@
+package replacer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// LoadDictionary reads search/replace pairs from a CSV, TSV or XLSX file.
+//
+// Each row is "search, replace[, options]". The options column is a list of
+// flags separated by spaces or commas: "ignorecase", "regex", "wholecell".
+// A first row whose first cell is "search" or "検索" is treated as a header.
+// Empty rows and rows starting with "#" are ignored.
+// CSV/TSV files may be UTF-8 (with or without BOM) or Shift-JIS.
+func LoadDictionary(path string) ([]Rule, error) {
+	rows, err := ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDictionary(filepath.Base(path), rows)
+}
+
+// ParseDictionary converts table rows into rules. name is used for rule labels.
+func ParseDictionary(name string, rows [][]string) ([]Rule, error) {
+	var rules []Rule
+	for i, row := range rows {
+		line := i + 1
+		if len(row) == 0 || strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		if strings.HasPrefix(row[0], "#") {
+			continue
+		}
+		if i == 0 && isHeader(row[0]) {
+			continue
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected search and replace columns", name, line)
+		}
+		rule := Rule{
+			Search:  row[0],
+			Replace: row[1],
+			Label:   fmt.Sprintf("%s:%d", name, line),
+		}
+		if len(row) > 2 {
+			if err := applyOptions(&rule, row[2]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		}
+		if rule.Search == "" {
+			return nil, fmt.Errorf("%s:%d: empty search text", name, line)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no entries found", name)
+	}
+	return rules, nil
+}
+
+func isHeader(cell string) bool {
+	switch strings.ToLower(strings.TrimSpace(cell)) {
+	case "search", "検索", "検索文字列":
+		return true
+	}
+	return false
+}
+
+func applyOptions(rule *Rule, options string) error {
+	fields := strings.FieldsFunc(options, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ';' || r == '|'
+	})
+	for _, opt := range fields {
+		switch strings.ToLower(opt) {
+		case "ignorecase", "i":
+			rule.IgnoreCase = true
+		case "regex", "re":
+			rule.Regex = true
+		case "wholecell", "cell":
+			rule.WholeCell = true
+		default:
+			return fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	return nil
+}
+
+// ReadTable reads all rows of a CSV/TSV file, or of the first sheet of an XLSX file.
+// Row i of the result is line (or row) i+1 of the file.
+func ReadTable(path string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("%s: no sheets", path)
+		}
+		return f.GetRows(sheets[0])
+	case ".csv", ".tsv", ".txt":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err = decodeText(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r := csv.NewReader(bytes.NewReader(data))
+		if ext := strings.ToLower(filepath.Ext(path)); ext != ".csv" {
+			r.Comma = '\t'
+		}
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		// Keep rows aligned with line numbers (the reader skips blank lines) so labels point at the right line
+		var rows [][]string
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				return rows, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			line, _ := r.FieldPos(0)
+			for len(rows) < line-1 {
+				rows = append(rows, nil)
+			}
+			rows = append(rows, record)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported table format: %s", path)
+	}
+}
+
+// decodeText strips a UTF-8 BOM, or converts Shift-JIS text to UTF-8.
+func decodeText(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("\xEF\xBB\xBF")) {
+		return data[3:], nil
+	}
+	if utf8.Valid(data) {
+		return data, nil
+	}
+	return japanese.ShiftJIS.NewDecoder().Bytes(data)
+}
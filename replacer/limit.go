@@ -0,0 +1,137 @@
+package replacer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limit scopes.
+const (
+	ScopeCell  = "cell"
+	ScopeSheet = "sheet"
+	ScopeFile  = "file"
+)
+
+// Limit units: what a limit counts.
+const (
+	UnitOccurrence = "occurrence"
+	UnitCell       = "cell"
+)
+
+// Limit restricts which occurrences are replaced. Occurrences are counted in
+// reading order (sheet by sheet, row by row, left to right) and the count
+// starts again in each scope. With UnitCell the cells that have a match are
+// counted instead, and all occurrences of a counted cell are replaced, e.g.
+// "the first cell per sheet". The zero value replaces everything.
+type Limit struct {
+	First int    // Replace only the first N occurrences (or cells) of each scope (0 = no limit)
+	Nth   int    // Replace only the Nth occurrence (or cell) of each scope (0 = no limit)
+	Scope string // ScopeCell (default), ScopeSheet or ScopeFile
+	Unit  string // UnitOccurrence (default) or UnitCell
+}
+
+// Active reports whether the limit skips any occurrence.
+func (l Limit) Active() bool {
+	return l.First > 0 || l.Nth > 0
+}
+
+// Validate checks the limit settings.
+func (l Limit) Validate() error {
+	if l.First < 0 || l.Nth < 0 {
+		return fmt.Errorf("occurrence limits must be positive")
+	}
+	if l.First > 0 && l.Nth > 0 {
+		return fmt.Errorf("first and nth can not be combined")
+	}
+	switch l.Scope {
+	case "", ScopeCell, ScopeSheet, ScopeFile:
+	default:
+		return fmt.Errorf("unknown limit scope %q (use cell, sheet or file)", l.Scope)
+	}
+	switch l.Unit {
+	case "", UnitOccurrence:
+	case UnitCell:
+		if l.Scope == "" || l.Scope == ScopeCell {
+			return fmt.Errorf("counting cells needs the sheet or file scope")
+		}
+	default:
+		return fmt.Errorf("unknown limit unit %q (use occurrence or cell)", l.Unit)
+	}
+	return nil
+}
+
+// String describes the limit for reports, e.g. "first 1 per sheet" or
+// "first 1 cell per sheet".
+func (l Limit) String() string {
+	scope := l.Scope
+	if scope == "" {
+		scope = ScopeCell
+	}
+	cells := l.Unit == UnitCell
+	switch {
+	case l.First > 0 && cells:
+		return fmt.Sprintf("first %d cell(s) per %s", l.First, scope)
+	case l.First > 0:
+		return fmt.Sprintf("first %d per %s", l.First, scope)
+	case l.Nth > 0 && cells:
+		return fmt.Sprintf("cell %d per %s", l.Nth, scope)
+	case l.Nth > 0:
+		return fmt.Sprintf("occurrence %d per %s", l.Nth, scope)
+	}
+	return "none"
+}
+
+// Counter applies a Limit to the matches of consecutive cells.
+type Counter struct {
+	limit Limit
+	seen  int
+}
+
+// NewCounter returns a counter for l; call Enter at every sheet and cell.
+func NewCounter(l Limit) *Counter {
+	return &Counter{limit: l}
+}
+
+// Enter tells the counter that a new sheet or cell starts, resetting the count
+// when scope is the limit's scope.
+func (c *Counter) Enter(scope string) {
+	limitScope := c.limit.Scope
+	if limitScope == "" {
+		limitScope = ScopeCell
+	}
+	if strings.EqualFold(scope, limitScope) {
+		c.seen = 0
+	}
+}
+
+// Split divides the matches of the current cell into the ones to replace and
+// the ones the limit skips. With UnitCell the matches of a cell are replaced
+// or skipped together.
+func (c *Counter) Split(matches []Match) (apply, skip []Match) {
+	if !c.limit.Active() || len(matches) == 0 {
+		return matches, nil
+	}
+	if c.limit.Unit == UnitCell {
+		if c.next() {
+			return matches, nil
+		}
+		return nil, matches
+	}
+	for _, m := range matches {
+		if c.next() {
+			apply = append(apply, m)
+		} else {
+			skip = append(skip, m)
+		}
+	}
+	return apply, skip
+}
+
+// next counts one occurrence or cell and reports whether it is replaced.
+func (c *Counter) next() bool {
+	c.seen++
+	if c.limit.Nth > 0 {
+		return c.seen == c.limit.Nth
+	}
+	return c.seen <= c.limit.First
+}
@@ -0,0 +1,282 @@
+package replacer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule is a single search/replace pair.
+type Rule struct {
+	Search     string
+	Replace    string
+	IgnoreCase bool   // Match search text case-insensitively
+	Regex      bool   // Treat Search as a regular expression (Replace may use $1 etc.)
+	WholeCell  bool   // Only match when the whole cell equals Search
+	Label      string // Where the rule came from (e.g. "glossary.csv:12"), shown in reports
+
+	re *regexp.Regexp
+}
+
+// Match is one occurrence of a rule in a cell value.
+// Start/End are byte offsets into the original value.
+type Match struct {
+	Rule  *Rule
+	Start int
+	End   int
+
+	groups []int // submatch offsets of a regex match, for $1 etc.
+}
+
+// Replacer applies a set of rules to cell values in a single pass.
+//
+// At each position the longest match among all rules wins; ties are broken by
+// rule order. Replaced text is never scanned again, so a replacement can not
+// be replaced by another rule (no cascading).
+//
+// A regex rule is matched against the whole value, so ^, $ and \b see the
+// full cell. Its matches are the ones regexp.FindAllString returns; a match
+// that overlaps text already taken by another rule is dropped.
+type Replacer struct {
+	rules []*Rule
+}
+
+// New compiles the given rules into a Replacer.
+func New(rules []Rule) (*Replacer, error) {
+	r := &Replacer{}
+	for i := range rules {
+		rule := rules[i]
+		if rule.Search == "" {
+			return nil, fmt.Errorf("rule %s: empty search text", rule.name(i))
+		}
+		if rule.Regex {
+			pattern := rule.Search
+			if rule.IgnoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.name(i), err)
+			}
+			rule.re = re
+		}
+		r.rules = append(r.rules, &rule)
+	}
+	return r, nil
+}
+
+// NewSingle returns a Replacer for a plain search/replace pair.
+func NewSingle(search, replace string) (*Replacer, error) {
+	return New([]Rule{{Search: search, Replace: replace}})
+}
+
+// Rules returns the rules in the order they were given.
+func (r *Replacer) Rules() []*Rule {
+	return r.rules
+}
+
+func (rule *Rule) name(i int) string {
+	if rule.Label != "" {
+		return rule.Label
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// candidates returns the rules that can possibly match somewhere in s.
+func (r *Replacer) candidates(s string) []*Rule {
+	var out []*Rule
+	for _, rule := range r.rules {
+		switch {
+		case rule.WholeCell && !rule.Regex && !rule.IgnoreCase:
+			if s == rule.Search {
+				out = append(out, rule)
+			}
+		case rule.Regex:
+			if rule.re.MatchString(s) {
+				out = append(out, rule)
+			}
+		case rule.IgnoreCase:
+			if containsFold(s, rule.Search) {
+				out = append(out, rule)
+			}
+		default:
+			if strings.Contains(s, rule.Search) {
+				out = append(out, rule)
+			}
+		}
+	}
+	return out
+}
+
+// scanner finds the matches of the candidate rules while Find moves through a
+// value. The matches of regex rules are computed once for the whole value.
+type scanner struct {
+	s     string
+	rules []*Rule
+	found map[*Rule][][]int // remaining regex matches, by rule
+}
+
+func newScanner(s string, rules []*Rule) *scanner {
+	sc := &scanner{s: s, rules: rules, found: make(map[*Rule][][]int)}
+	for _, rule := range rules {
+		if rule.Regex {
+			sc.found[rule] = rule.re.FindAllStringSubmatchIndex(s, -1)
+		}
+	}
+	return sc
+}
+
+// matchAt returns the length of rule's match at pos, or -1. For a regex rule
+// it also returns the submatch offsets.
+func (sc *scanner) matchAt(rule *Rule, pos int) (int, []int) {
+	if rule.WholeCell && pos != 0 {
+		return -1, nil
+	}
+	s := sc.s
+	n := -1
+	var groups []int
+	switch {
+	case rule.Regex:
+		// Matches before pos were passed over or overlap an earlier match
+		found := sc.found[rule]
+		for len(found) > 0 && found[0][0] < pos {
+			found = found[1:]
+		}
+		sc.found[rule] = found
+		if len(found) > 0 && found[0][0] == pos && found[0][1] > pos {
+			n, groups = found[0][1]-pos, found[0]
+		}
+	case rule.IgnoreCase:
+		n = prefixFold(s[pos:], rule.Search)
+	default:
+		if strings.HasPrefix(s[pos:], rule.Search) {
+			n = len(rule.Search)
+		}
+	}
+	if rule.WholeCell && n != len(s) {
+		return -1, nil
+	}
+	return n, groups
+}
+
+// prefixFold returns the length in bytes of the prefix of s that equals
+// prefix under simple Unicode case folding, or -1. The lengths of the two can
+// differ, e.g. "K" (U+212A) matches "k".
+func prefixFold(s, prefix string) int {
+	n := 0
+	for _, pr := range prefix {
+		if n >= len(s) {
+			return -1
+		}
+		sr, size := utf8.DecodeRuneInString(s[n:])
+		if !equalFoldRune(sr, pr) {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// containsFold reports whether substr is within s under simple Unicode case
+// folding.
+func containsFold(s, substr string) bool {
+	for pos := 0; pos < len(s); {
+		if prefixFold(s[pos:], substr) >= 0 {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[pos:])
+		pos += size
+	}
+	return false
+}
+
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns all non-overlapping matches in s, scanning left to right.
+func (r *Replacer) Find(s string) []Match {
+	cands := r.candidates(s)
+	if len(cands) == 0 {
+		return nil
+	}
+	sc := newScanner(s, cands)
+	var matches []Match
+	for pos := 0; pos < len(s); {
+		var best *Rule
+		var bestGroups []int
+		bestLen := -1
+		for _, rule := range cands {
+			n, groups := sc.matchAt(rule, pos)
+			// Candidates are in rule order, so the first of equally long matches wins
+			if n > bestLen {
+				best, bestLen, bestGroups = rule, n, groups
+			}
+		}
+		if best == nil || bestLen <= 0 {
+			_, size := utf8.DecodeRuneInString(s[pos:])
+			pos += size
+			continue
+		}
+		matches = append(matches, Match{Rule: best, Start: pos, End: pos + bestLen, groups: bestGroups})
+		pos += bestLen
+	}
+	return matches
+}
+
+// Apply builds the replaced value for s from the given matches.
+func (r *Replacer) Apply(s string, matches []Match) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m.Start])
+		b.WriteString(m.Replacement(s))
+		last = m.End
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Replace applies all rules to s in one pass and returns the new value and the matches.
+func (r *Replacer) Replace(s string) (string, []Match) {
+	matches := r.Find(s)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	return r.Apply(s, matches), matches
+}
+
+// Replacement returns the text that replaces m in s.
+func (m Match) Replacement(s string) string {
+	if !m.Rule.Regex {
+		return m.Rule.Replace
+	}
+	if m.groups == nil {
+		return m.Rule.re.ReplaceAllString(s[m.Start:m.End], m.Rule.Replace)
+	}
+	return string(m.Rule.re.ExpandString(nil, m.Rule.Replace, s, m.groups))
+}
+
+// Labels returns the distinct labels of the rules that produced the matches, in order.
+func Labels(matches []Match) string {
+	var labels []string
+	seen := make(map[*Rule]bool)
+	for _, m := range matches {
+		if seen[m.Rule] || m.Rule.Label == "" {
+			continue
+		}
+		seen[m.Rule] = true
+		labels = append(labels, m.Rule.Label)
+	}
+	return strings.Join(labels, "; ")
+}
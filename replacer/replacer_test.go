@@ -0,0 +1,180 @@
+package replacer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplace_LongestMatchNoCascade(t *testing.T) {
+	r, err := New([]Rule{
+		{Search: "サーバ", Replace: "サーバー", Label: "d:1"},
+		{Search: "サーバー", Replace: "サーバー", Label: "d:2"},
+		{Search: "A", Replace: "B", Label: "d:3"},
+		{Search: "B", Replace: "C", Label: "d:4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, matches := r.Replace("サーバとサーバーとAB")
+	want := "サーバーとサーバーとBC"
+	if got != want {
+		t.Errorf("Replace = %q, want %q", got, want)
+	}
+	if len(matches) != 4 {
+		t.Fatalf("expected 4 matches, got %d", len(matches))
+	}
+	if matches[1].Rule.Label != "d:2" {
+		t.Errorf("expected longest entry d:2 for second match, got %s", matches[1].Rule.Label)
+	}
+	if labels := Labels(matches); labels != "d:1; d:2; d:3; d:4" {
+		t.Errorf("Labels = %q", labels)
+	}
+}
+
+func TestReplace_Options(t *testing.T) {
+	r, err := New([]Rule{
+		{Search: "abc", Replace: "X", IgnoreCase: true},
+		{Search: `No\.(\d+)`, Replace: "#$1", Regex: true},
+		{Search: "OK", Replace: "済", WholeCell: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ in, want string }{
+		{"ABC abc", "X X"},
+		{"No.12 and No.3", "#12 and #3"},
+		{"OK", "済"},
+		{"OK?", "OK?"},
+	}
+	for _, tt := range tests {
+		if got, _ := r.Replace(tt.in); got != tt.want {
+			t.Errorf("Replace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReplace_RegexSeesWholeCell(t *testing.T) {
+	r, err := New([]Rule{
+		{Search: `^v(\d)`, Replace: "ver$1", Regex: true},
+		{Search: `\bid\b`, Replace: "ID", Regex: true},
+		{Search: "x", Replace: "y"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ in, want string }{
+		{"v1 v2", "ver1 v2"},
+		{"id valid id", "ID valid ID"},
+		{"xv1", "yv1"},
+	}
+	for _, tt := range tests {
+		if got, _ := r.Replace(tt.in); got != tt.want {
+			t.Errorf("Replace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReplace_IgnoreCaseFolding(t *testing.T) {
+	// U+212A KELVIN SIGN is three bytes and folds to "k"
+	r, err := New([]Rule{{Search: "kg", Replace: "キロ", IgnoreCase: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ in, want string }{
+		{"\u212Ag と KG", "キロ と キロ"},
+		{"ſ kg", "ſ キロ"},
+		{"k", "k"},
+	}
+	for _, tt := range tests {
+		if got, _ := r.Replace(tt.in); got != tt.want {
+			t.Errorf("Replace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoadDictionary_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glossary.csv")
+	content := "\xEF\xBB\xBFsearch,replace,options\nユーザ,ユーザー\n# comment\n\nfoo,bar,ignorecase\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Search != "ユーザ" || rules[0].Label != "glossary.csv:2" {
+		t.Errorf("unexpected first rule: %+v", rules[0])
+	}
+	if !rules[1].IgnoreCase || rules[1].Label != "glossary.csv:5" {
+		t.Errorf("unexpected second rule: %+v", rules[1])
+	}
+}
+
+func TestCounter_Limit(t *testing.T) {
+	r, err := NewSingle("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := []string{"aaa", "a", "xa"}
+
+	tests := []struct {
+		limit Limit
+		want  []string // Replaced values of cells, all in one sheet
+	}{
+		{Limit{}, []string{"bbb", "b", "xb"}},
+		{Limit{First: 2}, []string{"bba", "b", "xb"}},
+		{Limit{Nth: 2}, []string{"aba", "a", "xa"}},
+		{Limit{First: 2, Scope: ScopeSheet}, []string{"bba", "a", "xa"}},
+		{Limit{Nth: 4, Scope: ScopeFile}, []string{"aaa", "b", "xa"}},
+		{Limit{First: 1, Scope: ScopeSheet, Unit: UnitCell}, []string{"bbb", "a", "xa"}},
+		{Limit{First: 2, Scope: ScopeFile, Unit: UnitCell}, []string{"bbb", "b", "xa"}},
+		{Limit{Nth: 2, Scope: ScopeSheet, Unit: UnitCell}, []string{"aaa", "b", "xa"}},
+	}
+	for _, tt := range tests {
+		counter := NewCounter(tt.limit)
+		counter.Enter(ScopeSheet)
+		skipped := 0
+		for i, cell := range cells {
+			counter.Enter(ScopeCell)
+			apply, skip := counter.Split(r.Find(cell))
+			skipped += len(skip)
+			if got := r.Apply(cell, apply); got != tt.want[i] {
+				t.Errorf("%s: cell %q = %q, want %q", tt.limit, cell, got, tt.want[i])
+			}
+		}
+		if total := 5; skipped+countReplaced(tt.want) != total {
+			t.Errorf("%s: %d skipped, want %d", tt.limit, skipped, total-countReplaced(tt.want))
+		}
+	}
+}
+
+func countReplaced(values []string) int {
+	n := 0
+	for _, v := range values {
+		n += strings.Count(v, "b")
+	}
+	return n
+}
+
+func TestLimit_Validate(t *testing.T) {
+	for _, l := range []Limit{{First: 1, Nth: 1}, {First: -1}, {Nth: 1, Scope: "row"}, {First: 1, Unit: UnitCell}, {First: 1, Scope: ScopeSheet, Unit: "row"}} {
+		if l.Validate() == nil {
+			t.Errorf("%+v: expected an error", l)
+		}
+	}
+	for _, l := range []Limit{{Nth: 3, Scope: ScopeFile}, {First: 1, Scope: ScopeSheet, Unit: UnitCell}} {
+		if err := l.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", l, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package report
+
+// DiffOp is one run of a character-level diff between an old and a new value.
+type DiffOp struct {
+	Kind byte // '=' unchanged, '-' only in the old value, '+' only in the new value
+	Text string
+}
+
+// maxDiffCells bounds the size of the LCS table; longer values are diffed by
+// their common prefix and suffix only.
+const maxDiffCells = 1 << 20
+
+// Diff returns the character-level difference between oldValue and newValue.
+func Diff(oldValue, newValue string) []DiffOp {
+	a, b := []rune(oldValue), []rune(newValue)
+
+	// Common prefix and suffix keep the table small for typical replacements
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	add := func(kind byte, r []rune) {
+		if len(r) == 0 {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+			ops[n-1].Text += string(r)
+			return
+		}
+		ops = append(ops, DiffOp{Kind: kind, Text: string(r)})
+	}
+
+	add('=', a[:prefix])
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells || len(midA) == 0 || len(midB) == 0 {
+		add('-', midA)
+		add('+', midB)
+	} else {
+		// lcs[i][j] is the LCS length of midA[i:] and midB[j:]
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) && j < len(midB) {
+			switch {
+			case midA[i] == midB[j]:
+				add('=', midA[i:i+1])
+				i, j = i+1, j+1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				add('-', midA[i:i+1])
+				i++
+			default:
+				add('+', midB[j:j+1])
+				j++
+			}
+		}
+		add('-', midA[i:])
+		add('+', midB[j:])
+	}
+	add('=', a[len(a)-suffix:])
+	return ops
+}
@@ -0,0 +1,29 @@
+package report
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		old, new string
+		want     []DiffOp
+	}{
+		{"旧仕様に準拠", "新仕様に準拠", []DiffOp{{'-', "旧"}, {'+', "新"}, {'=', "仕様に準拠"}}},
+		{"サーバ構成", "サーバー構成", []DiffOp{{'=', "サーバ"}, {'+', "ー"}, {'=', "構成"}}},
+		{"abc", "", []DiffOp{{'-', "abc"}}},
+		{"same", "same", []DiffOp{{'=', "same"}}},
+		{"xaybz", "xcydz", []DiffOp{{'=', "x"}, {'-', "a"}, {'+', "c"}, {'=', "y"}, {'-', "b"}, {'+', "d"}, {'=', "z"}}},
+	}
+	for _, c := range cases {
+		got := Diff(c.old, c.new)
+		if len(got) != len(c.want) {
+			t.Errorf("Diff(%q, %q) = %v, want %v", c.old, c.new, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("Diff(%q, %q) = %v, want %v", c.old, c.new, got, c.want)
+				break
+			}
+		}
+	}
+}
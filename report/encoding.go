@@ -0,0 +1,191 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Encodings of CSV/TSV reports.
+const (
+	EncodingCP932    = "cp932"     // Windows Shift-JIS including the NEC/IBM extensions (①, ㈱, ...); the default
+	EncodingShiftJIS = "shift-jis" // JIS X 0208 only; vendor extensions count as unencodable
+	EncodingUTF8BOM  = "utf-8-bom"
+	EncodingUTF8     = "utf-8"
+	EncodingUTF16LE  = "utf-16le" // With BOM, as Excel expects
+)
+
+// Fallbacks for characters the Shift-JIS encodings can't represent.
+const (
+	FallbackCodePoint = "codepoint" // Write the character as [U+20BB7], so nothing is lost
+	FallbackError     = "error"     // Fail the report
+	DefaultFallback   = "?"
+)
+
+var encodingAliases = map[string]string{
+	"":            EncodingCP932,
+	"cp932":       EncodingCP932,
+	"ms932":       EncodingCP932,
+	"windows-31j": EncodingCP932,
+	"sjis":        EncodingShiftJIS,
+	"shift-jis":   EncodingShiftJIS,
+	"shift_jis":   EncodingShiftJIS,
+	"shiftjis":    EncodingShiftJIS,
+	"utf-8-bom":   EncodingUTF8BOM,
+	"utf8bom":     EncodingUTF8BOM,
+	"utf8-bom":    EncodingUTF8BOM,
+	"utf-8":       EncodingUTF8,
+	"utf8":        EncodingUTF8,
+	"utf-16le":    EncodingUTF16LE,
+	"utf16le":     EncodingUTF16LE,
+	"utf-16":      EncodingUTF16LE,
+}
+
+// ParseEncoding returns the canonical name of a report encoding ("" is the default, cp932).
+func ParseEncoding(name string) (string, error) {
+	if enc, ok := encodingAliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return enc, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (use cp932, shift-jis, utf-8-bom, utf-8 or utf-16le)", name)
+}
+
+// TextWriter encodes UTF-8 text for a report file. Characters the encoding
+// can't represent are replaced by the fallback and counted.
+type TextWriter struct {
+	w   io.Writer
+	tw  *transform.Writer
+	sub *substituter
+}
+
+// NewTextWriter returns a writer that encodes into w. Byte order marks are
+// written immediately. fallback is a replacement text, FallbackCodePoint or
+// FallbackError; it only matters for the Shift-JIS encodings.
+func NewTextWriter(w io.Writer, enc, fallback string) (*TextWriter, error) {
+	enc, err := ParseEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+	t := &TextWriter{w: w}
+	switch enc {
+	case EncodingUTF8:
+	case EncodingUTF8BOM:
+		if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+			return nil, err
+		}
+	case EncodingUTF16LE:
+		t.tw = transform.NewWriter(w, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder())
+	default:
+		if fallback == "" {
+			fallback = DefaultFallback
+		}
+		t.sub = &substituter{enc: japanese.ShiftJIS.NewEncoder(), strict: enc == EncodingShiftJIS, fallback: fallback}
+		if fallback != FallbackCodePoint && fallback != FallbackError {
+			for _, r := range fallback {
+				if _, ok := t.sub.encodeRune(r); !ok {
+					return nil, fmt.Errorf("fallback %q can not be written in %s", fallback, enc)
+				}
+			}
+		}
+		t.tw = transform.NewWriter(w, t.sub)
+	}
+	return t, nil
+}
+
+func (t *TextWriter) Write(p []byte) (int, error) {
+	if t.tw == nil {
+		return t.w.Write(p)
+	}
+	return t.tw.Write(p)
+}
+
+// Close flushes the encoder; it does not close the underlying writer.
+func (t *TextWriter) Close() error {
+	if t.tw == nil {
+		return nil
+	}
+	return t.tw.Close()
+}
+
+// Substituted returns the number of characters replaced by the fallback.
+func (t *TextWriter) Substituted() int {
+	if t.sub == nil {
+		return 0
+	}
+	return t.sub.count
+}
+
+// substituter is a Shift-JIS encoder that replaces unencodable characters
+// instead of failing.
+type substituter struct {
+	enc      *encoding.Encoder
+	strict   bool // Reject the CP932 vendor extensions
+	fallback string
+	count    int
+	buf      [utf8.UTFMax]byte
+}
+
+func (s *substituter) Reset() {}
+
+func (s *substituter) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		out, ok := s.encodeRune(r)
+		if !ok {
+			if s.fallback == FallbackError {
+				return nDst, nSrc, fmt.Errorf("character %q (U+%04X) can not be encoded", r, r)
+			}
+			out = s.replacement(r)
+		}
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if !ok {
+			s.count++
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// encodeRune returns the Shift-JIS bytes of r, or false if r has none.
+func (s *substituter) encodeRune(r rune) ([]byte, bool) {
+	if r < utf8.RuneSelf {
+		return []byte{byte(r)}, true
+	}
+	if r == utf8.RuneError {
+		return nil, false
+	}
+	n := utf8.EncodeRune(s.buf[:], r)
+	out, err := s.enc.Bytes(s.buf[:n])
+	if err != nil {
+		return nil, false
+	}
+	// Lead bytes 0x87 and 0xED-0xFC are the NEC/IBM extensions of CP932
+	if s.strict && len(out) == 2 && (out[0] == 0x87 || out[0] >= 0xED) {
+		return nil, false
+	}
+	return out, true
+}
+
+func (s *substituter) replacement(r rune) []byte {
+	text := s.fallback
+	if text == FallbackCodePoint {
+		text = fmt.Sprintf("[U+%04X]", r)
+	}
+	var out []byte
+	for _, fr := range text {
+		b, _ := s.encodeRune(fr)
+		out = append(out, b...)
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func encode(t *testing.T, enc, fallback, text string) ([]byte, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewTextWriter(&buf, enc, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), w.Substituted()
+}
+
+func TestTextWriter_ShiftJIS(t *testing.T) {
+	tests := []struct {
+		enc, fallback, text string
+		want                string
+		substituted         int
+	}{
+		{"cp932", "", "株式会社①㈱", "株式会社①㈱", 0},
+		{"shift-jis", "", "株式会社①㈱", "株式会社??", 2},
+		{"cp932", "〓", "𠮷野家😀", "〓野家〓", 2},
+		{"cp932", "codepoint", "𠮷野家", "[U+20BB7]野家", 1},
+	}
+	for _, tt := range tests {
+		out, n := encode(t, tt.enc, tt.fallback, tt.text)
+		got, err := japanese.ShiftJIS.NewDecoder().Bytes(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want || n != tt.substituted {
+			t.Errorf("%s/%q: got %q (%d substituted), want %q (%d)", tt.enc, tt.fallback, got, n, tt.want, tt.substituted)
+		}
+	}
+}
+
+func TestTextWriter_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewTextWriter(&buf, "latin1", ""); err == nil {
+		t.Error("unknown encoding accepted")
+	}
+	if _, err := NewTextWriter(&buf, "shift-jis", "😀"); err == nil {
+		t.Error("unencodable fallback accepted")
+	}
+	w, _ := NewTextWriter(&buf, "cp932", "error")
+	if _, err := w.Write([]byte("𠮷")); err == nil {
+		t.Error("fallback error did not fail")
+	}
+}
+
+func TestTextWriter_Unicode(t *testing.T) {
+	out, _ := encode(t, "utf-8-bom", "", "𠮷")
+	if string(out) != "\xEF\xBB\xBF𠮷" {
+		t.Errorf("utf-8-bom: got %q", out)
+	}
+	out, _ = encode(t, "utf-16le", "", "𠮷a")
+	got, err := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(out)
+	if err != nil || string(got) != "𠮷a" {
+		t.Errorf("utf-16le: got %q, %v", got, err)
+	}
+}
+
+func TestReportName(t *testing.T) {
+	ts := time.Date(2026, 5, 1, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Dir: "out"}, filepath.Join("out", "replacement_report_20260501_093000.csv")},
+		{Options{Dir: "out", Format: "xlsx", Name: "{job}/{mode}_{date}"}, filepath.Join("out", "weekly", "replace_20260501.xlsx")},
+		{Options{Dir: "out", Format: "tsv", Name: "report_{time}.txt"}, filepath.Join("out", "report_093000.txt")},
+	}
+	for _, tt := range tests {
+		tt.opts.Mode, tt.opts.Job = "replace", "weekly"
+		if got := ReportName(tt.opts, ts); got != tt.want {
+			t.Errorf("ReportName(%+v) = %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+
+	// Without a job the name stays in Dir; absolute templates are kept
+	if got, want := ReportName(Options{Dir: "out", Name: "{job}/{mode}_{date}", Mode: "replace"}, ts), filepath.Join("out", "replace_20260501.csv"); got != want {
+		t.Errorf("empty {job}: got %s, want %s", got, want)
+	}
+	abs := filepath.Join(t.TempDir(), "{mode}.csv")
+	if got, want := ReportName(Options{Dir: "out", Name: abs, Mode: "search"}, ts), strings.Replace(abs, "{mode}", "search", 1); got != want {
+		t.Errorf("absolute template: got %s, want %s", got, want)
+	}
+}
+
+func TestGenerate_CSVSubstitution(t *testing.T) {
+	changes := []Change{{FilePath: "a.xlsx", Sheet: "S", Cell: "A1", OldValue: "𠮷野家", NewValue: "吉野家", Status: "Success"}}
+	out, err := Generate(changes, Summary{}, Options{Dir: t.TempDir(), Name: "sub/report", Encoding: "shift-jis"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Substituted != 1 {
+		t.Errorf("substituted = %d, want 1", out.Substituted)
+	}
+	data, err := os.ReadFile(out.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if !strings.Contains(string(text), "?野家,吉野家") {
+		t.Errorf("unexpected report:\n%s", text)
+	}
+}
@@ -0,0 +1,119 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultGrepTemplate prints hits like Sakura Editor's Grep so that editors can tag-jump to them.
+const DefaultGrepTemplate = "{path}({sheet}!{cell}): {text}"
+
+const (
+	colorMatch = "\x1b[1;31m"
+	colorPath  = "\x1b[35m"
+	colorReset = "\x1b[0m"
+)
+
+// GrepFormatter writes one line per change in a grep-like format.
+//
+// Template placeholders:
+//
+//	{path} {file} {sheet} {cell} {text} {new} {status} {entry} {header} {row} {message}
+//
+// {text} is the cell value with matches highlighted when Color is true,
+// {header} the column header and {row} the other cells of the same row
+// (filled only when the search was run with header/row context).
+type GrepFormatter struct {
+	Template string
+	Color    bool
+	// Find returns the [start, end) byte offsets of the matches in a value, used for coloring.
+	Find func(value string) [][2]int
+}
+
+// Format returns the line for a single change, without a trailing newline.
+func (g *GrepFormatter) Format(c Change) string {
+	tmpl := g.Template
+	if tmpl == "" {
+		tmpl = DefaultGrepTemplate
+	}
+	path := c.FilePath
+	if g.Color {
+		path = colorPath + path + colorReset
+	}
+	r := strings.NewReplacer(
+		"{path}", path,
+		"{file}", baseName(c.FilePath),
+		"{sheet}", c.Sheet,
+		"{cell}", c.Cell,
+		"{text}", g.highlight(oneLine(c.OldValue)),
+		"{new}", oneLine(c.NewValue),
+		"{status}", c.Status,
+		"{entry}", c.Entry,
+		"{header}", oneLine(c.Header),
+		"{row}", oneLine(c.RowText),
+		"{message}", c.Message,
+		`\t`, "\t",
+	)
+	return r.Replace(tmpl)
+}
+
+// Write writes all changes, one line each.
+func (g *GrepFormatter) Write(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(w, g.Format(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GrepFormatter) highlight(value string) string {
+	if !g.Color || g.Find == nil {
+		return value
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range g.Find(value) {
+		b.WriteString(value[last:m[0]])
+		b.WriteString(colorMatch + value[m[0]:m[1]] + colorReset)
+		last = m[1]
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// baseName is filepath.Base that also splits on backslashes, so Windows paths
+// in a report read on another OS still give the file name.
+func baseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// oneLine replaces line breaks inside a cell so that each hit stays on one line.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", "↵", "\n", "↵", "\r", "↵").Replace(s)
+}
+
+// UseColor reports whether w is a terminal that should get colored output.
+// mode is "always", "never" or "auto" (terminal and NO_COLOR not set).
+func UseColor(w io.Writer, mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,35 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrepFormatter_Format(t *testing.T) {
+	c := Change{FilePath: `C:\docs\a.xlsx`, Sheet: "表紙", Cell: "B3", OldValue: "旧仕様\nの説明", Header: "項目", RowText: "1 | 旧仕様"}
+
+	g := &GrepFormatter{}
+	if got, want := g.Format(c), `C:\docs\a.xlsx(表紙!B3): 旧仕様↵の説明`; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+
+	g = &GrepFormatter{Template: `{file}\t{cell}\t{header}\t{row}`}
+	if got, want := g.Format(c), "a.xlsx\tB3\t項目\t1 | 旧仕様"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+func TestGrepFormatter_Color(t *testing.T) {
+	g := &GrepFormatter{
+		Template: "{text}",
+		Color:    true,
+		Find: func(value string) [][2]int {
+			i := strings.Index(value, "旧")
+			return [][2]int{{i, i + len("旧")}}
+		},
+	}
+	got := g.Format(Change{OldValue: "新旧"})
+	if want := "新" + colorMatch + "旧" + colorReset; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
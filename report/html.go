@@ -0,0 +1,147 @@
+package report
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed templates/report.html
+var templateFiles embed.FS
+
+var htmlTemplate = template.Must(template.ParseFS(templateFiles, "templates/report.html"))
+
+type htmlReport struct {
+	Generated string
+	Summary   []Param
+	Statuses  []string
+	Sheets    []string
+	Files     []htmlFile
+}
+
+type htmlFile struct {
+	Path string
+	Rows []htmlRow
+}
+
+type htmlRow struct {
+	Sheet, Cell, Header, Status, Message, Entry string
+	Old, New                                    template.HTML // Escaped values with diff markup
+	Search                                      string        // Lower-case text for the client-side filter
+}
+
+// writeHTML writes a self-contained HTML report: changes grouped by file in
+// collapsible sections, with the character-level diff of each cell and
+// filters by status, sheet and text. No external assets are referenced.
+func writeHTML(changes []Change, path string, summary Summary) error {
+	data := htmlReport{Generated: time.Now().Format("2006-01-02 15:04:05")}
+	data.Summary = append(data.Summary, Param{Name: "Generated", Value: data.Generated})
+	if summary.Mode != "" {
+		data.Summary = append(data.Summary, Param{Name: "Mode", Value: summary.Mode})
+	}
+	if summary.Target != "" {
+		data.Summary = append(data.Summary, Param{Name: "Target", Value: summary.Target})
+	}
+	counts := countsOf(changes, summary)
+	data.Summary = append(data.Summary,
+		Param{Name: "Files", Value: fmt.Sprint(summary.Files)},
+		Param{Name: "Hits", Value: fmt.Sprint(counts.Hits)},
+		Param{Name: "Occurrences", Value: fmt.Sprint(counts.Occurrences)},
+		Param{Name: "Failed Cells", Value: fmt.Sprint(counts.FailedCells)},
+		Param{Name: "Failed Files", Value: fmt.Sprint(summary.FailedFiles)},
+		Param{Name: "Duration", Value: summary.Duration.Round(time.Millisecond).String()},
+	)
+	if summary.Cancelled {
+		data.Summary = append(data.Summary, Param{Name: "Cancelled", Value: "only processed files are listed"})
+	}
+	for _, s := range summary.Skipped {
+		data.Summary = append(data.Summary, Param{Name: "Skipped File", Value: fmt.Sprintf("%s (%s)", s.Path, s.Reason)})
+	}
+	data.Summary = append(data.Summary, summary.Parameters...)
+
+	statuses := make(map[string]bool)
+	sheets := make(map[string]bool)
+	fileIndex := make(map[string]int)
+	for _, c := range changes {
+		i, ok := fileIndex[c.FilePath]
+		if !ok {
+			i = len(data.Files)
+			fileIndex[c.FilePath] = i
+			data.Files = append(data.Files, htmlFile{Path: c.FilePath})
+		}
+		oldHTML, newHTML := diffHTML(c)
+		data.Files[i].Rows = append(data.Files[i].Rows, htmlRow{
+			Sheet:   c.Sheet,
+			Cell:    c.Cell,
+			Header:  c.Header,
+			Status:  c.Status,
+			Message: c.Message,
+			Entry:   c.Entry,
+			Old:     oldHTML,
+			New:     newHTML,
+			Search:  strings.ToLower(strings.Join([]string{c.FilePath, c.Sheet, c.Cell, c.Header, c.OldValue, c.NewValue, c.Entry}, "\n")),
+		})
+		statuses[c.Status] = true
+		sheets[c.Sheet] = true
+	}
+	data.Statuses = sortedKeys(statuses)
+	data.Sheets = sortedKeys(sheets)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := htmlTemplate.Execute(file, data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// diffHTML returns the old and new value with the removed and inserted text
+// marked. Unchanged values (search mode) have their matches marked instead.
+func diffHTML(c Change) (template.HTML, template.HTML) {
+	esc := template.HTMLEscapeString
+	if c.OldValue == c.NewValue {
+		var b strings.Builder
+		runes := []rune(c.OldValue)
+		pos := 0
+		for _, m := range c.Matches {
+			if m.Start < pos || m.End > len(runes) {
+				continue
+			}
+			b.WriteString(esc(string(runes[pos:m.Start])))
+			b.WriteString("<mark>" + esc(string(runes[m.Start:m.End])) + "</mark>")
+			pos = m.End
+		}
+		b.WriteString(esc(string(runes[pos:])))
+		return template.HTML(b.String()), template.HTML(b.String())
+	}
+
+	var oldB, newB strings.Builder
+	for _, op := range Diff(c.OldValue, c.NewValue) {
+		switch op.Kind {
+		case '=':
+			oldB.WriteString(esc(op.Text))
+			newB.WriteString(esc(op.Text))
+		case '-':
+			oldB.WriteString("<del>" + esc(op.Text) + "</del>")
+		case '+':
+			newB.WriteString("<ins>" + esc(op.Text) + "</ins>")
+		}
+	}
+	return template.HTML(oldB.String()), template.HTML(newB.String())
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package report
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReport_HTML(t *testing.T) {
+	changes := []Change{
+		{FilePath: "a.xlsx", Sheet: "S", Cell: "A1", OldValue: "旧会社<A>", NewValue: "新会社<A>", Status: "Success"},
+		{FilePath: "b.xlsx", Sheet: "T", Cell: "B2", OldValue: "旧と旧", NewValue: "旧と旧", Status: "Found", Matches: []Match{{0, 1}, {2, 3}}},
+	}
+	path, err := GenerateReportWithSummary(changes, t.TempDir(), "html", Summary{Mode: "replace", Files: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, ".html") {
+		t.Errorf("unexpected report name %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+
+	if n := strings.Count(out, "<html"); n != 1 {
+		t.Errorf("<html appears %d times", n)
+	}
+	for _, want := range []string{
+		"<del>旧</del>会社&lt;A&gt;",
+		"<ins>新</ins>会社&lt;A&gt;",
+		"<mark>旧</mark>と<mark>旧</mark>",
+		`<details open>`,
+		`id="filter-status"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	for _, external := range []string{"src=", "href=\"http", "<link"} {
+		if strings.Contains(out, external) {
+			t.Errorf("report references external content (%s)", external)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// changeRecord is the JSON form of a Change.
+type changeRecord struct {
+	Type    string  `json:"type"` // "change"
+	File    string  `json:"file"`
+	Sheet   string  `json:"sheet"`
+	Cell    string  `json:"cell"`
+	Row     int     `json:"row,omitempty"`
+	Column  int     `json:"column,omitempty"`
+	Old     string  `json:"old"`
+	New     string  `json:"new"`
+	Status  string  `json:"status"`
+	Message string  `json:"message,omitempty"`
+	Error   string  `json:"errorCategory,omitempty"`
+	Entry   string  `json:"entry,omitempty"`
+	Header  string  `json:"header,omitempty"`
+	RowText string  `json:"rowText,omitempty"`
+	Matches []Match `json:"matches"`
+
+	Occurrences int     `json:"occurrences"`
+	NewMatches  []Match `json:"newMatches"`
+	Occurrence  int     `json:"occurrence,omitempty"`
+}
+
+// SummaryRecord is the JSON form of a Summary, as written at the end of json
+// and jsonl reports and printed by the CLI.
+type SummaryRecord struct {
+	Type        string        `json:"type"` // "summary"
+	Mode        string        `json:"mode,omitempty"`
+	Target      string        `json:"target,omitempty"`
+	Parameters  []Param       `json:"parameters"`
+	Files       int           `json:"files"`
+	Hits        int           `json:"hits"`
+	Occurrences int           `json:"occurrences"`
+	FailedCells int           `json:"failedCells"`
+	FailedFiles int           `json:"failedFiles"`
+	Cancelled   bool          `json:"cancelled,omitempty"`
+	FileErrors  []FileError   `json:"fileErrors,omitempty"`
+	Skipped     []SkippedFile `json:"skippedFiles,omitempty"`
+	Started     string        `json:"started,omitempty"`
+	Finished    string        `json:"finished"`
+	DurationMs  int64         `json:"durationMs"`
+	Report      string        `json:"report,omitempty"`
+}
+
+// NewSummaryRecord builds the summary record of a run; report is the report path, if any.
+func NewSummaryRecord(changes []Change, summary Summary, report string) SummaryRecord {
+	counts := countsOf(changes, summary)
+	rec := SummaryRecord{
+		Type:        "summary",
+		Mode:        summary.Mode,
+		Target:      summary.Target,
+		Parameters:  summary.Parameters,
+		Files:       summary.Files,
+		Hits:        counts.Hits,
+		Occurrences: counts.Occurrences,
+		FailedCells: counts.FailedCells,
+		Cancelled:   summary.Cancelled,
+		FailedFiles: summary.FailedFiles,
+		FileErrors:  summary.FileErrors,
+		Skipped:     summary.Skipped,
+		Finished:    time.Now().Format(time.RFC3339),
+		DurationMs:  summary.Duration.Milliseconds(),
+		Report:      report,
+	}
+	if rec.Parameters == nil {
+		rec.Parameters = []Param{}
+	}
+	if !summary.Started.IsZero() {
+		rec.Started = summary.Started.Format(time.RFC3339)
+	}
+	return rec
+}
+
+func newChangeRecord(c Change) changeRecord {
+	rec := changeRecord{
+		Type:    "change",
+		File:    c.FilePath,
+		Sheet:   c.Sheet,
+		Cell:    c.Cell,
+		Old:     c.OldValue,
+		New:     c.NewValue,
+		Status:  c.Status,
+		Message: c.Message,
+		Error:   c.Error,
+		Entry:   c.Entry,
+		Header:  c.Header,
+		RowText: c.RowText,
+		Matches: c.Matches,
+
+		Occurrences: occurrences(c),
+		NewMatches:  c.NewMatches,
+		Occurrence:  c.Occurrence,
+	}
+	if col, row, err := excelize.CellNameToCoordinates(c.Cell); err == nil {
+		rec.Row, rec.Column = row, col
+	}
+	if rec.Matches == nil {
+		rec.Matches = []Match{}
+	}
+	if rec.NewMatches == nil {
+		rec.NewMatches = []Match{}
+	}
+	return rec
+}
+
+// writeJSON writes the changes and the summary as one JSON document
+// ({"changes": [...], "summary": {...}}). Output is UTF-8 without BOM.
+// JSON Lines reports are written by writeRows.
+func writeJSON(changes []Change, path string, summary Summary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	records := make([]changeRecord, len(changes))
+	for i, c := range changes {
+		records[i] = newChangeRecord(c)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(struct {
+		Changes []changeRecord `json:"changes"`
+		Summary SummaryRecord  `json:"summary"`
+	}{records, NewSummaryRecord(changes, summary, path)})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// WriteSummaryJSON prints the summary record of a run as one line of JSON.
+func WriteSummaryJSON(w io.Writer, changes []Change, summary Summary, report string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(NewSummaryRecord(changes, summary, report))
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateReport_JSONL(t *testing.T) {
+	changes := []Change{
+		{FilePath: "a.xlsx", Sheet: "S", Cell: "C12", OldValue: "旧と旧", NewValue: "新と新", Status: "Success",
+			Matches: []Match{{0, 1}, {2, 3}}},
+		{FilePath: "a.xlsx", Sheet: "T", Cell: "A1", OldValue: "旧", NewValue: "新", Status: "Failed", Error: "save", Message: "Save failed"},
+	}
+	summary := Summary{Mode: "replace", Files: 1, Duration: 2 * time.Second, Parameters: []Param{{"Search", "旧"}},
+		Skipped: []SkippedFile{{Path: "b.csv", Reason: "unsupported file type"}}}
+	path, err := GenerateReportWithSummary(changes, t.TempDir(), "jsonl", summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, ".jsonl") {
+		t.Errorf("unexpected report name %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 2 changes and a summary, got %d lines", len(records))
+	}
+	first := records[0]
+	if first["type"] != "change" || first["row"] != 12.0 || first["column"] != 3.0 || len(first["matches"].([]interface{})) != 2 {
+		t.Errorf("unexpected record %v", first)
+	}
+	if records[1]["errorCategory"] != "save" {
+		t.Errorf("missing error category: %v", records[1])
+	}
+	last := records[2]
+	if last["type"] != "summary" || last["hits"] != 1.0 || last["failedCells"] != 1.0 || last["durationMs"] != 2000.0 || last["report"] != path {
+		t.Errorf("unexpected summary %v", last)
+	}
+	if skipped, _ := last["skippedFiles"].([]interface{}); len(skipped) != 1 || skipped[0].(map[string]interface{})["path"] != "b.csv" {
+		t.Errorf("missing skipped files: %v", last["skippedFiles"])
+	}
+}
+
+func TestGenerateReport_JSON(t *testing.T) {
+	path, err := GenerateReportWithSummary(nil, t.TempDir(), "json", Summary{Mode: "search"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var doc struct {
+		Changes []map[string]interface{} `json:"changes"`
+		Summary SummaryRecord            `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Changes == nil || doc.Summary.Type != "summary" || doc.Summary.Mode != "search" {
+		t.Errorf("unexpected document %s", data)
+	}
+}
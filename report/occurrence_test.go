@@ -0,0 +1,57 @@
+package report
+
+import (
+	"encoding/csv"
+	"os"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+func TestOccurrences(t *testing.T) {
+	changes := []Change{
+		{Status: "Success", Occurrences: 3},
+		{Status: "Found", Matches: []Match{{0, 1}, {2, 3}}},
+		{Status: "Found"}, // No match information
+		{Status: "Failed", Occurrences: 5},
+		{Status: "Skipped (limit)", Occurrences: 1},
+	}
+	if got := Occurrences(changes); got != 6 {
+		t.Errorf("Occurrences = %d, want 6", got)
+	}
+	if c := countsOf(changes, Summary{}); c.Hits != 3 || c.Occurrences != 6 || c.FailedCells != 1 {
+		t.Errorf("unexpected counts %+v", c)
+	}
+}
+
+func TestGenerate_PerOccurrence(t *testing.T) {
+	changes := []Change{{
+		FilePath: "a.xlsx", Sheet: "S", Cell: "A1", OldValue: "サーバとサーバ", NewValue: "サーバーとサーバー", Status: "Success",
+		Occurrences: 2, Matches: []Match{{0, 3}, {4, 7}}, NewMatches: []Match{{0, 4}, {5, 9}},
+	}}
+	out, err := Generate(changes, Summary{}, Options{Dir: t.TempDir(), PerOccurrence: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(transform.NewReader(f, japanese.ShiftJIS.NewDecoder())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %q", records)
+	}
+	header := records[0]
+	if header[8] != "Occurrences" || header[9] != "Occurrence" || header[12] != "Replaced With" {
+		t.Errorf("unexpected header %q", header)
+	}
+	second := records[2]
+	if second[8] != "2" || second[9] != "2" || second[10] != "5" || second[11] != "サーバ" || second[12] != "サーバー" {
+		t.Errorf("unexpected row %q", second)
+	}
+}
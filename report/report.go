@@ -1,13 +1,10 @@
 package report
 
 import (
-	"encoding/csv"
-	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
-
-	"golang.org/x/text/encoding/japanese"
-	"golang.org/x/text/transform"
 )
 
 // Change represents a single replacement action in an Excel file.
@@ -17,52 +14,302 @@ type Change struct {
 	Cell     string
 	OldValue string
 	NewValue string
-	Status   string // "Replaced", "Found", "Failed", "Skipped"
-	Message  string // Error message or reason for skip
+	Status   string  // "Found" (search), "Success" (replaced), "Highlighted", "Failed", "Skipped (limit)" or "Skipped (condition)"
+	Message  string  // Error message or reason for skip
+	Entry    string  // Dictionary entries that produced the change (e.g. "glossary.csv:12")
+	Header   string  // Column header (text of the header row) of the cell, if requested
+	RowText  string  // Non-empty cells of the same row, if requested
+	Matches  []Match // Positions of the matches in OldValue
+	Error    string  // Error category of failed changes: "write", "backup" or "save"
+
+	Occurrences int     // Number of matches in the cell
+	NewMatches  []Match // Positions of the replacement texts in NewValue (the matches in search mode)
+	Occurrence  int     // 1-based match number in per-occurrence reports; 0 for whole-cell rows
 }
 
-// GenerateReport creates a CSV or TSV report of all changes.
-func GenerateReport(changes []Change, outputDir string, format string) (string, error) {
-	timestamp := time.Now().Format("20060102_150405")
+// Match is the position of one match in a cell value, in characters (not bytes).
+type Match struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Summary describes the run a report belongs to. Formats that have room for
+// it (xlsx) include it next to the changes.
+type Summary struct {
+	Mode        string    // "search", "replace" or "highlight"
+	Target      string    // Root directory or file list
+	Parameters  []Param   // Search text, dictionary, options, ... in display order
+	Files       int       // Number of processed files
+	FailedFiles int       // Files that could not be opened or saved
+	Started     time.Time // Zero if unknown
+	Duration    time.Duration
+	FileErrors  []FileError   // Files that could not be opened or saved
+	Skipped     []SkippedFile // Listed files that were not processed (-files-from)
+	Cancelled   bool          // The run was interrupted; the report covers the processed files only
+	Counts      *Counts       // Set when the changes are not passed along (streamed reports)
+}
+
+// Counts are the hit and failure counts of a report.
+type Counts struct {
+	Hits        int // Cells
+	Occurrences int // Matches in those cells
+	FailedCells int
+}
 
-	ext := ".csv"
-	separator := ','
-	if format == "tsv" {
-		ext = ".tsv"
-		separator = '\t'
+func (c *Counts) add(change Change) {
+	switch {
+	case change.Status == "Failed":
+		c.FailedCells++
+	case !strings.HasPrefix(change.Status, "Skipped"):
+		c.Hits++
+		c.Occurrences += occurrences(change)
 	}
+}
 
-	filename := fmt.Sprintf("replacement_report_%s%s", timestamp, ext)
-	fullPath := filename
-	if outputDir != "" {
-		fullPath = outputDir + "\\" + filename
+// occurrences returns the number of matches of a change; changes recorded
+// without match information count once.
+func occurrences(c Change) int {
+	switch {
+	case c.Occurrences > 0:
+		return c.Occurrences
+	case len(c.Matches) > 0:
+		return len(c.Matches)
 	}
+	return 1
+}
 
-	file, err := os.Create(fullPath)
-	if err != nil {
-		return "", err
+// Occurrences returns the number of matches in the cells counted by Hits.
+func Occurrences(changes []Change) int {
+	var c Counts
+	for _, change := range changes {
+		c.add(change)
 	}
-	defer file.Close()
+	return c.Occurrences
+}
 
-	// Wrap file with Shift-JIS encoder
-	writer := transform.NewWriter(file, japanese.ShiftJIS.NewEncoder())
-	csvWriter := csv.NewWriter(writer)
-	csvWriter.Comma = separator // Set separator based on format
-	defer csvWriter.Flush()
+// expandOccurrences returns one row per match of c, each with the match
+// number in Occurrence and only its own positions; Occurrences stays the
+// number of matches in the cell. Changes without match
+// information are returned as they are.
+func expandOccurrences(c Change) []Change {
+	if len(c.Matches) == 0 {
+		return []Change{c}
+	}
+	rows := make([]Change, len(c.Matches))
+	for i, m := range c.Matches {
+		row := c
+		row.Occurrence = i + 1
+		row.Occurrences = len(c.Matches)
+		row.Matches = []Match{m}
+		row.NewMatches = nil
+		if i < len(c.NewMatches) {
+			row.NewMatches = []Match{c.NewMatches[i]}
+		}
+		rows[i] = row
+	}
+	return rows
+}
 
-	// Header
-	header := []string{"File Path", "Sheet", "Cell", "Old Value", "New Value", "Status", "Message"}
-	if err := csvWriter.Write(header); err != nil {
-		return "", err
+// countsOf returns summary.Counts, or counts the changes when it is not set.
+func countsOf(changes []Change, summary Summary) Counts {
+	if summary.Counts != nil {
+		return *summary.Counts
 	}
+	var c Counts
+	for _, change := range changes {
+		c.add(change)
+	}
+	return c
+}
 
-	// Data
+// FileError is a file that could not be processed.
+type FileError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SkippedFile is a file of an explicit file list that was not processed.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Param is a named run parameter shown in the report summary.
+type Param struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Hits returns the number of changes that were found or applied.
+func Hits(changes []Change) int {
+	n := 0
 	for _, c := range changes {
-		record := []string{c.FilePath, c.Sheet, c.Cell, c.OldValue, c.NewValue, c.Status, c.Message}
-		if err := csvWriter.Write(record); err != nil {
-			return "", err
+		if c.Status != "Failed" && !strings.HasPrefix(c.Status, "Skipped") {
+			n++
+		}
+	}
+	return n
+}
+
+// Failures returns the number of changes that could not be applied.
+func Failures(changes []Change) int {
+	n := 0
+	for _, c := range changes {
+		if c.Status == "Failed" {
+			n++
+		}
+	}
+	return n
+}
+
+// Skipped returns the number of changes that were deliberately left alone
+// (status "Skipped (...)").
+func Skipped(changes []Change) int {
+	n := 0
+	for _, c := range changes {
+		if strings.HasPrefix(c.Status, "Skipped") {
+			n++
+		}
+	}
+	return n
+}
+
+// DefaultNameTemplate is the report file name used when Options.Name is empty.
+const DefaultNameTemplate = "replacement_report_{timestamp}.{ext}"
+
+// Options says where and how a report is written.
+type Options struct {
+	Format   string // "csv" (default), "tsv", "xlsx", "html", "json" or "jsonl"
+	Dir      string // Directory of the report; ignored when Name is an absolute path
+	Name     string // File name template (see ReportName); default DefaultNameTemplate
+	Encoding string // CSV/TSV encoding (see ParseEncoding); default cp932
+	Fallback string // Replacement for characters the Shift-JIS encodings lack; default "?"
+
+	// PerOccurrence writes one row per match instead of one per cell.
+	PerOccurrence bool
+
+	// Header adds the column header of each cell (Change.Header) to CSV, TSV
+	// and XLSX reports.
+	Header bool
+
+	// AllowFormulas writes CSV/TSV values verbatim instead of escaping the
+	// ones spreadsheet programs would evaluate (see EscapeFormula).
+	AllowFormulas bool
+	Mode          string // Value of {mode} in Name
+	Job           string // Value of {job} in Name
+}
+
+// Output describes a written report.
+type Output struct {
+	Path        string
+	Substituted int // Characters replaced because the encoding could not represent them
+}
+
+// GenerateReport creates a CSV or TSV report of all changes.
+func GenerateReport(changes []Change, outputDir string, format string) (string, error) {
+	return GenerateReportWithSummary(changes, outputDir, format, Summary{})
+}
+
+// GenerateReportWithSummary creates a report of all changes in the given
+// format ("csv", "tsv", "xlsx", "html", "json" or "jsonl").
+func GenerateReportWithSummary(changes []Change, outputDir string, format string, summary Summary) (string, error) {
+	out, err := Generate(changes, summary, Options{Format: format, Dir: outputDir})
+	return out.Path, err
+}
+
+// Generate writes a report of all changes as described by opts.
+func Generate(changes []Change, summary Summary, opts Options) (Output, error) {
+	format := opts.Format
+	if format == "" {
+		format = "csv"
+	}
+	out := Output{Path: ReportName(opts, time.Now())}
+	if dir := filepath.Dir(out.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return out, err
 		}
 	}
 
-	return fullPath, nil
+	// Rows are ordered the same way as streamed reports
+	counts := countsOf(changes, summary)
+	summary.Counts = &counts
+	sorted := append([]Change(nil), changes...)
+	SortChanges(sorted)
+	if opts.PerOccurrence && !Streamable(format) {
+		var rows []Change
+		for _, c := range sorted {
+			rows = append(rows, expandOccurrences(c)...)
+		}
+		sorted = rows
+	}
+
+	switch format {
+	case "xlsx":
+		return out, writeXLSX(sorted, out.Path, summary, opts)
+	case "html":
+		return out, writeHTML(sorted, out.Path, summary)
+	case "json":
+		return out, writeJSON(sorted, out.Path, summary)
+	}
+	return writeRows(out.Path, opts, summary, func() (Change, bool, error) {
+		if len(sorted) == 0 {
+			return Change{}, false, nil
+		}
+		c := sorted[0]
+		sorted = sorted[1:]
+		return c, true, nil
+	})
+}
+
+// ReportName returns the report path for a run started at t. The name
+// template may contain {timestamp} (20060102_150405), {date}, {time}, {mode},
+// {job} and {ext}; the extension is added when the template has none.
+func ReportName(opts Options, t time.Time) string {
+	format := opts.Format
+	if format == "" {
+		format = "csv"
+	}
+	name := opts.Name
+	if name == "" {
+		name = DefaultNameTemplate
+	}
+	absolute := filepath.IsAbs(name)
+	name = strings.NewReplacer(
+		"{timestamp}", t.Format("20060102_150405"),
+		"{date}", t.Format("20060102"),
+		"{time}", t.Format("150405"),
+		"{mode}", opts.Mode,
+		"{job}", opts.Job,
+		"{ext}", format,
+	).Replace(name)
+	if filepath.Ext(name) == "" {
+		name += "." + format
+	}
+	if absolute {
+		return name
+	}
+	// An empty placeholder must not make a relative template absolute, e.g.
+	// "{job}/{mode}" without a job would be "/replace"
+	name = strings.TrimLeft(name, "/"+string(filepath.Separator))
+	return filepath.Join(opts.Dir, name)
+}
+
+// EscapeFormula neutralizes a value that a spreadsheet program would evaluate
+// when opening a CSV file: values starting with =, +, -, @, tab or CR get a
+// leading apostrophe. Values that already start with an apostrophe get one
+// too, so UnescapeFormula recovers every value exactly.
+func EscapeFormula(value string) string {
+	if value == "" {
+		return value
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r', '\'':
+		return "'" + value
+	}
+	return value
+}
+
+// UnescapeFormula reverses EscapeFormula.
+func UnescapeFormula(value string) string {
+	return strings.TrimPrefix(value, "'")
 }
@@ -0,0 +1,70 @@
+package report
+
+import (
+	"encoding/csv"
+	"os"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"\rx", "'\rx"},
+		{"'quoted", "''quoted"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		got := EscapeFormula(tt.in)
+		if got != tt.want {
+			t.Errorf("EscapeFormula(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if back := UnescapeFormula(got); back != tt.in {
+			t.Errorf("UnescapeFormula(%q) = %q, want %q", got, back, tt.in)
+		}
+	}
+}
+
+func TestGenerate_CSVEscapesFormulas(t *testing.T) {
+	changes := []Change{{FilePath: "a.xlsx", Sheet: "S", Cell: "A1", OldValue: "=1+1", NewValue: "'=1+1", Status: "Success", Header: "式"}}
+	read := func(opts Options) []string {
+		t.Helper()
+		opts.Dir = t.TempDir()
+		out, err := Generate(changes, Summary{}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(out.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(transform.NewReader(f, japanese.ShiftJIS.NewDecoder())).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records[1]
+	}
+
+	row := read(Options{})
+	if row[3] != "'=1+1" || row[4] != "''=1+1" {
+		t.Errorf("values not escaped: %q", row)
+	}
+	if UnescapeFormula(row[3]) != changes[0].OldValue || UnescapeFormula(row[4]) != changes[0].NewValue {
+		t.Errorf("escaping is not reversible: %q", row)
+	}
+	if row := read(Options{AllowFormulas: true}); row[3] != "=1+1" {
+		t.Errorf("AllowFormulas escaped the value: %q", row)
+	}
+	if row := read(Options{Header: true}); len(row) != 10 || row[9] != "式" {
+		t.Errorf("missing Column Header: %q", row)
+	}
+}
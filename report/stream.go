@@ -0,0 +1,579 @@
+package report
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sink receives report rows as they are produced, usually the changes of one
+// workbook at a time.
+type Sink interface {
+	Add(changes []Change) error
+}
+
+// Collector is a Sink that keeps every row in memory.
+type Collector struct {
+	Changes []Change
+}
+
+// Add appends changes to c.Changes.
+func (c *Collector) Add(changes []Change) error {
+	c.Changes = append(c.Changes, changes...)
+	return nil
+}
+
+// DefaultRunSize is the number of rows a StreamWriter keeps in memory before
+// it spills them to a sorted temporary file.
+const DefaultRunSize = 100000
+
+// staleRunAge is the age after which the temporary files of a run are assumed
+// to be left over by a crashed process. Running writers touch them on every Add.
+const staleRunAge = 24 * time.Hour
+
+// Streamable reports whether format can be written by a StreamWriter.
+func Streamable(format string) bool {
+	switch format {
+	case "", "csv", "tsv", "jsonl":
+		return true
+	}
+	return false
+}
+
+// StreamWriter is a Sink that writes a CSV, TSV or JSON Lines report without
+// holding every row in memory. Rows are buffered up to RunSize, then sorted and
+// spilled to temporary files next to the report; Finish merges them, so the
+// report is ordered by path, sheet and cell whatever order the files were
+// processed in.
+//
+// While the run is going, every added row is also appended to a partial
+// report (see PartialPath), in the same format but unsorted and without the
+// summary. Finish and Abort remove it, so it is only left behind when the
+// process crashes or is killed.
+type StreamWriter struct {
+	RunSize int // Default: DefaultRunSize
+
+	opts    Options
+	path    string
+	buf     []sortItem
+	seq     int64
+	tmpDir  string
+	runs    []string
+	counts  Counts
+	partial *os.File
+	rows    rowWriter // Writes to partial
+}
+
+// NewStreamWriter prepares a streamed report. Nothing is written to the report
+// path before Finish. Temporary files left in the report directory by crashed
+// runs are removed.
+func NewStreamWriter(opts Options) (*StreamWriter, error) {
+	if !Streamable(opts.Format) {
+		return nil, fmt.Errorf("format %q can not be streamed", opts.Format)
+	}
+	if _, err := ParseEncoding(opts.Encoding); err != nil {
+		return nil, err
+	}
+	w := &StreamWriter{RunSize: DefaultRunSize, opts: opts, path: ReportName(opts, time.Now())}
+	removeStaleRuns(filepath.Dir(w.path), time.Now().Add(-staleRunAge))
+	return w, nil
+}
+
+// removeStaleRuns removes the temporary directories in dir of runs that have
+// not been touched since before.
+func removeStaleRuns(dir string, before time.Time) {
+	matches, _ := filepath.Glob(filepath.Join(dir, ".report-runs-*"))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.IsDir() && info.ModTime().Before(before) {
+			os.RemoveAll(path)
+		}
+	}
+}
+
+// Path returns the path the report is written to.
+func (w *StreamWriter) Path() string {
+	return w.path
+}
+
+// PartialPath returns the path of the partial report, e.g.
+// replacement_report_20260501_093000.partial.csv.
+func (w *StreamWriter) PartialPath() string {
+	ext := filepath.Ext(w.path)
+	return strings.TrimSuffix(w.path, ext) + ".partial" + ext
+}
+
+// Counts returns the counts of the rows added so far.
+func (w *StreamWriter) Counts() Counts {
+	return w.counts
+}
+
+// Add buffers changes, spilling the buffer to disk when it is full, and
+// appends them to the partial report.
+func (w *StreamWriter) Add(changes []Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	w.appendPartial(changes)
+	if w.tmpDir != "" {
+		now := time.Now()
+		os.Chtimes(w.tmpDir, now, now) // Not stale, see removeStaleRuns
+	}
+	for _, c := range changes {
+		w.counts.add(c)
+		w.buf = append(w.buf, newSortItem(c, w.seq))
+		w.seq++
+		if w.RunSize > 0 && len(w.buf) >= w.RunSize {
+			if err := w.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendPartial writes changes to the partial report and flushes them to the
+// file. The partial report is a best effort: when it can not be written, it is
+// dropped and the run goes on.
+func (w *StreamWriter) appendPartial(changes []Change) {
+	if w.partial == nil && w.rows == nil {
+		if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+			w.rows = noRows{}
+			return
+		}
+		f, err := os.Create(w.PartialPath())
+		if err != nil {
+			w.rows = noRows{}
+			return
+		}
+		rows, err := newRowWriter(f, w.opts, w.PartialPath())
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			w.rows = noRows{}
+			return
+		}
+		w.partial, w.rows = f, rows
+	}
+	if w.partial == nil {
+		return
+	}
+	for _, c := range changes {
+		if err := writeChange(w.rows, c, w.opts.PerOccurrence); err != nil {
+			w.closePartial()
+			w.rows = noRows{}
+			return
+		}
+	}
+	if err := w.rows.flush(); err != nil {
+		w.closePartial()
+		w.rows = noRows{}
+	}
+}
+
+// closePartial closes and removes the partial report.
+func (w *StreamWriter) closePartial() {
+	if w.partial != nil {
+		w.partial.Close()
+		os.Remove(w.partial.Name())
+		w.partial = nil
+	}
+}
+
+// runRecord is a row in a spilled run.
+type runRecord struct {
+	Seq    int64
+	Change Change
+}
+
+func (w *StreamWriter) spill() error {
+	if w.tmpDir == "" {
+		dir := filepath.Dir(w.path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		tmpDir, err := os.MkdirTemp(dir, ".report-runs-")
+		if err != nil {
+			return err
+		}
+		w.tmpDir = tmpDir
+	}
+	sortItems(w.buf)
+	path := filepath.Join(w.tmpDir, fmt.Sprintf("run%05d", len(w.runs)))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	enc := gob.NewEncoder(bw)
+	for _, item := range w.buf {
+		if err := enc.Encode(runRecord{Seq: item.seq, Change: item.change}); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	w.runs = append(w.runs, path)
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Finish merges the buffered and spilled rows into the report and removes the
+// temporary files. summary.Counts is filled in from the rows. The report is
+// written under a temporary name and renamed when complete, so the report
+// path never holds a truncated file, also when a cancelled run is finished.
+func (w *StreamWriter) Finish(summary Summary) (Output, error) {
+	defer w.Abort()
+	counts := w.counts
+	summary.Counts = &counts
+
+	sortItems(w.buf)
+	var sources []*cursor
+	for _, path := range w.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			return Output{Path: w.path}, err
+		}
+		defer f.Close()
+		dec := gob.NewDecoder(bufio.NewReader(f))
+		sources = append(sources, &cursor{next: func() (sortItem, bool, error) {
+			var rec runRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				return sortItem{}, false, nil
+			} else if err != nil {
+				return sortItem{}, false, err
+			}
+			return newSortItem(rec.Change, rec.Seq), true, nil
+		}})
+	}
+	buf := w.buf
+	sources = append(sources, &cursor{next: func() (sortItem, bool, error) {
+		if len(buf) == 0 {
+			return sortItem{}, false, nil
+		}
+		item := buf[0]
+		buf = buf[1:]
+		return item, true, nil
+	}})
+
+	merged, err := merge(sources)
+	if err != nil {
+		return Output{Path: w.path}, err
+	}
+	return writeRows(w.path, w.opts, summary, merged)
+}
+
+// Abort removes the temporary files and the partial report without writing
+// a report.
+func (w *StreamWriter) Abort() {
+	if w.tmpDir != "" {
+		os.RemoveAll(w.tmpDir)
+	}
+	w.closePartial()
+	w.tmpDir, w.runs, w.buf = "", nil, nil
+}
+
+// sortItem is a change with its precomputed sort key.
+type sortItem struct {
+	change   Change
+	row, col int
+	seq      int64 // Arrival order; keeps changes of the same cell in order
+}
+
+func newSortItem(c Change, seq int64) sortItem {
+	col, row, _ := excelize.CellNameToCoordinates(c.Cell)
+	return sortItem{change: c, row: row, col: col, seq: seq}
+}
+
+func (a sortItem) less(b sortItem) bool {
+	if a.change.FilePath != b.change.FilePath {
+		return a.change.FilePath < b.change.FilePath
+	}
+	if a.change.Sheet != b.change.Sheet {
+		return a.change.Sheet < b.change.Sheet
+	}
+	if a.row != b.row {
+		return a.row < b.row
+	}
+	if a.col != b.col {
+		return a.col < b.col
+	}
+	return a.seq < b.seq
+}
+
+func sortItems(items []sortItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].less(items[j]) })
+}
+
+// SortChanges orders changes by file path, sheet and cell (row, then column).
+// Changes of the same cell keep their order.
+func SortChanges(changes []Change) {
+	items := make([]sortItem, len(changes))
+	for i, c := range changes {
+		items[i] = newSortItem(c, int64(i))
+	}
+	sortItems(items)
+	for i, item := range items {
+		changes[i] = item.change
+	}
+}
+
+// cursor is the head of one sorted source of a merge.
+type cursor struct {
+	head sortItem
+	next func() (sortItem, bool, error)
+}
+
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int            { return len(h) }
+func (h cursorHeap) Less(i, j int) bool  { return h[i].head.less(h[j].head) }
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// merge returns an iterator over the union of sorted sources, in order.
+func merge(sources []*cursor) (func() (Change, bool, error), error) {
+	h := &cursorHeap{}
+	for _, c := range sources {
+		item, ok, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			c.head = item
+			*h = append(*h, c)
+		}
+	}
+	heap.Init(h)
+	return func() (Change, bool, error) {
+		if h.Len() == 0 {
+			return Change{}, false, nil
+		}
+		c := (*h)[0]
+		change := c.head.change
+		item, ok, err := c.next()
+		if err != nil {
+			return Change{}, false, err
+		}
+		if ok {
+			c.head = item
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+		return change, true, nil
+	}, nil
+}
+
+// writeRows writes a CSV, TSV or JSON Lines report from an iterator over
+// sorted changes. The file is renamed into place once it is complete.
+func writeRows(path string, opts Options, summary Summary, next func() (Change, bool, error)) (Output, error) {
+	out := Output{Path: path}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return out, err
+		}
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return out, err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+	bw := bufio.NewWriter(file)
+
+	rows, err := newRowWriter(bw, opts, path)
+	if err != nil {
+		return out, err
+	}
+	for {
+		c, ok, err := next()
+		if err != nil {
+			return out, err
+		}
+		if !ok {
+			break
+		}
+		if err := writeChange(rows, c, opts.PerOccurrence); err != nil {
+			out.Substituted = rows.substituted()
+			return out, err
+		}
+	}
+	err = rows.finish(summary)
+	out.Substituted = rows.substituted()
+	if err != nil {
+		return out, err
+	}
+	if err := bw.Flush(); err != nil {
+		return out, err
+	}
+	if err := file.Close(); err != nil {
+		return out, err
+	}
+	return out, os.Rename(tmp, path)
+}
+
+// writeChange writes the rows of c: one, or one per occurrence.
+func writeChange(rows rowWriter, c Change, perOccurrence bool) error {
+	expanded := []Change{c}
+	if perOccurrence {
+		expanded = expandOccurrences(c)
+	}
+	for _, row := range expanded {
+		if err := rows.write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowWriter writes the rows of one report format.
+type rowWriter interface {
+	write(c Change) error
+	flush() error // Passes the rows written so far on to the underlying writer
+	finish(summary Summary) error
+	substituted() int
+}
+
+// noRows is the rowWriter of a partial report that could not be written.
+type noRows struct{}
+
+func (noRows) write(Change) error   { return nil }
+func (noRows) flush() error         { return nil }
+func (noRows) finish(Summary) error { return nil }
+func (noRows) substituted() int     { return 0 }
+
+func newRowWriter(w io.Writer, opts Options, path string) (rowWriter, error) {
+	if opts.Format == "jsonl" {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &jsonlRows{enc: enc, path: path}, nil
+	}
+
+	text, err := NewTextWriter(w, opts.Encoding, opts.Fallback)
+	if err != nil {
+		return nil, err
+	}
+	rows := &csvRows{text: text, csv: csv.NewWriter(text), escape: !opts.AllowFormulas, header: opts.Header, perOccurrence: opts.PerOccurrence}
+	if opts.Format == "tsv" {
+		rows.csv.Comma = '\t'
+	}
+	header := []string{"File Path", "Sheet", "Cell", "Old Value", "New Value", "Status", "Message", "Dictionary Entry", "Occurrences"}
+	if opts.Header {
+		header = append(header, "Column Header")
+	}
+	if opts.PerOccurrence {
+		header = append(header, "Occurrence", "Position", "Matched Text", "Replaced With")
+	}
+	if err := rows.csv.Write(header); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+type csvRows struct {
+	text          *TextWriter
+	csv           *csv.Writer
+	escape        bool
+	header        bool
+	perOccurrence bool
+}
+
+func (r *csvRows) write(c Change) error {
+	record := []string{c.FilePath, c.Sheet, c.Cell, c.OldValue, c.NewValue, c.Status, c.Message, c.Entry, fmt.Sprint(occurrences(c))}
+	if r.header {
+		record = append(record, c.Header)
+	}
+	if r.perOccurrence {
+		record = append(record, occurrenceColumns(c)...)
+	}
+	if r.escape {
+		for i := range record {
+			record[i] = EscapeFormula(record[i])
+		}
+	}
+	return r.csv.Write(record)
+}
+
+func (r *csvRows) flush() error {
+	r.csv.Flush()
+	return r.csv.Error()
+}
+
+func (r *csvRows) finish(Summary) error {
+	r.csv.Flush()
+	if err := r.csv.Error(); err != nil {
+		return err
+	}
+	return r.text.Close()
+}
+
+func (r *csvRows) substituted() int {
+	return r.text.Substituted()
+}
+
+type jsonlRows struct {
+	enc  *json.Encoder
+	path string
+}
+
+func (r *jsonlRows) write(c Change) error {
+	return r.enc.Encode(newChangeRecord(c))
+}
+
+func (r *jsonlRows) flush() error {
+	return nil // The encoder writes every record at once
+}
+
+func (r *jsonlRows) finish(summary Summary) error {
+	return r.enc.Encode(NewSummaryRecord(nil, summary, r.path))
+}
+
+func (r *jsonlRows) substituted() int {
+	return 0
+}
+
+// occurrenceColumns returns the Occurrence, Position (1-based character),
+// Matched Text and Replaced With columns of a per-occurrence row.
+func occurrenceColumns(c Change) []string {
+	if c.Occurrence == 0 || len(c.Matches) == 0 {
+		return []string{"", "", "", ""}
+	}
+	m := c.Matches[0]
+	replaced := ""
+	if len(c.NewMatches) > 0 {
+		replaced = runeSlice(c.NewValue, c.NewMatches[0])
+	}
+	return []string{fmt.Sprint(c.Occurrence), fmt.Sprint(m.Start + 1), runeSlice(c.OldValue, m), replaced}
+}
+
+// runeSlice returns the characters of s covered by m, or "" if m is out of range.
+func runeSlice(s string, m Match) string {
+	runes := []rune(s)
+	if m.Start < 0 || m.End > len(runes) || m.Start > m.End {
+		return ""
+	}
+	return string(runes[m.Start:m.End])
+}
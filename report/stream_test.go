@@ -0,0 +1,184 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamWriter_MergesSpilledRuns(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewStreamWriter(Options{Format: "jsonl", Dir: dir, Name: "report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.RunSize = 3
+
+	// Files arrive in worker order, cells in sheet order
+	batches := [][]Change{
+		{{FilePath: "b.xlsx", Sheet: "S", Cell: "A10"}, {FilePath: "b.xlsx", Sheet: "S", Cell: "A2"}},
+		{{FilePath: "a.xlsx", Sheet: "Z", Cell: "B1"}, {FilePath: "a.xlsx", Sheet: "A", Cell: "C3", Status: "Failed"}, {FilePath: "a.xlsx", Sheet: "A", Cell: "AA3"}},
+		{{FilePath: "c.xlsx", Sheet: "S", Cell: "A1", Status: "Skipped (limit)"}, {FilePath: "a.xlsx", Sheet: "A", Cell: "B3"}},
+	}
+	for _, b := range batches {
+		for i := range b {
+			if b[i].Status == "" {
+				b[i].Status = "Found"
+			}
+		}
+		if err := w.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.runs) == 0 {
+		t.Fatal("expected spilled runs")
+	}
+	tmpDir := w.tmpDir
+
+	out, err := w.Finish(Summary{Mode: "search"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Path != filepath.Join(dir, "report.jsonl") {
+		t.Errorf("unexpected path %s", out.Path)
+	}
+	if _, err := os.Stat(tmpDir); !os.IsNotExist(err) {
+		t.Errorf("temporary runs not removed: %v", err)
+	}
+
+	f, err := os.Open(out.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	var last map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["type"] == "change" {
+			got = append(got, fmt.Sprintf("%s/%s!%s", rec["file"], rec["sheet"], rec["cell"]))
+		}
+		last = rec
+	}
+	want := "a.xlsx/A!B3 a.xlsx/A!C3 a.xlsx/A!AA3 a.xlsx/Z!B1 b.xlsx/S!A2 b.xlsx/S!A10 c.xlsx/S!A1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("rows not sorted:\n got %s\nwant %s", strings.Join(got, " "), want)
+	}
+	if last["type"] != "summary" || last["hits"] != 5.0 || last["failedCells"] != 1.0 {
+		t.Errorf("unexpected summary %v", last)
+	}
+}
+
+func TestStreamWriter_PartialAndAbort(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewStreamWriter(Options{Format: "csv", Dir: dir, Name: "partial"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.RunSize = 1
+	w.Add([]Change{{FilePath: "a.xlsx", Sheet: "S", Cell: "A1", OldValue: "x", NewValue: "y", Status: "Success"}})
+
+	// A cancelled run finishes with what it has
+	out, err := w.Finish(Summary{Cancelled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(out.Path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("expected header and one row, got %q", data)
+	}
+
+	w, _ = NewStreamWriter(Options{Format: "tsv", Dir: dir, Name: "aborted"})
+	w.RunSize = 1
+	w.Add([]Change{{FilePath: "a.xlsx", Sheet: "S", Cell: "A1"}})
+	w.Abort()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("abort left files behind: %v", entries)
+	}
+}
+
+func TestStreamWriter_PartialReport(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewStreamWriter(Options{Format: "csv", Dir: dir, Name: "crash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add([]Change{{FilePath: "b.xlsx", Sheet: "S", Cell: "A1", Status: "Found"}})
+	w.Add([]Change{{FilePath: "a.xlsx", Sheet: "S", Cell: "A1", Status: "Found"}})
+
+	// What a crash at this point leaves behind: the rows so far, unsorted
+	if w.PartialPath() != filepath.Join(dir, "crash.partial.csv") {
+		t.Errorf("unexpected partial path %s", w.PartialPath())
+	}
+	data, err := os.ReadFile(w.PartialPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "b.xlsx") || !strings.HasPrefix(lines[2], "a.xlsx") {
+		t.Errorf("unexpected partial report %q", data)
+	}
+
+	if _, err := w.Finish(Summary{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(w.PartialPath()); !os.IsNotExist(err) {
+		t.Errorf("partial report not removed: %v", err)
+	}
+}
+
+func TestNewStreamWriter_RemovesStaleRuns(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, ".report-runs-1")
+	live := filepath.Join(dir, ".report-runs-2")
+	for _, d := range []string{stale, live} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleRunAge)
+	os.Chtimes(stale, old, old)
+
+	if _, err := NewStreamWriter(Options{Format: "csv", Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale runs not removed: %v", err)
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Errorf("runs of a live writer removed: %v", err)
+	}
+}
+
+func TestSortChanges(t *testing.T) {
+	changes := []Change{
+		{FilePath: "a", Sheet: "S", Cell: "B1", Status: "2"},
+		{FilePath: "a", Sheet: "S", Cell: "A1"},
+		{FilePath: "a", Sheet: "S", Cell: "B1", Status: "3"},
+	}
+	SortChanges(changes)
+	if changes[0].Cell != "A1" || changes[1].Status != "2" || changes[2].Status != "3" {
+		t.Errorf("unexpected order %+v", changes)
+	}
+}
+
+func TestStreamable(t *testing.T) {
+	for format, want := range map[string]bool{"": true, "csv": true, "tsv": true, "jsonl": true, "json": false, "xlsx": false, "html": false} {
+		if Streamable(format) != want {
+			t.Errorf("Streamable(%q) = %v", format, !want)
+		}
+	}
+	if _, err := NewStreamWriter(Options{Format: "xlsx"}); err == nil {
+		t.Error("xlsx accepted")
+	}
+}
@@ -0,0 +1,217 @@
+package report
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	summarySheet = "Summary"
+	detailsSheet = "Details"
+)
+
+// detailsHeader and detailsWidths are the columns of the Details sheet.
+var (
+	detailsHeader = []string{"File Path", "Sheet", "Cell", "Old Value", "New Value", "Status", "Message", "Dictionary Entry", "Occurrences"}
+	detailsWidths = []float64{60, 18, 10, 50, 50, 10, 30, 24, 12}
+
+	// Added to the Details sheet of per-occurrence reports
+	occurrenceHeader = []string{"Occurrence", "Position", "Matched Text", "Replaced With"}
+	occurrenceWidths = []float64{12, 10, 24, 24}
+)
+
+// writeXLSX writes the report as a workbook with a Summary and a Details sheet.
+// The Cell column links to the changed cell, and the changed text of the old
+// and new values is highlighted.
+func writeXLSX(changes []Change, path string, summary Summary, opts Options) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", summarySheet); err != nil {
+		return err
+	}
+	if _, err := f.NewSheet(detailsSheet); err != nil {
+		return err
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"4472C4"}},
+	})
+	if err != nil {
+		return err
+	}
+	linkStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "0563C1", Underline: "single"}})
+	if err != nil {
+		return err
+	}
+
+	if err := writeSummarySheet(f, changes, summary, headerStyle); err != nil {
+		return err
+	}
+
+	// Details
+	header := append([]string(nil), detailsHeader...)
+	widths := append([]float64(nil), detailsWidths...)
+	if opts.Header {
+		header = append(header, "Column Header")
+		widths = append(widths, 20)
+	}
+	if opts.PerOccurrence {
+		header = append(header, occurrenceHeader...)
+		widths = append(widths, occurrenceWidths...)
+	}
+	if err := f.SetSheetRow(detailsSheet, "A1", &header); err != nil {
+		return err
+	}
+	lastCol, _ := excelize.ColumnNumberToName(len(header))
+	f.SetCellStyle(detailsSheet, "A1", lastCol+"1", headerStyle)
+	for i, width := range widths {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetColWidth(detailsSheet, col, col, width)
+	}
+
+	for i, c := range changes {
+		row := i + 2
+		// Values are always written as strings, so the report never evaluates cell content
+		record := []interface{}{c.FilePath, c.Sheet, c.Cell, c.OldValue, c.NewValue, c.Status, c.Message, c.Entry, occurrences(c)}
+		if opts.Header {
+			record = append(record, c.Header)
+		}
+		if opts.PerOccurrence {
+			for _, v := range occurrenceColumns(c) {
+				record = append(record, v)
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err := f.SetSheetRow(detailsSheet, cell, &record); err != nil {
+			return err
+		}
+
+		// Links beyond Excel's per-sheet limit are left out; the rows are still written
+		if i < excelize.TotalSheetHyperlinks {
+			linkCell, _ := excelize.CoordinatesToCellName(3, row)
+			tooltip := fmt.Sprintf("%s を開く", filepath.Base(c.FilePath))
+			if err := f.SetCellHyperLink(detailsSheet, linkCell, cellLink(c), "External", excelize.HyperlinkOpts{Tooltip: &tooltip}); err != nil {
+				return err
+			}
+			f.SetCellStyle(detailsSheet, linkCell, linkCell, linkStyle)
+		}
+
+		if c.OldValue != c.NewValue {
+			oldRuns, newRuns := diffRuns(Diff(c.OldValue, c.NewValue))
+			oldCell, _ := excelize.CoordinatesToCellName(4, row)
+			newCell, _ := excelize.CoordinatesToCellName(5, row)
+			if err := f.SetCellRichText(detailsSheet, oldCell, oldRuns); err != nil {
+				return err
+			}
+			if err := f.SetCellRichText(detailsSheet, newCell, newRuns); err != nil {
+				return err
+			}
+		}
+	}
+
+	lastCell, _ := excelize.CoordinatesToCellName(len(header), len(changes)+1)
+	if err := f.AutoFilter(detailsSheet, "A1:"+lastCell, nil); err != nil {
+		return err
+	}
+	if err := f.SetPanes(detailsSheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+
+	return f.SaveAs(path)
+}
+
+func writeSummarySheet(f *excelize.File, changes []Change, summary Summary, headerStyle int) error {
+	counts := countsOf(changes, summary)
+	rows := [][]interface{}{{"Item", "Value"}}
+	if !summary.Started.IsZero() {
+		rows = append(rows, []interface{}{"Started", summary.Started.Format("2006-01-02 15:04:05")})
+	}
+	rows = append(rows, []interface{}{"Generated", time.Now().Format("2006-01-02 15:04:05")})
+	if summary.Mode != "" {
+		rows = append(rows, []interface{}{"Mode", summary.Mode})
+	}
+	if summary.Target != "" {
+		rows = append(rows, []interface{}{"Target", summary.Target})
+	}
+	rows = append(rows,
+		[]interface{}{"Files", summary.Files},
+		[]interface{}{"Hits", counts.Hits},
+		[]interface{}{"Occurrences", counts.Occurrences},
+		[]interface{}{"Failed Cells", counts.FailedCells},
+		[]interface{}{"Failed Files", summary.FailedFiles},
+		[]interface{}{"Duration", summary.Duration.Round(time.Millisecond).String()},
+	)
+	if summary.Cancelled {
+		rows = append(rows, []interface{}{"Cancelled", "The run was interrupted; only processed files are listed"})
+	}
+	for _, s := range summary.Skipped {
+		rows = append(rows, []interface{}{"Skipped File", fmt.Sprintf("%s (%s)", s.Path, s.Reason)})
+	}
+	for _, p := range summary.Parameters {
+		rows = append(rows, []interface{}{p.Name, p.Value})
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(summarySheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	f.SetCellStyle(summarySheet, "A1", "B1", headerStyle)
+	f.SetColWidth(summarySheet, "A", "A", 18)
+	f.SetColWidth(summarySheet, "B", "B", 80)
+	return nil
+}
+
+// cellLink returns a hyperlink that opens the workbook of c at its sheet and cell.
+func cellLink(c Change) string {
+	path := c.FilePath
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sheet := strings.ReplaceAll(c.Sheet, "'", "''")
+	return fileURL(filepath.ToSlash(path)) + "#'" + sheet + "'!" + c.Cell
+}
+
+// fileURL returns the file URL of an absolute, slash-separated path, with
+// spaces, '#', '%' and non-ASCII characters escaped. UNC paths
+// (//server/share/...) become file://server/share/...
+func fileURL(path string) string {
+	u := url.URL{Scheme: "file", Path: path}
+	if strings.HasPrefix(path, "//") {
+		u.Host, u.Path, _ = strings.Cut(path[2:], "/")
+		u.Path = "/" + u.Path
+	} else if !strings.HasPrefix(path, "/") {
+		u.Path = "/" + path // C:/dir -> file:///C:/dir
+	}
+	return u.String()
+}
+
+// diffRuns renders a diff as rich text: removed text is red and struck through
+// in the old value, inserted text is blue and bold in the new value.
+func diffRuns(ops []DiffOp) (oldRuns, newRuns []excelize.RichTextRun) {
+	for _, op := range ops {
+		switch op.Kind {
+		case '=':
+			oldRuns = append(oldRuns, excelize.RichTextRun{Text: op.Text})
+			newRuns = append(newRuns, excelize.RichTextRun{Text: op.Text})
+		case '-':
+			oldRuns = append(oldRuns, excelize.RichTextRun{Text: op.Text, Font: &excelize.Font{Color: "C00000", Strike: true}})
+		case '+':
+			newRuns = append(newRuns, excelize.RichTextRun{Text: op.Text, Font: &excelize.Font{Color: "2980C4", Bold: true}})
+		}
+	}
+	// Rich text needs at least one run; an empty value stays empty
+	if len(oldRuns) == 0 {
+		oldRuns = []excelize.RichTextRun{{Text: ""}}
+	}
+	if len(newRuns) == 0 {
+		newRuns = []excelize.RichTextRun{{Text: ""}}
+	}
+	return oldRuns, newRuns
+}
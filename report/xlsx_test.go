@@ -0,0 +1,73 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestGenerateReport_XLSX(t *testing.T) {
+	dir := t.TempDir()
+	changes := []Change{
+		{FilePath: `C:\docs\仕様書.xlsx`, Sheet: "Bob's sheet", Cell: "B2", OldValue: "旧仕様", NewValue: "新仕様", Status: "Success"},
+		{FilePath: `C:\docs\仕様書.xlsx`, Sheet: "表紙", Cell: "A1", OldValue: "=旧仕様", NewValue: "=新仕様", Status: "Failed", Message: "Save failed"},
+	}
+	summary := Summary{Mode: "replace", Target: `C:\docs`, Files: 3, Duration: 1500 * time.Millisecond,
+		Parameters: []Param{{Name: "Search", Value: "旧仕様"}}}
+
+	path, err := GenerateReportWithSummary(changes, dir, "xlsx", summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if sheets := f.GetSheetList(); len(sheets) != 2 || sheets[0] != "Summary" || sheets[1] != "Details" {
+		t.Fatalf("unexpected sheets %v", sheets)
+	}
+	rows, _ := f.GetRows("Summary")
+	values := make(map[string]string)
+	for _, r := range rows {
+		if len(r) == 2 {
+			values[r[0]] = r[1]
+		}
+	}
+	if values["Hits"] != "1" || values["Failed Cells"] != "1" || values["Files"] != "3" || values["Search"] != "旧仕様" || values["Duration"] != "1.5s" {
+		t.Errorf("unexpected summary %v", values)
+	}
+
+	ok, link, _ := f.GetCellHyperLink("Details", "C2")
+	// The path is escaped; the sheet and cell are not
+	if !ok || !strings.HasPrefix(link, "file:///") || !strings.HasSuffix(link, `%E4%BB%95%E6%A7%98%E6%9B%B8.xlsx#'Bob''s sheet'!B2`) {
+		t.Errorf("unexpected link %q", link)
+	}
+	runs, _ := f.GetCellRichText("Details", "E2")
+	if len(runs) != 2 || runs[0].Text != "新" || runs[0].Font == nil || !runs[0].Font.Bold {
+		t.Errorf("unexpected rich text %+v", runs)
+	}
+	// Values that look like formulas stay text
+	if formula, _ := f.GetCellFormula("Details", "D3"); formula != "" {
+		t.Errorf("value written as formula %q", formula)
+	}
+	if panes, _ := f.GetPanes("Details"); !panes.Freeze || panes.YSplit != 1 {
+		t.Errorf("header not frozen: %+v", panes)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/home/a/b.xlsx", "file:///home/a/b.xlsx"},
+		{"C:/docs/仕様 #1 100%.xlsx", "file:///C:/docs/%E4%BB%95%E6%A7%98%20%231%20100%25.xlsx"},
+		{"//server/share/a b.xlsx", "file://server/share/a%20b.xlsx"},
+	}
+	for _, tt := range tests {
+		if got := fileURL(tt.path); got != tt.want {
+			t.Errorf("fileURL(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
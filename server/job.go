@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"excel_converter/job"
+)
+
+// toJob converts a web request into a job definition.
+func (req Request) toJob() job.Job {
+	j := job.Job{
+		Name:              req.Name,
+		Root:              req.Dir,
+		ExcludeExtensions: req.ExcludeExtensions,
+		ExcludeDir:        req.ExcludeDir,
+		Files:             req.Files,
+		Mode:              "replace",
+		Search:            req.Search,
+		Replace:           req.Replace,
+		IgnoreCase:        req.IgnoreCase,
+		Regex:             req.Regex,
+		WholeCell:         req.WholeCell,
+		Pairs:             req.Pairs,
+		Dictionary:        req.Dictionary,
+		Limit:             req.Limit,
+		Scope:             req.Scope,
+		Highlight:         req.Highlight,
+		NoteOld:           req.NoteOld,
+		ChangeLog:         req.ChangeLog,
+		Operator:          req.Operator,
+		Report: job.Report{
+			Format:   req.Format,
+			Dir:      req.ReportDir,
+			Name:     req.ReportName,
+			Encoding: req.Encoding,
+			Fallback: req.Fallback,
+
+			AllowFormulas: req.AllowFormulas,
+			PerOccurrence: req.PerOccurrence,
+			Verbose:       req.Verbose,
+		},
+		Backup: job.Backup{Dir: req.BackupDir, Timestamped: req.BackupTimestamped},
+	}
+	switch {
+	case req.SearchOnly:
+		j.Mode = "search"
+	case req.Mode == "highlight":
+		j.Mode = "highlight"
+		j.Replace = ""
+	}
+	// The web UI chooses replace mode explicitly, so an empty replacement means "delete"
+	if j.Mode == "replace" && j.Replace == "" {
+		j.ReplaceWithEmpty = true
+	}
+	// A dictionary or inline pairs take precedence over the single search text
+	if j.Dictionary != "" || len(j.Pairs) > 0 {
+		j.Search, j.Replace = "", ""
+		if j.Dictionary != "" {
+			j.Pairs = nil
+		}
+	}
+	return j
+}
+
+// requestFromJob converts a job definition into a web request for the form.
+func requestFromJob(j job.Job) Request {
+	return Request{
+		Name:              j.Name,
+		Dir:               j.Root,
+		Search:            j.Search,
+		Replace:           j.Replace,
+		SearchOnly:        j.SearchOnly(),
+		Mode:              j.Mode,
+		ExcludeExtensions: j.ExcludeExtensions,
+		ExcludeDir:        j.ExcludeDir,
+		Files:             j.Files,
+		Limit:             j.Limit,
+		Scope:             j.Scope,
+		Highlight:         j.Highlight,
+		NoteOld:           j.NoteOld,
+		ChangeLog:         j.ChangeLog,
+		Operator:          j.Operator,
+		Format:            j.Report.Format,
+		Dictionary:        j.Dictionary,
+		IgnoreCase:        j.IgnoreCase,
+		Regex:             j.Regex,
+		WholeCell:         j.WholeCell,
+		Pairs:             j.Pairs,
+		ReportDir:         j.Report.Dir,
+		ReportName:        j.Report.Name,
+		Encoding:          j.Report.Encoding,
+		Fallback:          j.Report.Fallback,
+		AllowFormulas:     j.Report.AllowFormulas,
+		PerOccurrence:     j.Report.PerOccurrence,
+		Verbose:           j.Report.Verbose,
+		BackupDir:         j.Backup.Dir,
+		BackupTimestamped: j.Backup.Timestamped,
+	}
+}
+
+// handleJobLoad returns the jobs of a job file as requests: GET /api/job/load?path=...
+func handleJobLoad(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Path required", http.StatusBadRequest)
+		return
+	}
+	f, err := job.Load(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var jobs []Request
+	for _, j := range f.Jobs {
+		jobs = append(jobs, requestFromJob(j))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": jobs})
+}
+
+// handleJobSave writes the current form as a single-job file: POST /api/job/save
+func handleJobSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Path      string  `json:"path"`
+		Overwrite bool    `json:"overwrite"` // Replace an existing file (the UI asks first)
+		Request   Request `json:"request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Path == "" {
+		http.Error(w, "Path required", http.StatusBadRequest)
+		return
+	}
+	if !strings.EqualFold(filepath.Ext(body.Path), ".json") {
+		http.Error(w, "Job files must have the .json extension", http.StatusBadRequest)
+		return
+	}
+
+	j := body.Request.toJob()
+	if j.Name == "" {
+		j.Name = fmt.Sprintf("job %s", time.Now().Format("2006-01-02"))
+	}
+	if err := j.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := job.Save(body.Path, &job.File{Jobs: []job.Job{j}}, body.Overwrite); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			http.Error(w, fmt.Sprintf("%s already exists", body.Path), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"path": body.Path})
+}
@@ -1,11 +1,12 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
 	"io/fs"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -14,7 +15,10 @@ import (
 	"sync"
 	"time"
 
+	"excel_converter/excel"
+	"excel_converter/job"
 	"excel_converter/processor"
+	"excel_converter/replacer"
 	"excel_converter/report"
 	"excel_converter/utils"
 )
@@ -23,13 +27,38 @@ import (
 var staticFiles embed.FS
 
 type Request struct {
-	Dir               string   `json:"dir"`
-	Search            string   `json:"search"`
-	Replace           string   `json:"replace"`
-	SearchOnly        bool     `json:"searchOnly"`
-	ExcludeExtensions []string `json:"excludeExtensions"`
-	ExcludeDir        string   `json:"excludeDir"`
-	Format            string   `json:"format"` // "csv" or "tsv"
+	Dir               string        `json:"dir"`
+	Search            string        `json:"search"`
+	Replace           string        `json:"replace"`
+	SearchOnly        bool          `json:"searchOnly"`
+	Mode              string        `json:"mode,omitempty"` // "highlight" marks the hits instead of replacing them
+	ExcludeExtensions []string      `json:"excludeExtensions"`
+	ExcludeDir        string        `json:"excludeDir"`
+	Format            string        `json:"format"`     // "csv", "tsv", "xlsx", "html", "json" or "jsonl"
+	Encoding          string        `json:"encoding"`   // CSV/TSV encoding (see report.ParseEncoding)
+	Dictionary        string        `json:"dictionary"` // Optional CSV/TSV/XLSX of search/replace pairs
+	Files             job.Files     `json:"files"`      // Advanced file selection
+	Limit             job.Limit     `json:"limit"`      // Replace only some occurrences
+	Scope             job.Scope     `json:"scope"`      // Sheets and cells to process
+	Highlight         job.Highlight `json:"highlight"`  // Style of highlighted or replaced cells
+	NoteOld           bool          `json:"noteOld"`    // Note the previous value on replaced cells
+	ChangeLog         string        `json:"changeLog"`  // Sheet listing the replaced cells ("" = none)
+
+	// Job file settings that have no form field yet but survive load/save
+	Name              string     `json:"name,omitempty"`
+	IgnoreCase        bool       `json:"ignoreCase,omitempty"`
+	Regex             bool       `json:"regex,omitempty"`
+	WholeCell         bool       `json:"wholeCell,omitempty"`
+	Pairs             []job.Pair `json:"pairs,omitempty"`
+	ReportDir         string     `json:"reportDir,omitempty"`
+	ReportName        string     `json:"reportName,omitempty"`
+	Fallback          string     `json:"fallback,omitempty"`
+	AllowFormulas     bool       `json:"allowFormulas,omitempty"`
+	PerOccurrence     bool       `json:"perOccurrence,omitempty"`
+	Verbose           bool       `json:"verbose,omitempty"`
+	Operator          string     `json:"operator,omitempty"`
+	BackupDir         string     `json:"backupDir,omitempty"`
+	BackupTimestamped bool       `json:"backupTimestamped,omitempty"`
 }
 
 type StatusResponse struct {
@@ -39,8 +68,11 @@ type StatusResponse struct {
 	TotalFiles        int            `json:"totalFiles"`
 	ProcessedFiles    int            `json:"processedFiles"`
 	TotalReplacements int            `json:"totalReplacements"`
+	TotalOccurrences  int            `json:"totalOccurrences"`
+	Skipped           int            `json:"skipped,omitempty"` // Cells left alone by the occurrence limit or a row condition
 	Message           string         `json:"message"`
 	ReportPath        string         `json:"reportPath"`
+	Substituted       int            `json:"substituted,omitempty"` // Characters the report encoding could not represent
 	WorkerCounts      map[string]int `json:"workerCounts"`
 }
 
@@ -56,25 +88,51 @@ func noCacheWrapper(next http.Handler) http.Handler {
 	})
 }
 
-func StartServer(port string) {
+// StartServer serves the web UI on port until the server fails; an error
+// binding the port is returned at once.
+func StartServer(port string) error {
+	l, err := Listen(port)
+	if err != nil {
+		return err
+	}
+	return Serve(l)
+}
+
+// Listen binds the port of the web UI. Binding before serving lets callers
+// that serve in the background report a port that is already in use.
+func Listen(port string) (net.Listener, error) {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, fmt.Errorf("web UI: %w", err)
+	}
+	fmt.Printf("Starting server at http://localhost:%s\n", port)
+	return l, nil
+}
+
+// Serve serves the web UI on l until it fails.
+func Serve(l net.Listener) error {
+	mux := http.NewServeMux()
+
 	// Serve static files
 	staticFS, err := fs.Sub(staticFiles, "static")
 	if err != nil {
-		log.Fatal(err)
+		l.Close()
+		return err
 	}
-	http.Handle("/", noCacheWrapper(http.FileServer(http.FS(staticFS))))
+	mux.Handle("/", noCacheWrapper(http.FileServer(http.FS(staticFS))))
 
 	// API Endpoints
-	http.HandleFunc("/api/run", handleRun)
-	http.HandleFunc("/api/status", handleStatus)
-	http.HandleFunc("/api/browse", handleBrowse)
-	http.HandleFunc("/api/download", handleDownload)
-	http.HandleFunc("/api/shutdown", handleShutdown)
-
-	fmt.Printf("Starting server at http://localhost:%s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
-	}
+	mux.HandleFunc("/api/run", handleRun)
+	mux.HandleFunc("/api/preview", handlePreview)
+	mux.HandleFunc("/api/status", handleStatus)
+	mux.HandleFunc("/api/browse", handleBrowse)
+	mux.HandleFunc("/api/download", handleDownload)
+	mux.HandleFunc("/api/shutdown", handleShutdown)
+	mux.HandleFunc("/api/job/load", handleJobLoad)
+	mux.HandleFunc("/api/job/save", handleJobSave)
+	mux.HandleFunc("/api/watch", handleWatch)
+
+	return http.Serve(l, mux)
 }
 
 func handleBrowse(w http.ResponseWriter, r *http.Request) {
@@ -188,6 +246,35 @@ func handleRun(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
 }
 
+// handlePreview returns the files a run would process, without processing them.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j := req.toJob()
+	filter, err := j.Filter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, err := processor.CollectTargetFilesWithFilter(req.Dir, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if files == nil {
+		files = []string{}
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"files": files})
+}
+
 func runProcessing(req Request) {
 	defer func() {
 		statusMutex.Lock()
@@ -195,8 +282,64 @@ func runProcessing(req Request) {
 		statusMutex.Unlock()
 	}()
 
+	// 0. Build rules (dictionary, pairs or single pair)
+	j := req.toJob()
+	rules, err := j.Rules()
+	if err != nil {
+		updateStatus(func(s *StatusResponse) {
+			s.Message = fmt.Sprintf("Error loading dictionary: %v", err)
+		})
+		return
+	}
+	rep, err := replacer.New(rules)
+	if err != nil {
+		updateStatus(func(s *StatusResponse) {
+			s.Message = fmt.Sprintf("Error: %v", err)
+		})
+		return
+	}
+
+	if err := j.ReplaceLimit().Validate(); err != nil {
+		updateStatus(func(s *StatusResponse) {
+			s.Message = fmt.Sprintf("Error: %v", err)
+		})
+		return
+	}
+	if _, err := j.CellScope().Filter(); err != nil {
+		updateStatus(func(s *StatusResponse) {
+			s.Message = fmt.Sprintf("Error: %v", err)
+		})
+		return
+	}
+	if sheet := j.ChangeLogSheet(); sheet != "" {
+		if err := excel.ValidateSheetName(sheet); err != nil {
+			updateStatus(func(s *StatusResponse) {
+				s.Message = fmt.Sprintf("Error: change log: %v", err)
+			})
+			return
+		}
+	}
+	for _, h := range []*excel.Highlight{j.HighlightStyle(), j.ReplaceStyle()} {
+		if h == nil {
+			continue
+		}
+		if err := h.Validate(); err != nil {
+			updateStatus(func(s *StatusResponse) {
+				s.Message = fmt.Sprintf("Error: %v", err)
+			})
+			return
+		}
+	}
+
 	// 1. Collect Files
-	files, err := processor.CollectTargetFiles(req.Dir, req.ExcludeExtensions, req.ExcludeDir)
+	filter, err := j.Filter()
+	if err != nil {
+		updateStatus(func(s *StatusResponse) {
+			s.Message = fmt.Sprintf("Error: %v", err)
+		})
+		return
+	}
+	files, err := processor.CollectTargetFilesWithFilter(req.Dir, filter)
 	if err != nil {
 		updateStatus(func(s *StatusResponse) {
 			s.Message = fmt.Sprintf("Error collecting files: %v", err)
@@ -221,7 +364,23 @@ func runProcessing(req Request) {
 	utils.ForceCloseExcel()
 
 	// 3. Process
-	replacements, changes, err := processor.ProcessFiles(files, req.Search, req.Replace, req.SearchOnly, func(current, total int, path string, workerCounts map[int]int) {
+	started := time.Now()
+	opts := excel.Options{Replacer: rep, SearchOnly: req.SearchOnly, BackupDir: j.BackupDir(time.Now()), BaseDir: req.Dir, Limit: j.ReplaceLimit(), Scope: j.CellScope(), Verbose: j.Report.Verbose, Highlight: j.HighlightStyle(), Style: j.ReplaceStyle(), NoteOld: j.NoteOldValues(), Run: excel.NewRun(started), ChangeLog: j.ChangeLogSheet(), Operator: j.Operator}
+
+	// CSV, TSV and JSON Lines reports are written while the files are processed
+	var changes report.Collector
+	var sink report.Sink = &changes
+	var stream *report.StreamWriter
+	if report.Streamable(req.Format) {
+		if stream, err = report.NewStreamWriter(j.ReportOptions()); err != nil {
+			updateStatus(func(s *StatusResponse) {
+				s.Message = fmt.Sprintf("Error: %v", err)
+			})
+			return
+		}
+		sink = stream
+	}
+	result, err := processor.ProcessFilesToSink(context.Background(), files, opts, sink, func(current, total int, path string, workerCounts map[int]int) {
 		updateStatus(func(s *StatusResponse) {
 			s.ProcessedFiles = current
 			s.CurrentFile = filepath.Base(path)
@@ -237,6 +396,9 @@ func runProcessing(req Request) {
 	})
 
 	if err != nil {
+		if stream != nil {
+			stream.Abort()
+		}
 		updateStatus(func(s *StatusResponse) {
 			s.Message = fmt.Sprintf("Error processing: %v", err)
 		})
@@ -245,19 +407,41 @@ func runProcessing(req Request) {
 
 	// 4. Generate Report
 	var reportPath string
-	if len(changes) > 0 {
-		reportPath, err = report.GenerateReport(changes, req.Dir, req.Format)
+	var substituted int
+	if processor.WantsReport(req.Format, result) {
+		info := processor.RunInfo{Target: req.Dir, Job: j.Name, Options: opts}
+		switch {
+		case j.Dictionary != "":
+			info.Dictionary = j.Dictionary
+		case len(j.Pairs) > 0:
+			info.Pairs = len(j.Pairs)
+		default:
+			info.Search, info.Replace = j.Search, j.Replace
+		}
+		summary := info.Summary(len(files), result, nil)
+		var written report.Output
+		if stream != nil {
+			written, err = stream.Finish(summary)
+		} else {
+			written, err = report.Generate(changes.Changes, summary, j.ReportOptions())
+		}
+		reportPath, substituted = written.Path, written.Substituted
 		if err != nil {
 			updateStatus(func(s *StatusResponse) {
 				s.Message = fmt.Sprintf("Error generating report: %v", err)
 			})
 			return
 		}
+	} else if stream != nil {
+		stream.Abort()
 	}
 
 	updateStatus(func(s *StatusResponse) {
-		s.TotalReplacements = replacements
+		s.TotalReplacements = result.TotalReplacements
+		s.TotalOccurrences = result.TotalOccurrences
+		s.Skipped = result.Skipped
 		s.ReportPath = reportPath
+		s.Substituted = substituted
 		s.Message = "Completed"
 		s.Progress = 100
 	})
@@ -282,10 +466,11 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure filename has .csv or .tsv extension for the browser
+	// Ensure filename has a report extension for the browser
 	filename := filepath.Base(path)
-	lowerFilename := strings.ToLower(filename)
-	if !strings.HasSuffix(lowerFilename, ".csv") && !strings.HasSuffix(lowerFilename, ".tsv") {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".xlsx", ".html", ".json", ".jsonl":
+	default:
 		// Default to csv if unknown, though this shouldn't happen with generated reports
 		filename += ".csv"
 	}
@@ -8,6 +8,7 @@ function toggleMode() {
     } else {
         replaceGroup.style.display = 'none';
     }
+    document.getElementById('highlight-group').style.display = mode === 'search' ? 'none' : 'block';
 }
 
 async function browseDir(targetId = 'dir') {
@@ -55,12 +56,16 @@ async function browseDir(targetId = 'dir') {
     }
 }
 
-async function startProcess() {
+// Job settings without a form field (pairs, backup, ...) kept from the last loaded job file
+let loadedJobExtras = {};
+
+function buildPayload() {
     const dir = document.getElementById('dir').value;
     const search = document.getElementById('search').value;
     const replace = document.getElementById('replace').value;
     const mode = document.querySelector('input[name="mode"]:checked').value;
     const format = document.querySelector('input[name="format"]:checked').value;
+    const encoding = document.getElementById('encoding').value;
 
     // Exclusion settings
     const excludeExtensions = [];
@@ -68,23 +73,231 @@ async function startProcess() {
     if (document.getElementById('exclude-xlsm').checked) excludeExtensions.push('.xlsm');
 
     const excludeDir = document.getElementById('exclude-dir').value;
+    const dictionary = document.getElementById('dictionary').value.trim();
 
-    if (!dir || !search) {
-        alert('ディレクトリと検索文字列は必須です');
-        return;
+    const searchOnly = mode === 'search';
+
+    // Occurrence limit: first N or only the Nth occurrence (or cell) per cell, sheet or file
+    const limitCount = parseInt(document.getElementById('limit-count').value, 10) || 0;
+    const limit = { scope: document.getElementById('limit-scope').value };
+    if (document.getElementById('limit-unit').value === 'cell') {
+        limit.unit = 'cell';
+    }
+    if (document.getElementById('limit-kind').value === 'nth') {
+        limit.nth = limitCount;
+    } else {
+        limit.first = limitCount;
     }
 
-    const searchOnly = mode === 'search';
+    const list = id => document.getElementById(id).value.split(',').map(v => v.trim()).filter(v => v);
+    const files = {
+        include: list('files-include'),
+        exclude: list('files-exclude'),
+        excludeDirs: list('files-exclude-dirs'),
+        maxDepth: parseInt(document.getElementById('files-max-depth').value, 10) || 0,
+        minSize: document.getElementById('files-min-size').value.trim(),
+        maxSize: document.getElementById('files-max-size').value.trim(),
+        modifiedSince: document.getElementById('files-modified-since').value.trim(),
+        modifiedBefore: document.getElementById('files-modified-before').value.trim(),
+        followSymlinks: document.getElementById('files-follow-symlinks').checked,
+        noIgnoreFile: document.getElementById('files-no-ignore-file').checked
+    };
+    const scope = {
+        sheets: list('scope-sheets'),
+        excludeSheets: list('scope-exclude-sheets'),
+        ranges: list('scope-ranges'),
+        columns: list('scope-columns'),
+        headerRows: list('scope-header-rows'),
+        conditions: document.getElementById('scope-conditions').value.split('\n').map(v => v.trim()).filter(v => v),
+        skipHiddenSheets: document.getElementById('scope-skip-hidden-sheets').checked,
+        skipHiddenRows: document.getElementById('scope-skip-hidden-rows').checked,
+        skipHiddenColumns: document.getElementById('scope-skip-hidden-columns').checked
+    };
 
-    const payload = {
+    return Object.assign({}, loadedJobExtras, {
         dir: dir,
         search: search,
         replace: replace,
         searchOnly: searchOnly,
+        mode: mode,
         excludeExtensions: excludeExtensions,
         excludeDir: excludeDir,
-        format: format
+        format: format,
+        encoding: encoding,
+        dictionary: dictionary,
+        files: files,
+        scope: scope,
+        limit: limit,
+        noteOld: document.getElementById('note-old').checked,
+        changeLog: document.getElementById('change-log').checked ? (document.getElementById('change-log-sheet').value.trim() || '変更ログ') : '',
+        highlight: {
+            fill: document.getElementById('highlight-fill').value.trim(),
+            fontColor: document.getElementById('highlight-font-color').value.trim(),
+            bold: document.getElementById('highlight-bold').checked,
+            italic: document.getElementById('highlight-italic').checked,
+            underline: document.getElementById('highlight-underline').checked,
+            none: document.getElementById('highlight-none').checked,
+            comment: document.getElementById('highlight-comment').value.trim()
+        },
+        verbose: document.getElementById('verbose').checked
+    });
+}
+
+function applyPayload(req) {
+    document.getElementById('dir').value = req.dir || '.';
+    document.getElementById('search').value = req.search || '';
+    document.getElementById('replace').value = req.replace || '';
+    document.getElementById('dictionary').value = req.dictionary || '';
+    document.getElementById('exclude-dir').value = req.excludeDir || '';
+    const files = req.files || {};
+    document.getElementById('files-include').value = (files.include || []).join(', ');
+    document.getElementById('files-exclude').value = (files.exclude || []).join(', ');
+    document.getElementById('files-exclude-dirs').value = (files.excludeDirs || []).join(', ');
+    document.getElementById('files-max-depth').value = files.maxDepth || 0;
+    document.getElementById('files-min-size').value = files.minSize || '';
+    document.getElementById('files-max-size').value = files.maxSize || '';
+    document.getElementById('files-modified-since').value = files.modifiedSince || '';
+    document.getElementById('files-modified-before').value = files.modifiedBefore || '';
+    document.getElementById('files-follow-symlinks').checked = !!files.followSymlinks;
+    document.getElementById('files-no-ignore-file').checked = !!files.noIgnoreFile;
+    const scope = req.scope || {};
+    document.getElementById('scope-sheets').value = (scope.sheets || []).join(', ');
+    document.getElementById('scope-exclude-sheets').value = (scope.excludeSheets || []).join(', ');
+    document.getElementById('scope-ranges').value = (scope.ranges || []).join(', ');
+    document.getElementById('scope-columns').value = (scope.columns || []).join(', ');
+    document.getElementById('scope-header-rows').value = (scope.headerRows || []).join(', ');
+    document.getElementById('scope-conditions').value = (scope.conditions || []).join('\n');
+    document.getElementById('verbose').checked = !!req.verbose;
+    document.getElementById('scope-skip-hidden-sheets').checked = !!scope.skipHiddenSheets;
+    document.getElementById('scope-skip-hidden-rows').checked = !!scope.skipHiddenRows;
+    document.getElementById('scope-skip-hidden-columns').checked = !!scope.skipHiddenColumns;
+    const exts = req.excludeExtensions || [];
+    document.getElementById('exclude-xlsx').checked = exts.includes('.xlsx');
+    document.getElementById('exclude-xlsm').checked = exts.includes('.xlsm');
+    const mode = req.searchOnly ? 'search' : (req.mode === 'highlight' ? 'highlight' : 'replace');
+    document.querySelector(`input[name="mode"][value="${mode}"]`).checked = true;
+    const highlight = req.highlight || {};
+    document.getElementById('highlight-fill').value = highlight.fill || '';
+    document.getElementById('highlight-font-color').value = highlight.fontColor || '';
+    document.getElementById('highlight-bold').checked = !!highlight.bold;
+    document.getElementById('highlight-italic').checked = !!highlight.italic;
+    document.getElementById('highlight-underline').checked = !!highlight.underline;
+    document.getElementById('highlight-none').checked = !!highlight.none;
+    document.getElementById('highlight-comment').value = highlight.comment || '';
+    const format = document.querySelector(`input[name="format"][value="${req.format || 'csv'}"]`);
+    if (format) format.checked = true;
+    document.getElementById('encoding').value = req.encoding || 'cp932';
+    const limit = req.limit || {};
+    document.getElementById('limit-kind').value = limit.nth ? 'nth' : 'first';
+    document.getElementById('limit-count').value = limit.nth || limit.first || 0;
+    document.getElementById('limit-scope').value = limit.scope || 'cell';
+    document.getElementById('limit-unit').value = limit.unit || 'occurrence';
+    document.getElementById('note-old').checked = !!req.noteOld;
+    document.getElementById('change-log').checked = !!req.changeLog;
+    document.getElementById('change-log-sheet').value = req.changeLog || '';
+    toggleMode();
+
+    loadedJobExtras = {
+        name: req.name,
+        ignoreCase: req.ignoreCase,
+        regex: req.regex,
+        wholeCell: req.wholeCell,
+        pairs: req.pairs,
+        reportDir: req.reportDir,
+        reportName: req.reportName,
+        fallback: req.fallback,
+        allowFormulas: req.allowFormulas,
+        perOccurrence: req.perOccurrence,
+        backupDir: req.backupDir,
+        backupTimestamped: req.backupTimestamped,
+        operator: req.operator
     };
+}
+
+async function loadJob() {
+    const path = document.getElementById('job-path').value.trim();
+    if (!path) {
+        alert('ジョブファイルのパスを入力してください');
+        return;
+    }
+    try {
+        const response = await fetch(`/api/job/load?path=${encodeURIComponent(path)}`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        applyPayload(data.jobs[0]);
+        if (data.jobs.length > 1) {
+            alert(`ジョブファイルには ${data.jobs.length} 件のジョブがあります。最初のジョブを読み込みました。\nすべてのジョブを実行するには CLI の run コマンドを使用してください。`);
+        }
+    } catch (error) {
+        alert('読込エラー: ' + error.message);
+    }
+}
+
+async function saveJob() {
+    const path = document.getElementById('job-path').value.trim();
+    if (!path) {
+        alert('ジョブファイルのパスを入力してください');
+        return;
+    }
+    if (!path.toLowerCase().endsWith('.json')) {
+        alert('ジョブファイルの拡張子は .json にしてください');
+        return;
+    }
+    const save = (overwrite) => fetch('/api/job/save', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ path: path, overwrite: overwrite, request: buildPayload() })
+    });
+    try {
+        let response = await save(false);
+        if (response.status === 409) {
+            if (!confirm(path + ' は既に存在します。上書きしますか？')) {
+                return;
+            }
+            response = await save(true);
+        }
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        alert('保存しました: ' + path);
+    } catch (error) {
+        alert('保存エラー: ' + error.message);
+    }
+}
+
+async function previewFiles() {
+    const payload = buildPayload();
+    const result = document.getElementById('preview-result');
+    if (!payload.dir) {
+        alert('ディレクトリは必須です');
+        return;
+    }
+    result.textContent = '検索中...';
+    try {
+        const response = await fetch('/api/preview', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(payload)
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        result.textContent = `${data.files.length} 件のファイルが対象です\n` + data.files.join('\n');
+    } catch (error) {
+        result.textContent = 'エラー: ' + error.message;
+    }
+}
+
+async function startProcess() {
+    const payload = buildPayload();
+
+    if (!payload.dir || (!payload.search && !payload.dictionary && !(payload.pairs && payload.pairs.length))) {
+        alert('ディレクトリと検索文字列（または置換辞書）は必須です');
+        return;
+    }
 
     try {
         const response = await fetch('/api/run', {
@@ -119,14 +332,22 @@ async function pollStatus() {
             const progressBar = document.getElementById('progress-bar');
             progressBar.style.width = status.progress + '%';
 
-            document.getElementById('status-text').textContent = status.message;
+            let message = status.message;
+            if (status.skipped) {
+                message += ` (出現数の制限・行の条件で ${status.skipped} セルをスキップしました)`;
+            }
+            if (status.substituted) {
+                message += ` (レポートの文字コードで表せない文字 ${status.substituted} 文字を置き換えました)`;
+            }
+            document.getElementById('status-text').textContent = message;
             document.getElementById('current-file').textContent = status.currentFile;
             document.getElementById('stat-files').textContent = status.processedFiles + ' / ' + status.totalFiles;
 
             const mode = document.querySelector('input[name="mode"]:checked').value;
-            const label = mode === 'search' ? 'ヒット数' : '置換数';
+            const label = { search: 'ヒット数（セル）', highlight: 'ハイライト数（セル）' }[mode] || '置換数（セル）';
             document.getElementById('stat-replacements-label').textContent = label;
             document.getElementById('stat-replacements').textContent = status.totalReplacements;
+            document.getElementById('stat-occurrences').textContent = status.totalOccurrences || 0;
 
             // Update Worker Stats
             if (status.workerCounts) {
@@ -151,6 +372,43 @@ async function pollStatus() {
     }, 500);
 }
 
+// Watch mode ("watch -port") publishes rescans; show them while it is active
+async function pollWatch() {
+    try {
+        const response = await fetch('/api/watch');
+        const status = await response.json();
+        if (!status.active) {
+            return;
+        }
+        document.getElementById('watch-card').style.display = 'block';
+        document.getElementById('watch-info').textContent = `監視中: ${status.root} (ルール: ${status.rules})`;
+        const results = document.getElementById('watch-results');
+        results.innerHTML = '';
+        for (const res of status.results || []) {
+            const item = document.createElement('div');
+            item.style.marginBottom = '8px';
+            const title = document.createElement('div');
+            const count = (res.violations || []).length;
+            title.textContent = `${new Date(res.time).toLocaleTimeString()} ${res.path} — ` +
+                (res.error ? 'エラー: ' + res.error : (count ? `${count} 件の違反` : '違反なし'));
+            title.style.fontWeight = 'bold';
+            title.style.color = res.error || count ? 'red' : 'green';
+            item.appendChild(title);
+            for (const v of res.violations || []) {
+                const line = document.createElement('div');
+                line.className = 'small-text';
+                line.textContent = `${v.sheet}!${v.cell} [${v.severity}] ${v.message}: ${v.value}`;
+                item.appendChild(line);
+            }
+            results.appendChild(item);
+        }
+    } catch (error) {
+        console.error('Watch poll error:', error);
+    }
+}
+setInterval(pollWatch, 2000);
+pollWatch();
+
 function downloadReport() {
     if (currentReportPath) {
         window.location.href = `/api/download?path=${encodeURIComponent(currentReportPath)}`;
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxWatchResults is the number of rescans kept for the web UI.
+const maxWatchResults = 200
+
+// WatchViolation is one violation found by a rescan in watch mode.
+type WatchViolation struct {
+	Sheet    string `json:"sheet"`
+	Cell     string `json:"cell"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Value    string `json:"value"`
+}
+
+// WatchResult is the outcome of rescanning one workbook in watch mode.
+type WatchResult struct {
+	Path       string           `json:"path"`
+	Time       time.Time        `json:"time"`
+	Violations []WatchViolation `json:"violations"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// WatchStatus is returned by /api/watch.
+type WatchStatus struct {
+	Active  bool          `json:"active"`
+	Root    string        `json:"root"`
+	Rules   string        `json:"rules"`
+	Results []WatchResult `json:"results"` // Newest first
+}
+
+var (
+	watchStatus WatchStatus
+	watchMutex  sync.Mutex
+)
+
+// StartWatch marks watch mode as active so that the web UI shows its results.
+func StartWatch(root, rules string) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	watchStatus = WatchStatus{Active: true, Root: root, Rules: rules}
+}
+
+// PublishWatchResult adds a rescan result for the web UI.
+func PublishWatchResult(res WatchResult) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	watchStatus.Results = append([]WatchResult{res}, watchStatus.Results...)
+	if len(watchStatus.Results) > maxWatchResults {
+		watchStatus.Results = watchStatus.Results[:maxWatchResults]
+	}
+}
+
+func handleWatch(w http.ResponseWriter, r *http.Request) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	json.NewEncoder(w).Encode(watchStatus)
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// OutsideDir is the folder of a backup that holds files from outside the base
+// directory, under their full path (e.g. D:\other\a.xlsx -> backup\_outside\D\other\a.xlsx).
+const OutsideDir = "_outside"
+
+// BackupFile copies path into backupDir, keeping its location relative to baseDir
+// (e.g. base\sub\a.xlsx -> backup\sub\a.xlsx). It returns the backup path.
+// An existing backup is never overwritten, because it holds the file as it was
+// before an earlier run; use a new backup directory for every run.
+func BackupFile(path, baseDir, backupDir string) (string, error) {
+	rel, err := backupPath(path, baseDir)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(backupDir, rel)
+	if err := copyTo(ToExtendedPath(path), ToExtendedPath(dst), os.O_EXCL); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("backup %s already exists (use a new backup directory for every run)", dst)
+		}
+		os.Remove(ToExtendedPath(dst))
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return dst, nil
+}
+
+// RestoreBackups copies every file under backupDir back to the same relative
+// location under baseDir, and the files under OutsideDir back to their full
+// path. It returns the restored paths.
+func RestoreBackups(backupDir, baseDir string) ([]string, error) {
+	var restored []string
+	err := filepath.Walk(backupDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(backupDir, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(baseDir, rel)
+		if outside, ok := cutDir(rel, OutsideDir); ok {
+			dst = fromOutsidePath(outside)
+		}
+		if err := copyFile(ToExtendedPath(path), ToExtendedPath(dst)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", dst, err)
+		}
+		restored = append(restored, dst)
+		return nil
+	})
+	return restored, err
+}
+
+// Within returns the path of target relative to dir, and whether target is dir
+// itself or lies inside it. Unlike a prefix test, "docs_old" is not inside "docs".
+func Within(dir, target string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absTarget)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// backupPath returns the location of the backup of path within the backup
+// directory.
+func backupPath(path, baseDir string) (string, error) {
+	if rel, ok := Within(baseDir, path); ok {
+		return rel, nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(OutsideDir, toOutsidePath(absPath)), nil
+}
+
+// toOutsidePath turns an absolute path into a relative one: the volume becomes
+// the first folder (C:\a -> C\a, \\server\share\a -> UNC\server\share\a).
+func toOutsidePath(abs string) string {
+	vol := filepath.VolumeName(abs)
+	rest := strings.TrimLeft(abs[len(vol):], `\/`)
+	switch {
+	case vol == "":
+		return rest
+	case strings.HasPrefix(vol, `\\`):
+		return filepath.Join("UNC", vol[2:], rest)
+	default:
+		return filepath.Join(strings.TrimSuffix(vol, ":"), rest)
+	}
+}
+
+// fromOutsidePath is the inverse of toOutsidePath.
+func fromOutsidePath(rel string) string {
+	if runtime.GOOS != "windows" {
+		return string(filepath.Separator) + rel
+	}
+	if unc, ok := cutDir(rel, "UNC"); ok {
+		return `\\` + unc
+	}
+	drive, rest, _ := strings.Cut(rel, `\`)
+	return drive + `:\` + rest
+}
+
+// cutDir returns rel without its first folder if that folder is dir.
+func cutDir(rel, dir string) (string, bool) {
+	return strings.CutPrefix(rel, dir+string(filepath.Separator))
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBackupFile_Restore(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "docs")
+	backup := filepath.Join(root, "backup")
+	files := map[string]string{
+		filepath.Join(base, "a.xlsx"):             "a",
+		filepath.Join(base, "sub", "a.xlsx"):      "sub",
+		filepath.Join(base, "..x", "a.xlsx"):      "dots",
+		filepath.Join(root, "docs_old", "a.xlsx"): "old",
+		filepath.Join(root, "other", "a.xlsx"):    "other",
+	}
+	for path, content := range files {
+		writeFile(t, path, content)
+	}
+
+	for path := range files {
+		dst, err := BackupFile(path, base, backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, inside := Within(base, path)
+		if inside != !strings.HasPrefix(dst, filepath.Join(backup, OutsideDir)) {
+			t.Errorf("backup of %s at %s", path, dst)
+		}
+	}
+	if got := readFile(t, filepath.Join(backup, "..x", "a.xlsx")); got != "dots" {
+		t.Errorf("backup of ..x/a.xlsx = %q", got)
+	}
+
+	for path := range files {
+		writeFile(t, path, "changed")
+	}
+	restored, err := RestoreBackups(backup, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != len(files) {
+		t.Errorf("restored %v", restored)
+	}
+	for path, content := range files {
+		if got := readFile(t, path); got != content {
+			t.Errorf("%s = %q after restore, want %q", path, got, content)
+		}
+	}
+}
+
+func TestBackupFile_KeepsExisting(t *testing.T) {
+	base := t.TempDir()
+	backup := t.TempDir()
+	path := filepath.Join(base, "a.xlsx")
+	writeFile(t, path, "original")
+	if _, err := BackupFile(path, base, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, "first run")
+	if _, err := BackupFile(path, base, backup); err == nil {
+		t.Error("expected an error for an existing backup")
+	}
+	if got := readFile(t, filepath.Join(backup, "a.xlsx")); got != "original" {
+		t.Errorf("backup = %q, want the original", got)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		dir, target string
+		rel         string
+		ok          bool
+	}{
+		{"docs", "docs", ".", true},
+		{"docs", filepath.Join("docs", "a", "b.xlsx"), filepath.Join("a", "b.xlsx"), true},
+		{"docs", filepath.Join("docs", "..x"), "..x", true},
+		{"docs", "docs_old", "", false},
+		{"docs", filepath.Join("docs", "..", "a"), "", false},
+	}
+	for _, tt := range tests {
+		rel, ok := Within(tt.dir, tt.target)
+		if rel != tt.rel || ok != tt.ok {
+			t.Errorf("Within(%q, %q) = %q, %v; want %q, %v", tt.dir, tt.target, rel, ok, tt.rel, tt.ok)
+		}
+	}
+}
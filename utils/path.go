@@ -5,13 +5,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/xuri/excelize/v2"
 )
 
 // ToExtendedPath converts a path to a Windows extended-length path (prefixed with \\?\).
-// This allows accessing paths longer than 260 characters.
+// This allows accessing paths longer than 260 characters. On other systems,
+// which have no such limit, it returns the absolute path.
 func ToExtendedPath(path string) string {
 	// Clean the path first
 	path = filepath.Clean(path)
@@ -21,6 +23,9 @@ func ToExtendedPath(path string) string {
 	if err == nil {
 		path = absPath
 	}
+	if runtime.GOOS != "windows" {
+		return path
+	}
 
 	// If already extended, return as is
 	if strings.HasPrefix(path, "\\\\?\\") {
@@ -56,6 +61,11 @@ func SaveExcelSafe(f *excelize.File, targetPath string) error {
 	// 3. Move to target path using extended path
 	extendedTarget := ToExtendedPath(targetPath)
 
+	// Renaming over a read-only file only fails on Windows; refuse it everywhere
+	if info, err := os.Stat(extendedTarget); err == nil && info.Mode().Perm()&0200 == 0 {
+		return fmt.Errorf("%s is read-only", targetPath)
+	}
+
 	// os.Rename works for moving files on the same drive.
 	// If it fails (e.g. different drive), we fall back to Copy+Delete.
 	if err := os.Rename(tempPath, extendedTarget); err != nil {
@@ -70,6 +80,11 @@ func SaveExcelSafe(f *excelize.File, targetPath string) error {
 }
 
 func copyFile(src, dst string) error {
+	return copyTo(src, dst, os.O_TRUNC)
+}
+
+// copyTo copies src to dst, opening dst with os.O_CREATE|os.O_WRONLY|flag.
+func copyTo(src, dst string, flag int) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
@@ -81,12 +96,14 @@ func copyFile(src, dst string) error {
 		return err
 	}
 
-	destFile, err := os.Create(dst)
+	destFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|flag, 0666)
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
 
 	_, err = io.Copy(destFile, sourceFile)
+	if cerr := destFile.Close(); err == nil {
+		err = cerr
+	}
 	return err
 }
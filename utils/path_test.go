@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -10,6 +11,9 @@ import (
 )
 
 func TestToExtendedPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("extended-length paths are Windows only")
+	}
 	cwd, _ := os.Getwd()
 	tests := []struct {
 		input    string
@@ -28,6 +32,28 @@ func TestToExtendedPath(t *testing.T) {
 	}
 }
 
+func TestToExtendedPath_NotWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("see TestToExtendedPath")
+	}
+	cwd, _ := os.Getwd()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/tmp/test", "/tmp/test"},
+		{"/tmp/a/../test/", "/tmp/test"},
+		{"relative/path", filepath.Join(cwd, "relative", "path")},
+	}
+
+	for _, tt := range tests {
+		result := ToExtendedPath(tt.input)
+		if result != tt.expected {
+			t.Errorf("ToExtendedPath(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
 func TestSaveExcelSafe_LongPath(t *testing.T) {
 	// Create a very long path
 	baseDir := t.TempDir()
@@ -2,7 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"os/user"
 )
 
 // ForceCloseExcel attempts to terminate the Excel process to ensure files can be written.
@@ -20,3 +22,17 @@ func ForceCloseExcel() error {
 	}
 	return nil
 }
+
+// CurrentUser returns the name of the user running the tool (DOMAIN\user on
+// Windows), or "" if it is unknown.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, env := range []string{"USERNAME", "USER"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"excel_converter/lint"
+	"excel_converter/server"
+	"excel_converter/watch"
+)
+
+// runWatch implements the "watch" command: the check rules are applied to every
+// workbook that is created or saved under -dir until the process is stopped.
+// Violations are printed, appended to the log file and, with -port, shown in the web UI.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	dirFlag := fs.String("dir", ".", "Directory to watch")
+	rulesFlag := fs.String("rules", "", "Rules file (CSV/TSV/XLSX): pattern, type, severity, message")
+	logFlag := fs.String("log", "excel_converter_watch.log", "Append violations to this file (\"\" = no log)")
+	portFlag := fs.String("port", "", "Also show live results in the web UI on this port")
+	pollFlag := fs.Bool("poll", false, "Poll for changes instead of using file notifications")
+	intervalFlag := fs.Duration("interval", 5*time.Second, "Polling interval")
+	debounceFlag := fs.Duration("debounce", 2*time.Second, "Wait until a file has not changed for this long before checking it")
+	initialFlag := fs.Bool("initial", false, "Check all files once at startup")
+	filterFlags := addFilterFlags(fs)
+	fs.Parse(args)
+
+	filter, err := filterFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	if *rulesFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -rules is required")
+		return ExitError
+	}
+	rules, err := lint.LoadRules(*rulesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading rules: %v\n", err)
+		return ExitError
+	}
+
+	var logFile *os.File
+	if *logFlag != "" {
+		logFile, err = os.OpenFile(*logFlag, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening log: %v\n", err)
+			return ExitError
+		}
+		defer logFile.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// The port is bound before watching starts, so a port in use is reported
+	// here; a later failure of the web UI stops the watch
+	serveErr := make(chan error, 1)
+	if *portFlag != "" {
+		l, err := server.Listen(*portFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitError
+		}
+		server.StartWatch(*dirFlag, *rulesFlag)
+		go func() {
+			serveErr <- server.Serve(l)
+			stop()
+		}()
+	}
+
+	// check returns the read error, so that the watcher checks the file again
+	// (Excel may still be writing or locking it)
+	check := func(path string) error {
+		now := time.Now()
+		res := server.WatchResult{Path: path, Time: now}
+		violations, fileErrors, err := lint.Check([]string{path}, rules, nil)
+		if err == nil && len(fileErrors) > 0 {
+			err = fileErrors[0].Err
+		}
+		stamp := now.Format("2006-01-02 15:04:05")
+		if err != nil {
+			res.Error = err.Error()
+			fmt.Printf("%s %s: error: could not read file: %v\n", stamp, path, err)
+		} else {
+			fmt.Printf("%s %s: %d violations\n", stamp, path, len(violations))
+		}
+		for _, v := range violations {
+			fmt.Printf("  %s\n", v.String())
+			if logFile != nil {
+				fmt.Fprintf(logFile, "%s\t%s\n", stamp, v.String())
+			}
+			res.Violations = append(res.Violations, server.WatchViolation{
+				Sheet:    v.Sheet,
+				Cell:     v.Cell,
+				Severity: v.Rule.Severity,
+				Message:  v.Rule.Message,
+				Value:    v.Value,
+			})
+		}
+		server.PublishWatchResult(res)
+		return err
+	}
+
+	w := &watch.Watcher{
+		Root:     *dirFlag,
+		Filter:   filter,
+		Debounce: *debounceFlag,
+		Interval: *intervalFlag,
+		Poll:     *pollFlag,
+	}
+	if *initialFlag {
+		files, err := selectFiles(*dirFlag, filter, "", os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error scanning files: %v\n", err)
+			return ExitError
+		}
+		for _, path := range files {
+			check(path)
+		}
+	}
+
+	fmt.Printf("Checking %s with %d rules; press Ctrl+C to stop.\n", filepath.Clean(*dirFlag), len(rules))
+	if err := w.Run(ctx, check); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	select {
+	case err := <-serveErr:
+		fmt.Fprintf(os.Stderr, "Error: web UI: %v\n", err)
+		return ExitError
+	default:
+	}
+	return ExitOK
+}
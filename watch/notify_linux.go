@@ -0,0 +1,115 @@
+package watch
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// inotifyNotifier watches every directory under the root with inotify.
+type inotifyNotifier struct {
+	fd     int
+	file   *os.File
+	events chan<- string
+	stop   chan struct{} // Closed by Close, so that a pending send does not block
+	once   sync.Once
+	mu     sync.Mutex
+	dirs   map[int32]string // Watch descriptor -> directory
+}
+
+func newNotifier(root string, events chan<- string) (*inotifyNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// A non-blocking descriptor wrapped in os.File uses the runtime poller, so Close unblocks Read
+	n := &inotifyNotifier{fd: fd, file: os.NewFile(uintptr(fd), "inotify"), events: events, stop: make(chan struct{}), dirs: make(map[int32]string)}
+	if err := n.addTree(root, false); err != nil {
+		n.file.Close()
+		return nil, err
+	}
+	go n.read()
+	return n, nil
+}
+
+// addTree watches dir and its subdirectories. For directories created while
+// watching, report is true so that files written before the watch existed are not missed.
+func (n *inotifyNotifier) addTree(dir string, report bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable directories are skipped, as when collecting files
+		}
+		if !d.IsDir() {
+			if report && !n.send(path) {
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if err != nil {
+			return err // Usually fs.inotify.max_user_watches; the caller falls back to polling
+		}
+		n.mu.Lock()
+		n.dirs[int32(wd)] = path
+		n.mu.Unlock()
+		return nil
+	})
+}
+
+// send reports path, or returns false when the notifier was closed.
+func (n *inotifyNotifier) send(path string) bool {
+	select {
+	case n.events <- path:
+		return true
+	case <-n.stop:
+		return false
+	}
+}
+
+func (n *inotifyNotifier) read() {
+	defer n.Close()
+	buf := make([]byte, 64*1024)
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			return // Closed
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			n.mu.Lock()
+			dir, ok := n.dirs[event.Wd]
+			n.mu.Unlock()
+			if !ok || event.Len == 0 {
+				continue
+			}
+			path := filepath.Join(dir, string(bytes.TrimRight(nameBytes, "\x00")))
+			if event.Mask&syscall.IN_ISDIR != 0 {
+				n.addTree(path, true)
+				continue
+			}
+			if !n.send(path) {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the reader and closes the inotify descriptor. It may be called
+// more than once.
+func (n *inotifyNotifier) Close() error {
+	var err error
+	n.once.Do(func() {
+		close(n.stop)
+		err = n.file.Close()
+	})
+	return err
+}
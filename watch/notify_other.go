@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watch
+
+import (
+	"errors"
+	"io"
+)
+
+func newNotifier(root string, events chan<- string) (io.Closer, error) {
+	return nil, errors.New("not supported on this platform")
+}
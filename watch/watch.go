@@ -0,0 +1,172 @@
+// Package watch reports workbooks that are created or saved under a directory.
+// It uses file system notifications where available (inotify on Linux) and
+// falls back to polling otherwise.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"excel_converter/processor"
+)
+
+// Watcher reports the workbooks under Root that are selected by Filter.
+type Watcher struct {
+	Root     string
+	Filter   processor.FileFilter
+	Debounce time.Duration // Quiet period after the last write before a file is reported (default 2s)
+	Interval time.Duration // Polling interval (default 5s)
+	Poll     bool          // Always poll, even when notifications are available
+	Retries  int           // Checks of a file that could not be read, after the first one (default 3)
+	Log      io.Writer     // Destination for status messages (default: os.Stdout)
+}
+
+func (w *Watcher) logf(format string, a ...interface{}) {
+	out := w.Log
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, a...)
+}
+
+// Run calls onChange for every workbook that is created or saved, until ctx is
+// done. Excel writes a file several times while saving, so a file is only
+// reported once it has not changed for the debounce period. A file for which
+// onChange fails (e.g. Excel still has it locked) is reported again after a
+// longer wait each time, up to Retries times.
+func (w *Watcher) Run(ctx context.Context, onChange func(path string) error) error {
+	if _, err := os.Stat(w.Root); err != nil {
+		return err
+	}
+	debounce := w.Debounce
+	if debounce <= 0 {
+		debounce = 2 * time.Second
+	}
+	retries := w.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	events := make(chan string, 256)
+	var backend io.Closer
+	if !w.Poll {
+		n, err := newNotifier(w.Root, events)
+		if err != nil {
+			w.logf("File notifications unavailable (%v); polling instead.\n", err)
+		} else {
+			backend = n
+			w.logf("Watching %s (notifications)\n", w.Root)
+		}
+	}
+	if backend == nil {
+		interval := w.Interval
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		p, err := newPoller(w.Root, w.Filter, interval, events)
+		if err != nil {
+			return err
+		}
+		backend = p
+		w.logf("Watching %s (polling every %v)\n", w.Root, interval)
+	}
+	defer backend.Close()
+
+	pending := make(map[string]time.Time) // Path -> time of the last event
+	failures := make(map[string]int)      // Path -> failed checks in a row
+	ticker := time.NewTicker(debounce / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case path := <-events:
+			pending[path] = time.Now()
+		case now := <-ticker.C:
+			for path, last := range pending {
+				if now.Sub(last) < debounce {
+					continue
+				}
+				delete(pending, path)
+				if !w.Filter.Selects(w.Root, path) {
+					continue
+				}
+				err := onChange(path)
+				switch {
+				case err == nil:
+					delete(failures, path)
+				case failures[path] < retries:
+					failures[path]++
+					wait := time.Duration(failures[path]) * debounce
+					w.logf("Checking %s again in %v (%d of %d).\n", path, wait, failures[path], retries)
+					pending[path] = now.Add(wait - debounce)
+				default:
+					delete(failures, path)
+					w.logf("Giving up on %s: %v\n", path, err)
+				}
+			}
+		}
+	}
+}
+
+// poller detects changes by comparing the size and modification time of the
+// selected files at every interval.
+type poller struct {
+	stop chan struct{}
+}
+
+func newPoller(root string, filter processor.FileFilter, interval time.Duration, events chan<- string) (*poller, error) {
+	snapshot := func() (map[string]string, error) {
+		files, err := processor.CollectTargetFilesWithFilter(root, filter)
+		if err != nil {
+			return nil, err
+		}
+		state := make(map[string]string, len(files))
+		for _, path := range files {
+			if info, err := os.Stat(path); err == nil {
+				state[path] = fmt.Sprintf("%d/%d", info.Size(), info.ModTime().UnixNano())
+			}
+		}
+		return state, nil
+	}
+	prev, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &poller{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				cur, err := snapshot()
+				if err != nil {
+					continue // e.g. the share is temporarily unavailable
+				}
+				for path, s := range cur {
+					if prev[path] != s {
+						select {
+						case events <- path:
+						case <-p.stop:
+							return
+						}
+					}
+				}
+				prev = cur
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (p *poller) Close() error {
+	close(p.stop)
+	return nil
+}
@@ -0,0 +1,199 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"excel_converter/lint"
+	"excel_converter/processor"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func runAndWrite(t *testing.T, w *Watcher) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	changed := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, func(path string) error {
+			changed <- path
+			return nil
+		})
+	}()
+	time.Sleep(200 * time.Millisecond) // Let the watcher start
+
+	// Several writes in a row, as Excel does while saving, are reported once
+	target := filepath.Join(w.Root, "sub", "a.xlsx")
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(target, []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	os.WriteFile(filepath.Join(w.Root, "notes.txt"), []byte("x"), 0644)
+
+	var got []string
+	timeout := time.After(1200 * time.Millisecond)
+	for {
+		select {
+		case path := <-changed:
+			got = append(got, path)
+		case <-timeout:
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			return got
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		root := t.TempDir()
+		if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		w := &Watcher{Root: root, Poll: poll, Debounce: 300 * time.Millisecond, Interval: 100 * time.Millisecond, Log: io.Discard}
+		got := runAndWrite(t, w)
+		if len(got) != 1 || got[0] != filepath.Join(root, "sub", "a.xlsx") {
+			t.Errorf("poll=%v: got %v", poll, got)
+		}
+	}
+}
+
+// TestWatcher_Check runs the pipeline of the watch command: a saved workbook
+// is reported and then checked against the rules.
+func TestWatcher_Check(t *testing.T) {
+	rules, err := lint.ParseRules("rules.csv", [][]string{{"旧システム", "literal", "error", "old name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, poll := range []bool{false, true} {
+		root := t.TempDir()
+		w := &Watcher{Root: root, Poll: poll, Debounce: 300 * time.Millisecond, Interval: 100 * time.Millisecond, Log: io.Discard}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		results := make(chan []lint.Violation, 1)
+		done := make(chan error)
+		go func() {
+			done <- w.Run(ctx, func(path string) error {
+				violations, fileErrors, err := lint.Check([]string{path}, rules, nil)
+				if err == nil && len(fileErrors) > 0 {
+					err = fileErrors[0].Err
+				}
+				if err != nil {
+					t.Errorf("poll=%v: check %s: %v", poll, path, err)
+				}
+				results <- violations
+				cancel()
+				return nil
+			})
+		}()
+		time.Sleep(200 * time.Millisecond) // Let the watcher start
+
+		f := excelize.NewFile()
+		f.SetCellValue("Sheet1", "B2", "旧システムの説明")
+		if err := f.SaveAs(filepath.Join(root, "a.xlsx")); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		select {
+		case violations := <-results:
+			if len(violations) != 1 || violations[0].Cell != "B2" {
+				t.Errorf("poll=%v: got %+v", poll, violations)
+			}
+		default:
+			t.Errorf("poll=%v: the workbook was not checked", poll)
+		}
+	}
+}
+
+// TestBackends_Close checks that closing a backend ends its goroutine while
+// it waits to send an event nobody receives anymore.
+func TestBackends_Close(t *testing.T) {
+	backends := map[string]func(root string, events chan string) (io.Closer, error){
+		"notifications": func(root string, events chan string) (io.Closer, error) {
+			return newNotifier(root, events)
+		},
+		"polling": func(root string, events chan string) (io.Closer, error) {
+			return newPoller(root, processor.FileFilter{}, 10*time.Millisecond, events)
+		},
+	}
+	for name, start := range backends {
+		root := t.TempDir()
+		before := runtime.NumGoroutine()
+		events := make(chan string) // Never received from
+		backend, err := start(root, events)
+		if err != nil {
+			t.Logf("%s: %v", name, err)
+			continue
+		}
+		os.WriteFile(filepath.Join(root, "a.xlsx"), []byte("x"), 0644)
+		time.Sleep(100 * time.Millisecond) // Let the backend block on the send
+		backend.Close()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := runtime.NumGoroutine(); n > before {
+			t.Errorf("%s: %d goroutines left running", name, n-before)
+		}
+	}
+}
+
+// TestWatcher_Retries checks that a file that can not be read yet is checked
+// again, and that the watcher gives up after Retries more checks.
+func TestWatcher_Retries(t *testing.T) {
+	for _, tt := range []struct {
+		failures, want int
+	}{
+		{failures: 2, want: 3},  // Readable at the third check
+		{failures: 10, want: 3}, // Given up after the second retry
+	} {
+		root := t.TempDir()
+		var log strings.Builder
+		w := &Watcher{Root: root, Poll: true, Debounce: 100 * time.Millisecond, Interval: 50 * time.Millisecond, Retries: 2, Log: &log}
+		ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+		checks := 0
+		done := make(chan error)
+		go func() {
+			done <- w.Run(ctx, func(path string) error {
+				checks++
+				if checks <= tt.failures {
+					return errors.New("locked")
+				}
+				return nil
+			})
+		}()
+		time.Sleep(100 * time.Millisecond) // Let the watcher start
+		if err := os.WriteFile(filepath.Join(root, "a.xlsx"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if checks != tt.want {
+			t.Errorf("%d failures: %d checks, want %d", tt.failures, checks, tt.want)
+		}
+		if gaveUp := strings.Contains(log.String(), "Giving up"); gaveUp != (tt.failures >= tt.want) {
+			t.Errorf("%d failures: unexpected log %q", tt.failures, log.String())
+		}
+	}
+}